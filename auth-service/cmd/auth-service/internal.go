@@ -0,0 +1,61 @@
+package main
+
+import (
+	"crypto/subtle"
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// Header com o token compartilhado entre os serviços internos
+const serviceTokenHeader = "X-Service-Token"
+
+// Autenticar chamadas de outros serviços pelo INTERNAL_SERVICE_TOKEN.
+// Sem token configurado as rotas internas ficam desabilitadas
+func requireServiceToken(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		expected := getEnv("INTERNAL_SERVICE_TOKEN", "")
+		if expected == "" {
+			http.Error(w, "Rotas internas desabilitadas", http.StatusServiceUnavailable)
+			return
+		}
+
+		token := r.Header.Get(serviceTokenHeader)
+		if subtle.ConstantTimeCompare([]byte(token), []byte(expected)) != 1 {
+			http.Error(w, "Token de serviço inválido", http.StatusUnauthorized)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// Consulta de usuário por ID para outros serviços (ex.: e-mail das notificações)
+func handleInternalGetUser(w http.ResponseWriter, r *http.Request) {
+	userID, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		http.Error(w, "ID de usuário inválido", http.StatusBadRequest)
+		return
+	}
+
+	var user User
+	err = db.QueryRow(
+		"SELECT id, username, email FROM users WHERE id = $1",
+		userID,
+	).Scan(&user.ID, &user.Username, &user.Email)
+
+	if err != nil {
+		if err == sql.ErrNoRows {
+			http.Error(w, "Usuário não encontrado", http.StatusNotFound)
+		} else {
+			http.Error(w, "Erro ao buscar usuário", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(user)
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"os"
+	"os/exec"
+	"path/filepath"
+
+	"github.com/fiap/projeto-fiapx/shared/media"
+)
+
+// Extração de frames PNG (frame_0001.png, ...) de um vídeo para outputDir
+type FrameExtractor interface {
+	ExtractFrames(videoPath, outputDir string) error
+}
+
+// Extrator usado por processVideo (substituível em testes)
+var frameExtractor FrameExtractor = ffmpegExtractor{}
+
+// Extração real via ffmpeg, 1 frame por segundo
+type ffmpegExtractor struct{}
+
+func (ffmpegExtractor) ExtractFrames(videoPath, outputDir string) error {
+	framePattern := filepath.Join(outputDir, "frame_%04d.png")
+
+	cmd := exec.Command("ffmpeg",
+		"-i", videoPath,
+		"-vf", "fps=1",
+		"-y",
+		framePattern,
+	)
+
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("Erro no ffmpeg: %s\nOutput: %s", err.Error(), string(output))
+	}
+	return nil
+}
+
+// Extrator em processo, sem ffmpeg: gera Frames imagens sintéticas
+// determinísticas (mesma entrada, mesmos bytes)
+type fakeExtractor struct {
+	Frames int
+	Width  int
+	Height int
+	Err    error
+}
+
+func (f fakeExtractor) ExtractFrames(videoPath, outputDir string) error {
+	if f.Err != nil {
+		return f.Err
+	}
+	if _, err := os.Stat(videoPath); err != nil {
+		return fmt.Errorf("Erro no ffmpeg: %v", err)
+	}
+
+	width, height := f.Width, f.Height
+	if width <= 0 || height <= 0 {
+		width, height = 64, 36
+	}
+
+	for i := 1; i <= f.Frames; i++ {
+		img := image.NewRGBA(image.Rect(0, 0, width, height))
+		for y := 0; y < height; y++ {
+			for x := 0; x < width; x++ {
+				img.Set(x, y, color.RGBA{R: uint8(i * 40), G: uint8(x * 255 / width), B: uint8(y * 255 / height), A: 255})
+			}
+		}
+
+		file, err := os.Create(filepath.Join(outputDir, fmt.Sprintf("frame_%04d.png", i)))
+		if err != nil {
+			return err
+		}
+		err = png.Encode(file, img)
+		file.Close()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Prober usado na validação dos uploads (substituível em testes)
+var mediaProber media.Prober = media.FFprobe{}
+
+// Prober em processo, sem ffprobe: devolve Info para qualquer arquivo
+// existente, ou os erros configurados
+type fakeProber struct {
+	Info      media.Info
+	Err       error
+	DecodeErr error
+}
+
+func (f fakeProber) Probe(ctx context.Context, videoPath string) (*media.Info, error) {
+	if f.Err != nil {
+		return nil, f.Err
+	}
+	if _, err := os.Stat(videoPath); err != nil {
+		return nil, &media.ProbeError{Message: "Não foi possível ler o container do vídeo", Detail: err.Error()}
+	}
+	info := f.Info
+	return &info, nil
+}
+
+func (f fakeProber) DecodeFirstFrame(ctx context.Context, videoPath string) error {
+	return f.DecodeErr
+}
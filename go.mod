@@ -2,7 +2,10 @@ module video-processor
 
 go 1.21
 
-require github.com/gin-gonic/gin v1.9.1
+require (
+	github.com/fiap/projeto-fiapx/shared v0.0.0
+	github.com/gin-gonic/gin v1.9.1
+)
 
 require (
 	github.com/bytedance/sonic v1.9.1 // indirect
@@ -30,3 +33,5 @@ require (
 	google.golang.org/protobuf v1.30.0 // indirect
 	gopkg.in/yaml.v3 v3.0.1 // indirect
 )
+
+replace github.com/fiap/projeto-fiapx/shared => ./shared
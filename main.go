@@ -2,16 +2,18 @@ package main
 
 import (
 	"archive/zip"
+	"errors"
 	"fmt"
 	"io"
 	"log"
 	"os"
-	"os/exec"
 	"path/filepath"
 	"strings"
 	"time"
 
 	"github.com/gin-gonic/gin"
+
+	"github.com/fiap/projeto-fiapx/shared/media"
 )
 
 type VideoRequest struct {
@@ -22,6 +24,7 @@ type VideoRequest struct {
 type ProcessingResult struct {
 	Success    bool     `json:"success"`
 	Message    string   `json:"message"`
+	Code       string   `json:"code,omitempty"` // código de rejeição da validação
 	ZipPath    string   `json:"zip_path,omitempty"`
 	FrameCount int      `json:"frame_count,omitempty"`
 	Images     []string `json:"images,omitempty"`
@@ -86,6 +89,7 @@ func handleVideoUpload(c *gin.Context) {
 	if !isValidVideoFile(header.Filename) {
 		c.JSON(400, ProcessingResult{
 			Success: false,
+			Code:    media.RejectUnsupportedExtension,
 			Message: "Formato de arquivo não suportado. Use: mp4, avi, mov, mkv",
 		})
 		return
@@ -114,6 +118,29 @@ func handleVideoUpload(c *gin.Context) {
 		return
 	}
 
+	out.Close()
+
+	if err := validateVideoFile(videoPath); err != nil {
+		os.Remove(videoPath)
+		if rejection, ok := err.(*media.Rejection); ok {
+			c.JSON(422, ProcessingResult{
+				Success: false,
+				Code:    rejection.Code,
+				Message: rejection.Message,
+			})
+			return
+		}
+		status := 500
+		if errors.Is(err, media.ErrProberUnavailable) {
+			status = 503
+		}
+		c.JSON(status, ProcessingResult{
+			Success: false,
+			Message: "Erro ao validar arquivo: " + err.Error(),
+		})
+		return
+	}
+
 	result := processVideo(videoPath, timestamp)
 
 	if result.Success {
@@ -130,20 +157,11 @@ func processVideo(videoPath, timestamp string) ProcessingResult {
 	os.MkdirAll(tempDir, 0755)
 	defer os.RemoveAll(tempDir)
 
-	framePattern := filepath.Join(tempDir, "frame_%04d.png")
-
-	cmd := exec.Command("ffmpeg",
-		"-i", videoPath,
-		"-vf", "fps=1",
-		"-y",
-		framePattern,
-	)
-
-	output, err := cmd.CombinedOutput()
+	err := frameExtractor.ExtractFrames(videoPath, tempDir)
 	if err != nil {
 		return ProcessingResult{
 			Success: false,
-			Message: fmt.Sprintf("Erro no ffmpeg: %s\nOutput: %s", err.Error(), string(output)),
+			Message: err.Error(),
 		}
 	}
 
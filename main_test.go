@@ -0,0 +1,204 @@
+package main
+
+import (
+	"archive/zip"
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/fiap/projeto-fiapx/shared/media"
+)
+
+// Executar o teste num diretório vazio, com temp/ e (opcionalmente) outputs/
+func chdirTemp(t *testing.T, withOutputs bool) {
+	t.Helper()
+	dir := t.TempDir()
+	previous, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.Chdir(previous) })
+
+	os.MkdirAll("temp", 0755)
+	if withOutputs {
+		os.MkdirAll("outputs", 0755)
+	}
+	if err := os.WriteFile("video.mp4", []byte("conteúdo do vídeo"), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestProcessVideo(t *testing.T) {
+	tests := []struct {
+		name        string
+		extractor   FrameExtractor
+		noOutputs   bool
+		wantSuccess bool
+		wantMessage string
+		wantFrames  int
+	}{
+		{
+			name:        "sucesso",
+			extractor:   fakeExtractor{Frames: 3},
+			wantSuccess: true,
+			wantMessage: "3 frames extraídos",
+			wantFrames:  3,
+		},
+		{
+			name:        "erro na extração",
+			extractor:   fakeExtractor{Err: errors.New("Erro no ffmpeg: exit status 1")},
+			wantMessage: "Erro no ffmpeg",
+		},
+		{
+			name:        "nenhum frame extraído",
+			extractor:   fakeExtractor{Frames: 0},
+			wantMessage: "Nenhum frame foi extraído do vídeo",
+		},
+		{
+			name:        "erro ao criar ZIP",
+			extractor:   fakeExtractor{Frames: 2},
+			noOutputs:   true,
+			wantMessage: "Erro ao criar arquivo ZIP",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			chdirTemp(t, !tt.noOutputs)
+
+			previous := frameExtractor
+			frameExtractor = tt.extractor
+			t.Cleanup(func() { frameExtractor = previous })
+
+			result := processVideo("video.mp4", "20240101_120000")
+
+			if result.Success != tt.wantSuccess {
+				t.Fatalf("Success = %v, esperado %v (mensagem: %s)", result.Success, tt.wantSuccess, result.Message)
+			}
+			if !strings.Contains(result.Message, tt.wantMessage) {
+				t.Errorf("Message = %q, esperado conter %q", result.Message, tt.wantMessage)
+			}
+			if result.FrameCount != tt.wantFrames {
+				t.Errorf("FrameCount = %d, esperado %d", result.FrameCount, tt.wantFrames)
+			}
+			if _, err := os.Stat(filepath.Join("temp", "20240101_120000")); !os.IsNotExist(err) {
+				t.Errorf("diretório temporário não removido")
+			}
+			if !tt.wantSuccess {
+				return
+			}
+
+			if result.ZipPath != "frames_20240101_120000.zip" {
+				t.Errorf("ZipPath = %q", result.ZipPath)
+			}
+			reader, err := zip.OpenReader(filepath.Join("outputs", result.ZipPath))
+			if err != nil {
+				t.Fatalf("ZIP não criado: %v", err)
+			}
+			defer reader.Close()
+			if len(reader.File) != tt.wantFrames {
+				t.Errorf("ZIP com %d arquivos, esperado %d", len(reader.File), tt.wantFrames)
+			}
+			if len(result.Images) != tt.wantFrames || result.Images[0] != "frame_0001.png" {
+				t.Errorf("Images = %v", result.Images)
+			}
+		})
+	}
+}
+
+func TestValidateVideoFileRejections(t *testing.T) {
+	mp4 := []byte("\x00\x00\x00\x20ftypisom\x00\x00\x02\x00")
+	h264 := fakeProber{Info: media.Info{VideoCodec: "h264", Duration: 10}}
+
+	tests := []struct {
+		name     string
+		content  []byte
+		prober   media.Prober
+		wantCode string
+	}{
+		{name: "arquivo vazio", content: nil, prober: h264, wantCode: media.RejectCorruptFile},
+		{name: "texto renomeado", content: []byte("isto não é um vídeo, apenas texto"), prober: h264, wantCode: media.RejectUnrecognizedFormat},
+		{name: "imagem PNG renomeada", content: []byte("\x89PNG\r\n\x1a\n\x00\x00\x00\x0dIHDR"), prober: h264, wantCode: media.RejectUnrecognizedFormat},
+		{name: "container ilegível", content: mp4, prober: fakeProber{Err: &media.ProbeError{Message: "Não foi possível ler o container do vídeo"}}, wantCode: media.RejectCorruptFile},
+		{name: "só áudio", content: mp4, prober: fakeProber{Info: media.Info{Duration: 180}}, wantCode: media.RejectNoVideoStream},
+		{name: "codec não suportado", content: mp4, prober: fakeProber{Info: media.Info{VideoCodec: "cinepak", Duration: 10}}, wantCode: media.RejectUnsupportedCodec},
+		{name: "duração zero", content: mp4, prober: fakeProber{Info: media.Info{VideoCodec: "h264"}}, wantCode: media.RejectZeroDuration},
+		{name: "primeiro frame não decodifica", content: mp4, prober: fakeProber{Info: h264.Info, DecodeErr: &media.ProbeError{Message: "Não foi possível decodificar o vídeo"}}, wantCode: media.RejectCorruptFile},
+		{name: "vídeo válido", content: mp4, prober: h264},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			previous := mediaProber
+			mediaProber = tt.prober
+			t.Cleanup(func() { mediaProber = previous })
+
+			path := filepath.Join(t.TempDir(), "video.mp4")
+			if err := os.WriteFile(path, tt.content, 0644); err != nil {
+				t.Fatal(err)
+			}
+
+			err := validateVideoFile(path)
+			if tt.wantCode == "" {
+				if err != nil {
+					t.Fatalf("esperado vídeo aceito, obtido %v", err)
+				}
+				return
+			}
+			rejection, ok := err.(*media.Rejection)
+			if !ok {
+				t.Fatalf("esperada rejeição %s, obtido %v", tt.wantCode, err)
+			}
+			if rejection.Code != tt.wantCode {
+				t.Errorf("Code = %s, esperado %s", rejection.Code, tt.wantCode)
+			}
+		})
+	}
+}
+
+func TestValidateVideoFileWithoutProber(t *testing.T) {
+	previous := mediaProber
+	mediaProber = fakeProber{Err: media.ErrProberUnavailable}
+	t.Cleanup(func() { mediaProber = previous })
+
+	path := filepath.Join(t.TempDir(), "video.mp4")
+	if err := os.WriteFile(path, []byte("\x00\x00\x00\x20ftypisom"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	// Sem ffprobe o arquivo não é aceito: o erro não é rejeição do arquivo
+	err := validateVideoFile(path)
+	if !errors.Is(err, media.ErrProberUnavailable) {
+		t.Fatalf("esperado media.ErrProberUnavailable, obtido %v", err)
+	}
+	if _, ok := err.(*media.Rejection); ok {
+		t.Errorf("indisponibilidade não deve virar rejeição do arquivo")
+	}
+}
+
+func TestFakeProber(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "video.mp4")
+	if err := os.WriteFile(path, []byte("vídeo"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	prober := fakeProber{Info: media.Info{VideoCodec: "h264", Duration: 3}}
+	info, err := prober.Probe(context.Background(), path)
+	if err != nil || *info != prober.Info {
+		t.Fatalf("Probe = %+v, %v", info, err)
+	}
+
+	var probeErr *media.ProbeError
+	if _, err := prober.Probe(context.Background(), filepath.Join(t.TempDir(), "inexistente.mp4")); !errors.As(err, &probeErr) {
+		t.Errorf("esperado ProbeError para arquivo inexistente, obtido %v", err)
+	}
+	if _, err := (fakeProber{Err: media.ErrProberUnavailable}).Probe(context.Background(), path); !errors.Is(err, media.ErrProberUnavailable) {
+		t.Errorf("erro configurado não devolvido: %v", err)
+	}
+}
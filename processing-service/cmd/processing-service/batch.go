@@ -0,0 +1,218 @@
+package main
+
+import (
+	"archive/zip"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// Vídeo de um lote, enviado pelo storage-service no job finalizador quando
+// todos os vídeos do lote terminaram
+type BatchMember struct {
+	VideoID       string `json:"video_id"`
+	Filename      string `json:"filename"`
+	Status        string `json:"status"` // completed, failed ou cancelled
+	ZipObjectName string `json:"zip_object_name,omitempty"`
+	ZipSize       int64  `json:"zip_size,omitempty"`
+	FrameCount    int    `json:"frame_count,omitempty"`
+	ErrorCode     string `json:"error_code,omitempty"`
+	Error         string `json:"error,omitempty"`
+}
+
+// manifest.json do ZIP combinado
+type BatchManifest struct {
+	BatchID   string               `json:"batch_id"`
+	CreatedAt time.Time            `json:"created_at"`
+	Total     int                  `json:"total"`
+	Completed int                  `json:"completed"`
+	Failed    int                  `json:"failed"`
+	Videos    []BatchManifestEntry `json:"videos"`
+}
+
+type BatchManifestEntry struct {
+	VideoID    string `json:"video_id"`
+	Filename   string `json:"filename"`
+	Status     string `json:"status"`
+	Directory  string `json:"directory,omitempty"` // diretório do vídeo dentro do ZIP
+	FrameCount int    `json:"frame_count"`
+	ErrorCode  string `json:"error_code,omitempty"`
+	Error      string `json:"error,omitempty"`
+}
+
+func batchObjectName(batchID string) string {
+	return fmt.Sprintf("batch_%s.zip", batchID)
+}
+
+// Job finalizador do lote: um ZIP com um diretório por vídeo concluído e um
+// manifest.json com o resultado de todos, inclusive os que falharam
+func (ps *ProcessingService) finalizeBatch(ctx context.Context, msg ProcessingMessage, events *jobEvents) ProcessingResult {
+	result := ProcessingResult{
+		VideoID:     msg.VideoID,
+		JobType:     JobTypeBatch,
+		ProcessedAt: time.Now(),
+		UserID:      msg.UserID,
+		Metadata:    make(map[string]interface{}),
+	}
+
+	log.Printf("Finalizando lote %s com %d vídeos", msg.BatchID, len(msg.Members))
+
+	if len(msg.Members) == 0 {
+		result.fail(newProcessingError(ErrInvalidJob, "lote %s sem vídeos", msg.BatchID))
+		return result
+	}
+
+	tempDir, err := ps.prepareWorkDir(ctx, msg, batchWorkPrefix)
+	if err != nil {
+		log.Printf("Diretório de trabalho indisponível para lote %s: %v", msg.BatchID, err)
+		result.fail(classifyError(ctx, ErrWorkspaceFailed, err))
+		return result
+	}
+	defer os.RemoveAll(tempDir)
+
+	archivePath := filepath.Join(tempDir, "batch.zip")
+	manifest, err := ps.buildBatchArchive(ctx, msg, tempDir, archivePath, events)
+	if err != nil {
+		log.Printf("Erro ao montar ZIP do lote %s: %v", msg.BatchID, err)
+		result.fail(classifyError(ctx, ErrArchiveFailed, err))
+		return result
+	}
+
+	objectName := batchObjectName(msg.BatchID)
+	size, err := ps.uploadZipToMinio(ctx, archivePath, objectName)
+	if err != nil {
+		log.Printf("Erro ao enviar ZIP do lote %s: %v", msg.BatchID, err)
+		result.fail(classifyError(ctx, ErrUploadFailed, err))
+		return result
+	}
+
+	var failures []BatchManifestEntry
+	for _, entry := range manifest.Videos {
+		result.FrameCount += entry.FrameCount
+		if entry.Status != "completed" {
+			failures = append(failures, entry)
+		}
+	}
+
+	result.Status = "completed"
+	result.ZipSize = size
+	result.ZipObjectName = objectName
+	result.Metadata["batch_id"] = msg.BatchID
+	result.Metadata["total"] = manifest.Total
+	result.Metadata["completed"] = manifest.Completed
+	result.Metadata["failed"] = manifest.Failed
+	result.Metadata["failures"] = failures
+
+	log.Printf("Lote %s finalizado: %d de %d vídeos concluídos", msg.BatchID, manifest.Completed, manifest.Total)
+	return result
+}
+
+// Copiar as entradas de cada ZIP de vídeo para <video_id>/ no ZIP combinado,
+// sem recomprimir. Vídeo concluído cujo ZIP não pode ser lido entra no
+// manifest como falha
+func (ps *ProcessingService) buildBatchArchive(ctx context.Context, msg ProcessingMessage, workDir, archivePath string, events *jobEvents) (*BatchManifest, error) {
+	archive, err := os.Create(archivePath)
+	if err != nil {
+		return nil, fmt.Errorf("erro ao criar ZIP do lote: %v", err)
+	}
+	defer archive.Close()
+
+	writer := zip.NewWriter(archive)
+	manifest := &BatchManifest{BatchID: msg.BatchID, CreatedAt: time.Now(), Total: len(msg.Members)}
+
+	for i, member := range msg.Members {
+		entry := BatchManifestEntry{
+			VideoID:   member.VideoID,
+			Filename:  member.Filename,
+			Status:    member.Status,
+			ErrorCode: member.ErrorCode,
+			Error:     member.Error,
+		}
+
+		if member.Status == "completed" {
+			if err := ctx.Err(); err != nil {
+				return nil, err
+			}
+			localPath := filepath.Join(workDir, member.VideoID+".zip")
+			reader, err := ps.openMemberArchive(ctx, member, localPath)
+			if err != nil {
+				log.Printf("Vídeo %s do lote %s fora do ZIP combinado: %v", member.VideoID, msg.BatchID, err)
+				entry.Status = "failed"
+				entry.ErrorCode = string(ErrDownloadFailed)
+				entry.Error = errorCatalog[ErrDownloadFailed].Message
+			} else {
+				err = copyArchiveEntries(writer, reader, member.VideoID+"/")
+				reader.Close()
+				os.Remove(localPath)
+				if err != nil {
+					return nil, fmt.Errorf("erro ao copiar frames do vídeo %s: %v", member.VideoID, err)
+				}
+				entry.Directory = member.VideoID + "/"
+				entry.FrameCount = member.FrameCount
+			}
+		}
+
+		if entry.Status == "completed" {
+			manifest.Completed++
+		} else {
+			manifest.Failed++
+		}
+		manifest.Videos = append(manifest.Videos, entry)
+		events.progress("batch", i+1, len(msg.Members))
+	}
+
+	data, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("erro ao serializar manifest: %v", err)
+	}
+	manifestWriter, err := writer.Create("manifest.json")
+	if err != nil {
+		return nil, err
+	}
+	if _, err := manifestWriter.Write(data); err != nil {
+		return nil, err
+	}
+
+	if err := writer.Close(); err != nil {
+		return nil, fmt.Errorf("erro ao finalizar ZIP do lote: %v", err)
+	}
+	return manifest, nil
+}
+
+// Baixar e abrir o ZIP de um vídeo concluído do lote
+func (ps *ProcessingService) openMemberArchive(ctx context.Context, member BatchMember, localPath string) (*zip.ReadCloser, error) {
+	if err := ps.downloadVideoFromMinio(ctx, "video-processed", member.ZipObjectName, localPath); err != nil {
+		return nil, err
+	}
+	reader, err := zip.OpenReader(localPath)
+	if err != nil {
+		os.Remove(localPath)
+		return nil, fmt.Errorf("ZIP inválido: %v", err)
+	}
+	return reader, nil
+}
+
+func copyArchiveEntries(writer *zip.Writer, reader *zip.ReadCloser, prefix string) error {
+	for _, file := range reader.File {
+		header := file.FileHeader
+		header.Name = prefix + file.Name
+
+		raw, err := file.OpenRaw()
+		if err != nil {
+			return err
+		}
+		target, err := writer.CreateRaw(&header)
+		if err != nil {
+			return err
+		}
+		if _, err := io.Copy(target, raw); err != nil {
+			return err
+		}
+	}
+	return nil
+}
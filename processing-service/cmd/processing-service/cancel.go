@@ -0,0 +1,144 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"sync"
+	"time"
+)
+
+// Exchange fanout de controle publicado pelo storage-service; cada réplica
+// assina com uma fila exclusiva para receber todos os cancelamentos
+const controlExchange = "video.control"
+
+// Por quanto tempo um vídeo cancelado tem os jobs ainda na fila descartados
+const cancelledTTL = 24 * time.Hour
+
+// Mensagem de controle dos jobs
+type JobControl struct {
+	Action  string `json:"action"` // cancel
+	VideoID string `json:"video_id"`
+	Reason  string `json:"reason,omitempty"`
+}
+
+// Jobs em execução nesta réplica e vídeos cancelados recentemente
+type jobCanceller struct {
+	mu        sync.Mutex
+	running   map[string]context.CancelFunc
+	cancelled map[string]time.Time
+}
+
+func newJobCanceller() *jobCanceller {
+	return &jobCanceller{
+		running:   make(map[string]context.CancelFunc),
+		cancelled: make(map[string]time.Time),
+	}
+}
+
+// Registrar o job do vídeo em execução; false se o vídeo já foi cancelado e o
+// job não deve rodar
+func (c *jobCanceller) track(videoID string, cancel context.CancelFunc) bool {
+	if c == nil {
+		return true
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if at, ok := c.cancelled[videoID]; ok && time.Since(at) < cancelledTTL {
+		return false
+	}
+	c.running[videoID] = cancel
+	return true
+}
+
+func (c *jobCanceller) untrack(videoID string) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.running, videoID)
+}
+
+// Cancelar o job em execução do vídeo e descartar os que ainda chegarem;
+// retorna true se havia um job rodando
+func (c *jobCanceller) cancel(videoID string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := time.Now()
+	for id, at := range c.cancelled {
+		if now.Sub(at) >= cancelledTTL {
+			delete(c.cancelled, id)
+		}
+	}
+	c.cancelled[videoID] = now
+
+	cancel, running := c.running[videoID]
+	if running {
+		cancel()
+	}
+	return running
+}
+
+// Resultado de um job descartado antes de iniciar
+func cancelledResult(msg ProcessingMessage) ProcessingResult {
+	jobType := msg.JobType
+	if jobType == "" {
+		jobType = JobTypeFrames
+	}
+	result := ProcessingResult{
+		VideoID:     msg.VideoID,
+		JobType:     jobType,
+		ProcessedAt: time.Now(),
+		UserID:      msg.UserID,
+		Version:     msg.Version,
+		Metadata:    map[string]interface{}{},
+	}
+	result.fail(newProcessingError(ErrCancelled, "job cancelado antes de iniciar"))
+	return result
+}
+
+// Assinar o exchange de controle e cancelar os jobs dos vídeos excluídos
+func (ps *ProcessingService) StartControlListener() {
+	ch, err := ps.RabbitConn.Channel()
+	if err != nil {
+		log.Fatalf("Erro ao criar canal de controle: %v", err)
+	}
+
+	err = ch.ExchangeDeclare(controlExchange, "fanout", true, false, false, false, nil)
+	if err != nil {
+		log.Fatalf("Erro ao declarar exchange de controle: %v", err)
+	}
+	// Fila própria da réplica, removida quando ela desconecta
+	queue, err := ch.QueueDeclare("", false, true, true, false, nil)
+	if err != nil {
+		log.Fatalf("Erro ao declarar fila de controle: %v", err)
+	}
+	if err := ch.QueueBind(queue.Name, "", controlExchange, false, nil); err != nil {
+		log.Fatalf("Erro ao assinar exchange de controle: %v", err)
+	}
+
+	msgs, err := ch.Consume(queue.Name, "", true, true, false, false, nil)
+	if err != nil {
+		log.Fatalf("Erro ao configurar consumer de controle: %v", err)
+	}
+
+	for msg := range msgs {
+		var control JobControl
+		if err := json.Unmarshal(msg.Body, &control); err != nil {
+			log.Printf("Erro ao deserializar mensagem de controle: %v", err)
+			continue
+		}
+		if control.Action != "cancel" || control.VideoID == "" {
+			continue
+		}
+
+		if ps.Cancels.cancel(control.VideoID) {
+			log.Printf("Job do vídeo %s cancelado (%s)", control.VideoID, control.Reason)
+		} else {
+			log.Printf("Vídeo %s cancelado (%s); jobs na fila serão descartados", control.VideoID, control.Reason)
+		}
+	}
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"syscall"
+)
+
+// Código de falha de um job, compartilhado com storage-service e notificações
+type ErrorCode string
+
+const (
+	ErrDownloadFailed    ErrorCode = "DOWNLOAD_FAILED"
+	ErrInvalidMedia      ErrorCode = "INVALID_MEDIA"
+	ErrInvalidJob        ErrorCode = "INVALID_JOB"
+	ErrExtractionFailed  ErrorCode = "EXTRACTION_FAILED"
+	ErrNoFrames          ErrorCode = "NO_FRAMES"
+	ErrArchiveFailed     ErrorCode = "ARCHIVE_FAILED"
+	ErrUploadFailed      ErrorCode = "UPLOAD_FAILED"
+	ErrTranscodeFailed   ErrorCode = "TRANSCODE_FAILED"
+	ErrTimeout           ErrorCode = "TIMEOUT"
+	ErrCancelled         ErrorCode = "CANCELLED"
+	ErrInsufficientSpace ErrorCode = "INSUFFICIENT_SPACE"
+	ErrWorkspaceFailed   ErrorCode = "WORKSPACE_UNAVAILABLE"
+)
+
+// Mensagem exibida ao usuário e se vale tentar o job novamente
+var errorCatalog = map[ErrorCode]struct {
+	Message   string
+	Retryable bool
+}{
+	ErrDownloadFailed:    {"Não foi possível obter o vídeo enviado.", true},
+	ErrInvalidMedia:      {"O arquivo enviado não é um vídeo válido ou está corrompido.", false},
+	ErrInvalidJob:        {"As opções de processamento do vídeo são inválidas.", false},
+	ErrExtractionFailed:  {"Não foi possível extrair os frames do vídeo.", false},
+	ErrNoFrames:          {"Nenhum frame foi extraído do vídeo.", false},
+	ErrArchiveFailed:     {"Não foi possível gerar o arquivo ZIP com os frames.", true},
+	ErrUploadFailed:      {"Não foi possível salvar o resultado do processamento.", true},
+	ErrTranscodeFailed:   {"Não foi possível converter o vídeo.", false},
+	ErrTimeout:           {"O processamento excedeu o tempo limite.", true},
+	ErrCancelled:         {"O processamento foi cancelado.", false},
+	ErrInsufficientSpace: {"Não há espaço em disco suficiente para processar o vídeo.", true},
+	ErrWorkspaceFailed:   {"Não foi possível preparar o ambiente de processamento.", true},
+}
+
+// Falha tipada: Message é segura para o usuário, Detail é apenas para logs
+type ProcessingError struct {
+	Code      ErrorCode
+	Message   string
+	Detail    string
+	Retryable bool
+}
+
+func (e *ProcessingError) Error() string {
+	return fmt.Sprintf("%s: %s", e.Code, e.Detail)
+}
+
+func newProcessingError(code ErrorCode, format string, args ...interface{}) *ProcessingError {
+	entry := errorCatalog[code]
+	return &ProcessingError{
+		Code:      code,
+		Message:   entry.Message,
+		Detail:    fmt.Sprintf(format, args...),
+		Retryable: entry.Retryable,
+	}
+}
+
+// Converter um erro qualquer em ProcessingError; erros já tipados são
+// preservados e o contexto expirado ou cancelado tem precedência
+func classifyError(ctx context.Context, code ErrorCode, err error) *ProcessingError {
+	if ctx != nil {
+		switch ctx.Err() {
+		case context.DeadlineExceeded:
+			return newProcessingError(ErrTimeout, "%v", err)
+		case context.Canceled:
+			return newProcessingError(ErrCancelled, "%v", err)
+		}
+	}
+
+	var pErr *ProcessingError
+	if errors.As(err, &pErr) {
+		return pErr
+	}
+	if errors.Is(err, syscall.ENOSPC) {
+		return newProcessingError(ErrInsufficientSpace, "%v", err)
+	}
+	return newProcessingError(code, "%v", err)
+}
+
+// Saída do ffmpeg indicando entrada inválida (e não falha do ambiente)
+func isInvalidMediaOutput(output string) bool {
+	for _, marker := range []string{
+		"Invalid data found when processing input",
+		"moov atom not found",
+		"does not contain any stream",
+		"Output file #0 does not contain any stream",
+	} {
+		if strings.Contains(output, marker) {
+			return true
+		}
+	}
+	return false
+}
+
+// Saída do ffmpeg indicando disco cheio durante a escrita
+func isNoSpaceOutput(output string) bool {
+	return strings.Contains(output, "No space left on device")
+}
+
+// Preencher os campos de erro do resultado
+func (r *ProcessingResult) fail(err *ProcessingError) {
+	r.Status = "error"
+	r.Error = err.Message
+	r.ErrorCode = string(err.Code)
+	r.ErrorDetail = err.Detail
+	r.Retryable = err.Retryable
+}
@@ -0,0 +1,186 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/streadway/amqp"
+)
+
+// Exchange topic com os eventos de ciclo de vida dos jobs; a routing key é
+// video.<job_type>.<evento>, ex.: video.frames.completed
+const eventsExchange = "video.events"
+
+// Eventos de ciclo de vida
+const (
+	EventUploaded  = "uploaded"
+	EventQueued    = "queued"
+	EventStarted   = "started"
+	EventProgress  = "progress"
+	EventCompleted = "completed"
+	EventFailed    = "failed"
+	EventCancelled = "cancelled"
+)
+
+// Evento publicado a cada transição do job. Sequence cresce a cada evento do
+// mesmo job (video_id + job_type) e permite descartar eventos fora de ordem
+type JobEvent struct {
+	Event       string            `json:"event"`
+	VideoID     string            `json:"video_id"`
+	JobType     string            `json:"job_type"`
+	UserID      string            `json:"user_id"`
+	Sequence    int64             `json:"sequence"`
+	Timestamp   time.Time         `json:"timestamp"`
+	Filename    string            `json:"filename,omitempty"`
+	Object      string            `json:"object_name,omitempty"`  // original em video-uploads
+	ContentHash string            `json:"content_hash,omitempty"` // SHA-256 do original
+	Size        int64             `json:"size,omitempty"`         // bytes do original
+	Duration    float64           `json:"duration,omitempty"`     // segundos
+	BatchID     string            `json:"batch_id,omitempty"`
+	BatchSize   int               `json:"batch_size,omitempty"`
+	Attempt     int               `json:"attempt,omitempty"`
+	Stage       string            `json:"stage,omitempty"`
+	Progress    int               `json:"progress,omitempty"` // 0 a 100
+	UserEmail   string            `json:"user_email,omitempty"`
+	UserName    string            `json:"user_name,omitempty"`
+	Result      *ProcessingResult `json:"result,omitempty"` // eventos finais
+}
+
+func eventRoutingKey(jobType, event string) string {
+	return fmt.Sprintf("video.%s.%s", jobType, event)
+}
+
+// Emissor de eventos de um job, continuando a sequência recebida na mensagem
+type jobEvents struct {
+	publisher Publisher
+	users     UserDirectory
+	msg       ProcessingMessage
+	jobType   string
+	attempt   int
+	sequence  int64
+}
+
+func (ps *ProcessingService) newJobEvents(msg ProcessingMessage, attempt int) *jobEvents {
+	jobType := msg.JobType
+	if jobType == "" {
+		jobType = JobTypeFrames
+	}
+	return &jobEvents{
+		publisher: ps.Publisher,
+		users:     ps.Users,
+		msg:       msg,
+		jobType:   jobType,
+		attempt:   attempt,
+		sequence:  msg.Sequence,
+	}
+}
+
+func (e *jobEvents) publish(event *JobEvent) error {
+	if e == nil {
+		return nil
+	}
+
+	e.sequence++
+	event.VideoID = e.msg.VideoID
+	event.JobType = e.jobType
+	event.UserID = e.msg.UserID
+	event.Sequence = e.sequence
+	event.Timestamp = time.Now()
+	event.Filename = e.msg.Filename
+	event.Object = e.msg.ObjectName
+	event.ContentHash = e.msg.ContentHash
+	event.Size = e.msg.Size
+	event.Duration = e.msg.Duration
+	event.BatchID = e.msg.BatchID
+	event.BatchSize = e.msg.BatchSize
+	event.Attempt = e.attempt
+
+	return publishJobEvent(e.publisher, *event)
+}
+
+func publishJobEvent(publisher Publisher, event JobEvent) error {
+	body, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("erro ao serializar evento: %v", err)
+	}
+
+	return publisher.Publish(
+		eventsExchange, // exchange
+		eventRoutingKey(event.JobType, event.Event), // routing key
+		false, // mandatory
+		false, // immediate
+		amqp.Publishing{
+			ContentType:  "application/json",
+			DeliveryMode: amqp.Persistent,
+			Timestamp:    event.Timestamp,
+			Body:         body,
+		})
+}
+
+// Eventos intermediários não interrompem o job se a publicação falhar
+func (e *jobEvents) emit(event string) {
+	if err := e.publish(&JobEvent{Event: event}); err != nil {
+		log.Printf("Erro ao publicar evento %s do vídeo %s: %v", event, e.msg.VideoID, err)
+	}
+}
+
+func (e *jobEvents) progress(stage string, done, total int) {
+	if e == nil || total == 0 {
+		return
+	}
+	err := e.publish(&JobEvent{Event: EventProgress, Stage: stage, Progress: done * 100 / total})
+	if err != nil {
+		log.Printf("Erro ao publicar progresso do vídeo %s: %v", e.msg.VideoID, err)
+	}
+}
+
+// Evento final (completed, failed ou cancelled) com o resultado do job. Se o
+// dono do vídeo não puder ser consultado, o evento sai sem e-mail (o storage
+// é atualizado normalmente) e a notificação é adiada. Vídeos de um lote não
+// geram e-mail: o finalizador do lote envia uma notificação única
+func (e *jobEvents) finish(ctx context.Context, result ProcessingResult) error {
+	event := JobEvent{Event: EventCompleted, Result: &result}
+	switch {
+	case result.Status != "error":
+	case result.ErrorCode == string(ErrCancelled):
+		event.Event = EventCancelled
+	default:
+		event.Event = EventFailed
+	}
+
+	event.UserID = e.msg.UserID
+	notify := e.jobType == JobTypeBatch || (e.jobType == JobTypeFrames && e.msg.BatchID == "")
+	var lookupErr error
+	if notify {
+		lookupErr = resolveEventUser(ctx, e.users, &event)
+	}
+
+	if err := e.publish(&event); err != nil {
+		return err
+	}
+	if !notify || lookupErr == nil {
+		return nil
+	}
+	if errors.Is(lookupErr, errUserNotFound) {
+		log.Printf("Notificação do vídeo %s não enviada: %v", e.msg.VideoID, lookupErr)
+		return nil
+	}
+
+	log.Printf("Notificação do vídeo %s adiada: %v", e.msg.VideoID, lookupErr)
+	event.UserEmail, event.UserName = "", ""
+	if err := deferNotification(e.publisher, event, 1); err != nil {
+		log.Printf("Erro ao adiar notificação do vídeo %s: %v", e.msg.VideoID, err)
+	}
+	return nil
+}
+
+// Mensagem do job a reenfileirar, com a sequência já emitida até aqui
+func (e *jobEvents) requeuedMessage() ([]byte, error) {
+	msg := e.msg
+	msg.Sequence = e.sequence
+	return json.Marshal(msg)
+}
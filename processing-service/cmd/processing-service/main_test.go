@@ -0,0 +1,1236 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/minio/minio-go/v7"
+	"github.com/streadway/amqp"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// ObjectStore em memória, indexado por "bucket/objeto"
+type memoryStore struct {
+	objects map[string][]byte
+	getErr  error
+	putErr  error
+}
+
+func newMemoryStore() *memoryStore {
+	return &memoryStore{objects: make(map[string][]byte)}
+}
+
+func (m *memoryStore) FGetObject(ctx context.Context, bucketName, objectName, filePath string, opts minio.GetObjectOptions) error {
+	if m.getErr != nil {
+		return m.getErr
+	}
+	data, ok := m.objects[bucketName+"/"+objectName]
+	if !ok {
+		return fmt.Errorf("objeto %s/%s não existe", bucketName, objectName)
+	}
+	return os.WriteFile(filePath, data, 0644)
+}
+
+func (m *memoryStore) FPutObject(ctx context.Context, bucketName, objectName, filePath string, opts minio.PutObjectOptions) (minio.UploadInfo, error) {
+	if m.putErr != nil {
+		return minio.UploadInfo{}, m.putErr
+	}
+	data, err := os.ReadFile(filePath)
+	if err != nil {
+		return minio.UploadInfo{}, err
+	}
+	m.objects[bucketName+"/"+objectName] = data
+	return minio.UploadInfo{Bucket: bucketName, Key: objectName, Size: int64(len(data))}, nil
+}
+
+func (m *memoryStore) CopyObject(ctx context.Context, dst minio.CopyDestOptions, src minio.CopySrcOptions) (minio.UploadInfo, error) {
+	data, ok := m.objects[src.Bucket+"/"+src.Object]
+	if !ok {
+		return minio.UploadInfo{}, fmt.Errorf("objeto %s/%s não existe", src.Bucket, src.Object)
+	}
+	m.objects[dst.Bucket+"/"+dst.Object] = data
+	return minio.UploadInfo{Bucket: dst.Bucket, Key: dst.Object, Size: int64(len(data))}, nil
+}
+
+// Índice de resultados em memória
+type memoryResults map[string]ProcessingResult
+
+func (m memoryResults) Lookup(ctx context.Context, key string) (*ProcessingResult, error) {
+	result, ok := m[key]
+	if !ok {
+		return nil, nil
+	}
+	return &result, nil
+}
+
+func (m memoryResults) Store(ctx context.Context, key string, result ProcessingResult) error {
+	m[key] = result
+	return nil
+}
+
+type recordingPublisher struct {
+	keys     []string
+	messages []amqp.Publishing
+}
+
+func (p *recordingPublisher) Publish(exchange, key string, mandatory, immediate bool, msg amqp.Publishing) error {
+	p.keys = append(p.keys, key)
+	p.messages = append(p.messages, msg)
+	return nil
+}
+
+func (p *recordingPublisher) event(t *testing.T, i int) JobEvent {
+	t.Helper()
+	var event JobEvent
+	require.NoError(t, json.Unmarshal(p.messages[i].Body, &event))
+	return event
+}
+
+// Extrator que gera um "frame" ilegível (diretório) para quebrar o ZIP
+type unreadableFrameExtractor struct{}
+
+func (unreadableFrameExtractor) ExtractFrames(ctx context.Context, videoPath, framesDir string, fps float64, overlay *overlaySpec, probe *ProbeOutput) (int, error) {
+	if err := os.Mkdir(filepath.Join(framesDir, "frame_0001.png"), 0755); err != nil {
+		return 0, err
+	}
+	return countFrames(framesDir)
+}
+
+func (unreadableFrameExtractor) TransformFrames(ctx context.Context, framesDir string, fps float64, inputs []string, filterComplex string) error {
+	return nil
+}
+
+func zipEntries(t *testing.T, data []byte) []string {
+	t.Helper()
+	reader, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	require.NoError(t, err)
+
+	var names []string
+	for _, file := range reader.File {
+		names = append(names, file.Name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func TestProcessVideo(t *testing.T) {
+	tests := []struct {
+		name      string
+		setup     func(store *memoryStore, media *FakeMedia, ps *ProcessingService, msg *ProcessingMessage)
+		ctx       func() (context.Context, context.CancelFunc)
+		wantCode  ErrorCode
+		wantRetry bool
+		frames    int
+		entries   []string
+	}{
+		{
+			name:    "sucesso com pipeline padrão",
+			frames:  5,
+			entries: []string{"frame_0001.png", "frame_0002.png", "frame_0003.png", "frame_0004.png", "frame_0005.png"},
+		},
+		{
+			name: "capítulos exportados no ZIP",
+			setup: func(store *memoryStore, media *FakeMedia, ps *ProcessingService, msg *ProcessingMessage) {
+				media.Duration = 2
+				media.Chapters = []ProbeChapter{{ID: 1, StartTime: "0.000000", EndTime: "2.000000", Tags: map[string]string{"title": "Intro"}}}
+			},
+			frames:  2,
+			entries: []string{"chapters.json", "frame_0001.png", "frame_0002.png"},
+		},
+		{
+			name: "legendas de texto exportadas em SRT e WebVTT",
+			setup: func(store *memoryStore, media *FakeMedia, ps *ProcessingService, msg *ProcessingMessage) {
+				media.Duration = 1
+				media.Subtitle = true
+				media.Subtitles = []string{"por", "eng"}
+			},
+			frames:  1,
+			entries: []string{"frame_0001.png", "subtitles/eng.srt", "subtitles/eng.vtt", "subtitles/por.srt", "subtitles/por.vtt"},
+		},
+		{
+			name: "legenda com falha é ignorada sem perder as demais",
+			setup: func(store *memoryStore, media *FakeMedia, ps *ProcessingService, msg *ProcessingMessage) {
+				media.Duration = 1
+				media.Subtitles = []string{"por", "eng", "spa"}
+				media.SubtitleErrs = map[int]error{3: errors.New("stream corrompida")}
+			},
+			frames:  1,
+			entries: []string{"frame_0001.png", "subtitles/por.srt", "subtitles/por.vtt", "subtitles/spa.srt", "subtitles/spa.vtt"},
+		},
+		{
+			name: "falha no probe não interrompe o job",
+			setup: func(store *memoryStore, media *FakeMedia, ps *ProcessingService, msg *ProcessingMessage) {
+				media.ProbeErr = errors.New("ffprobe indisponível")
+				media.Duration = 1
+			},
+			frames:  1,
+			entries: []string{"frame_0001.png"},
+		},
+		{
+			name: "overlay de texto",
+			setup: func(store *memoryStore, media *FakeMedia, ps *ProcessingService, msg *ProcessingMessage) {
+				media.Duration = 1
+				msg.Overlay = &OverlayOptions{Type: "text", Text: "{video_id} {timestamp}"}
+			},
+			frames:  1,
+			entries: []string{"frame_0001.png"},
+		},
+		{
+			name: "overlay do job sem dimensões do probe",
+			setup: func(store *memoryStore, media *FakeMedia, ps *ProcessingService, msg *ProcessingMessage) {
+				media.Duration = 1
+				media.ProbeErr = errors.New("ffprobe indisponível")
+				msg.Overlay = &OverlayOptions{Type: "text", Text: "{video_id}"}
+			},
+			wantCode: ErrInvalidMedia,
+		},
+		{
+			name: "reprocessamento gera objeto versionado",
+			setup: func(store *memoryStore, media *FakeMedia, ps *ProcessingService, msg *ProcessingMessage) {
+				media.Duration = 1
+				msg.Version = 2
+			},
+			frames:  1,
+			entries: []string{"frame_0001.png"},
+		},
+		{
+			name: "erro ao baixar vídeo",
+			setup: func(store *memoryStore, media *FakeMedia, ps *ProcessingService, msg *ProcessingMessage) {
+				store.getErr = errors.New("minio indisponível")
+			},
+			wantCode:  ErrDownloadFailed,
+			wantRetry: true,
+		},
+		{
+			name: "pipeline inválido",
+			setup: func(store *memoryStore, media *FakeMedia, ps *ProcessingService, msg *ProcessingMessage) {
+				msg.Pipeline = &Pipeline{Stages: []PipelineStage{{Type: "extract"}, {Type: "explode"}, {Type: "upload"}}}
+			},
+			wantCode: ErrInvalidJob,
+		},
+		{
+			name: "marca d'água ausente",
+			setup: func(store *memoryStore, media *FakeMedia, ps *ProcessingService, msg *ProcessingMessage) {
+				msg.Overlay = &OverlayOptions{Type: "image"}
+			},
+			wantCode: ErrInvalidJob,
+		},
+		{
+			name: "erro na extração",
+			setup: func(store *memoryStore, media *FakeMedia, ps *ProcessingService, msg *ProcessingMessage) {
+				media.ExtractErr = errors.New("codec não suportado")
+			},
+			wantCode: ErrExtractionFailed,
+		},
+		{
+			name: "nenhum frame extraído",
+			setup: func(store *memoryStore, media *FakeMedia, ps *ProcessingService, msg *ProcessingMessage) {
+				media.Duration = 0
+			},
+			wantCode: ErrNoFrames,
+		},
+		{
+			name: "erro ao criar ZIP",
+			setup: func(store *memoryStore, media *FakeMedia, ps *ProcessingService, msg *ProcessingMessage) {
+				ps.Extractor = unreadableFrameExtractor{}
+			},
+			wantCode:  ErrArchiveFailed,
+			wantRetry: true,
+		},
+		{
+			name: "mídia inválida",
+			setup: func(store *memoryStore, media *FakeMedia, ps *ProcessingService, msg *ProcessingMessage) {
+				media.ExtractErr = newProcessingError(ErrInvalidMedia, "Invalid data found when processing input")
+			},
+			wantCode: ErrInvalidMedia,
+		},
+		{
+			name: "tempo limite excedido",
+			ctx: func() (context.Context, context.CancelFunc) {
+				return context.WithDeadline(context.Background(), time.Now().Add(-time.Second))
+			},
+			wantCode:  ErrTimeout,
+			wantRetry: true,
+		},
+		{
+			name: "job cancelado",
+			ctx: func() (context.Context, context.CancelFunc) {
+				ctx, cancel := context.WithCancel(context.Background())
+				cancel()
+				return ctx, cancel
+			},
+			wantCode: ErrCancelled,
+		},
+		{
+			name: "erro no upload do ZIP",
+			setup: func(store *memoryStore, media *FakeMedia, ps *ProcessingService, msg *ProcessingMessage) {
+				store.putErr = errors.New("bucket cheio")
+			},
+			wantCode:  ErrUploadFailed,
+			wantRetry: true,
+		},
+	}
+
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := newMemoryStore()
+			media := NewFakeMedia()
+			publisher := &recordingPublisher{}
+			ps := &ProcessingService{
+				Objects:   store,
+				Publisher: publisher,
+				Prober:    media,
+				Extractor: media,
+			}
+
+			msg := ProcessingMessage{
+				VideoID:    fmt.Sprintf("test-%d", i),
+				Filename:   "video.mp4",
+				Bucket:     "video-uploads",
+				ObjectName: "1/video.mp4",
+				UserID:     "1",
+			}
+			store.objects["video-uploads/1/video.mp4"] = []byte("conteúdo do vídeo")
+
+			if tt.setup != nil {
+				tt.setup(store, media, ps, &msg)
+			}
+
+			ctx, cancel := context.WithCancel(context.Background())
+			if tt.ctx != nil {
+				ctx, cancel = tt.ctx()
+			}
+			defer cancel()
+
+			result := ps.processVideo(ctx, msg, ps.newJobEvents(msg, 1))
+
+			assert.Equal(t, msg.VideoID, result.VideoID)
+			assert.Equal(t, JobTypeFrames, result.JobType)
+
+			if tt.wantCode != "" {
+				assert.Equal(t, "error", result.Status)
+				assert.Equal(t, string(tt.wantCode), result.ErrorCode)
+				assert.Equal(t, errorCatalog[tt.wantCode].Message, result.Error)
+				assert.NotEmpty(t, result.ErrorDetail)
+				assert.Equal(t, tt.wantRetry, result.Retryable)
+				assert.Empty(t, result.ZipObjectName)
+				assert.NotContains(t, store.objects, "video-processed/frames_"+msg.VideoID+".zip")
+				for _, key := range publisher.keys {
+					assert.Equal(t, "video.frames.progress", key)
+				}
+				return
+			}
+
+			require.Equal(t, "completed", result.Status, result.Error)
+			assert.Equal(t, tt.frames, result.FrameCount)
+			assert.Equal(t, msg.Version, result.Version)
+			if msg.Version > 1 {
+				assert.Equal(t, fmt.Sprintf("frames_%s_v%d.zip", msg.VideoID, msg.Version), result.ZipObjectName)
+			} else {
+				assert.Equal(t, "frames_"+msg.VideoID+".zip", result.ZipObjectName)
+			}
+
+			data, ok := store.objects["video-processed/"+result.ZipObjectName]
+			require.True(t, ok, "ZIP não enviado")
+			assert.Equal(t, int64(len(data)), result.ZipSize)
+			assert.Equal(t, tt.entries, zipEntries(t, data))
+			assert.Equal(t, []string{"probe", "extract", "archive", "upload"}, result.Metadata["pipeline"])
+
+			// Um evento de progresso por etapa, com sequência crescente
+			require.Len(t, publisher.messages, 4)
+			for i := range publisher.messages {
+				event := publisher.event(t, i)
+				assert.Equal(t, "video.frames.progress", publisher.keys[i])
+				assert.Equal(t, int64(i+1), event.Sequence)
+				assert.Equal(t, (i+1)*100/4, event.Progress)
+			}
+
+			_, err := os.Stat(filepath.Join("/tmp", "video_processing_"+msg.VideoID))
+			assert.True(t, os.IsNotExist(err), "diretório temporário não removido")
+		})
+	}
+}
+
+func TestPostProcessingStagesUnderFakeMedia(t *testing.T) {
+	store := newMemoryStore()
+	media := NewFakeMedia()
+	media.Duration = 2
+	ps := &ProcessingService{Objects: store, Publisher: &recordingPublisher{}, Prober: media, Extractor: media}
+	store.objects["video-uploads/1/video.mp4"] = []byte("conteúdo do vídeo")
+	store.objects[userAssetsBucket+"/"+watermarkObjectName("1")] = []byte("png")
+
+	msg := ProcessingMessage{
+		VideoID: "post", Filename: "video.mp4", Bucket: "video-uploads", ObjectName: "1/video.mp4", UserID: "1",
+		Pipeline: &Pipeline{Stages: []PipelineStage{
+			{Type: "probe"},
+			{Type: "extract"},
+			{Type: "filter", Params: map[string]interface{}{"name": "grayscale"}},
+			{Type: "resize", Params: map[string]interface{}{"width": 32.0}},
+			{Type: "overlay", Params: map[string]interface{}{"type": "image"}},
+			{Type: "archive"},
+			{Type: "upload"},
+		}},
+	}
+
+	result := ps.processVideo(context.Background(), msg, ps.newJobEvents(msg, 1))
+	require.Equal(t, "completed", result.Status, result.ErrorDetail)
+	assert.Equal(t, 2, result.FrameCount)
+	require.Len(t, media.Transforms, 3)
+	assert.Equal(t, "[0:v]format=gray[out]", media.Transforms[0])
+	assert.Equal(t, "[0:v]scale=32:-2[out]", media.Transforms[1])
+	assert.Contains(t, media.Transforms[2], "overlay=")
+
+	media.TransformErr = errors.New("filtro falhou")
+	msg.VideoID = "post-erro"
+	result = ps.processVideo(context.Background(), msg, ps.newJobEvents(msg, 1))
+	assert.Equal(t, string(ErrExtractionFailed), result.ErrorCode)
+	assert.Contains(t, result.ErrorDetail, "etapa filter")
+}
+
+// Pipeline sem probe: a marca d'água usa as dimensões do primeiro frame
+func TestJobOverlayWithoutProbeStage(t *testing.T) {
+	store := newMemoryStore()
+	media := NewFakeMedia()
+	media.Duration = 2
+	ps := &ProcessingService{Objects: store, Publisher: &recordingPublisher{}, Prober: media, Extractor: media}
+	store.objects["video-uploads/1/video.mp4"] = []byte("conteúdo do vídeo")
+	store.objects[userAssetsBucket+"/"+watermarkObjectName("1")] = []byte("png")
+
+	msg := ProcessingMessage{
+		VideoID: "sem-probe", Filename: "video.mp4", Bucket: "video-uploads", ObjectName: "1/video.mp4", UserID: "1",
+		Overlay:  &OverlayOptions{Type: "image"},
+		Pipeline: &Pipeline{Stages: []PipelineStage{{Type: "extract"}, {Type: "archive"}, {Type: "upload"}}},
+	}
+	require.NoError(t, msg.Pipeline.Validate())
+
+	result := ps.processVideo(context.Background(), msg, ps.newJobEvents(msg, 1))
+	require.Equal(t, "completed", result.Status, result.ErrorDetail)
+	assert.Equal(t, 2, result.FrameCount)
+	require.Len(t, media.Transforms, 1)
+	assert.Contains(t, media.Transforms[0], fmt.Sprintf("scale=%d:-1", int(float64(media.Width)*0.15)))
+}
+
+func TestProbeFailureWithDependentStages(t *testing.T) {
+	tests := []struct {
+		name     string
+		msg      func(msg *ProcessingMessage)
+		wantCode ErrorCode
+	}{
+		{"sem dependentes o job segue", func(msg *ProcessingMessage) { msg.Duration = 1 }, ""},
+		{"overlay do job na extração", func(msg *ProcessingMessage) {
+			msg.Overlay = &OverlayOptions{Type: "text", Text: "x"}
+		}, ErrInvalidMedia},
+		{"overlay em etapa própria não depende do probe", func(msg *ProcessingMessage) {
+			msg.Overlay = &OverlayOptions{Type: "text", Text: "x"}
+			msg.Pipeline = &Pipeline{Stages: []PipelineStage{{Type: "probe"}, {Type: "extract"}, {Type: "overlay"}, {Type: "archive"}, {Type: "upload"}}}
+		}, ""},
+		{"cenas sem duração do upload", func(msg *ProcessingMessage) {
+			msg.Pipeline = &Pipeline{Stages: []PipelineStage{{Type: "probe"}, {Type: "extract"}, {Type: "scenes"}, {Type: "archive"}, {Type: "upload"}}}
+		}, ErrInvalidMedia},
+		{"cenas com duração do upload", func(msg *ProcessingMessage) {
+			msg.Duration = 1
+			msg.Pipeline = &Pipeline{Stages: []PipelineStage{{Type: "probe"}, {Type: "extract"}, {Type: "scenes"}, {Type: "archive"}, {Type: "upload"}}}
+		}, ""},
+	}
+
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := newMemoryStore()
+			media := NewFakeMedia()
+			media.Duration = 1
+			media.ProbeErr = errors.New("ffprobe falhou")
+			ps := &ProcessingService{Objects: store, Publisher: &recordingPublisher{}, Prober: media, Extractor: media, Scenes: media}
+			store.objects["video-uploads/1/video.mp4"] = []byte("conteúdo do vídeo")
+
+			msg := ProcessingMessage{
+				VideoID: fmt.Sprintf("probe-%d", i), Filename: "video.mp4", Bucket: "video-uploads", ObjectName: "1/video.mp4", UserID: "1",
+			}
+			tt.msg(&msg)
+
+			result := ps.processVideo(context.Background(), msg, ps.newJobEvents(msg, 1))
+			if tt.wantCode == "" {
+				assert.Equal(t, "completed", result.Status, result.ErrorDetail)
+				return
+			}
+			assert.Equal(t, string(tt.wantCode), result.ErrorCode)
+			assert.False(t, result.Retryable)
+			assert.Contains(t, result.ErrorDetail, "etapa probe")
+		})
+	}
+}
+
+func TestSelectRenditions(t *testing.T) {
+	t.Setenv("DEFAULT_RENDITIONS", "360p,720p,1080p")
+
+	tests := []struct {
+		name         string
+		requested    []string
+		sourceHeight int
+		want         []string
+	}{
+		{"padrão com origem 1080p", nil, 1080, []string{"360p", "720p", "1080p"}},
+		{"padrão sem ampliar origem 720p", nil, 720, []string{"360p", "720p"}},
+		{"pedido filtrado pela altura de origem", []string{"720p", "1080p"}, 900, []string{"720p"}},
+		{"origem menor que todas gera a menor pedida", []string{"1080p", "720p"}, 240, []string{"720p"}},
+		{"altura de origem desconhecida", []string{"1080p"}, 0, []string{"1080p"}},
+		{"nomes com espaços", []string{" 360p "}, 480, []string{"360p"}},
+		{"rendição desconhecida", []string{"4k"}, 2160, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var names []string
+			for _, profile := range selectRenditions(tt.requested, tt.sourceHeight) {
+				names = append(names, profile.Name)
+			}
+			assert.Equal(t, tt.want, names)
+		})
+	}
+}
+
+func TestWriteMasterPlaylist(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "master.m3u8")
+	require.NoError(t, writeMasterPlaylist(path, []Rendition{
+		{Name: "360p", Width: 640, Height: 360, BandwidthBitsPS: 896000},
+		{Name: "720p", Height: 720, BandwidthBitsPS: 2928000},
+	}))
+
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	assert.Equal(t, "#EXTM3U\n#EXT-X-VERSION:3\n"+
+		"#EXT-X-STREAM-INF:BANDWIDTH=896000,RESOLUTION=640x360\n360p/index.m3u8\n"+
+		"#EXT-X-STREAM-INF:BANDWIDTH=2928000\n720p/index.m3u8\n", string(data))
+}
+
+func TestTranscodeVideo(t *testing.T) {
+	tests := []struct {
+		name       string
+		renditions []string
+		setup      func(store *memoryStore, media *FakeMedia)
+		ctx        func() (context.Context, context.CancelFunc)
+		wantCode   ErrorCode
+		wantRetry  bool
+		want       []string
+	}{
+		{name: "rendições pedidas", renditions: []string{"360p", "720p"}, want: []string{"360p", "720p"}},
+		{name: "sem ampliar a origem", renditions: []string{"720p", "1080p"}, want: []string{"720p"}},
+		{
+			name:       "vídeo ilegível",
+			renditions: []string{"360p"},
+			setup:      func(store *memoryStore, media *FakeMedia) { media.ProbeErr = errors.New("moov atom not found") },
+			wantCode:   ErrInvalidMedia,
+		},
+		{name: "nenhuma rendição válida", renditions: []string{"4k"}, wantCode: ErrInvalidJob},
+		{
+			name:       "erro na codificação",
+			renditions: []string{"360p"},
+			setup:      func(store *memoryStore, media *FakeMedia) { media.EncodeErr = errors.New("libx264 falhou") },
+			wantCode:   ErrTranscodeFailed,
+		},
+		{
+			name:       "erro no upload",
+			renditions: []string{"360p"},
+			setup:      func(store *memoryStore, media *FakeMedia) { store.putErr = errors.New("bucket cheio") },
+			wantCode:   ErrUploadFailed,
+			wantRetry:  true,
+		},
+		{
+			name:       "job cancelado",
+			renditions: []string{"360p"},
+			ctx: func() (context.Context, context.CancelFunc) {
+				ctx, cancel := context.WithCancel(context.Background())
+				cancel()
+				return ctx, cancel
+			},
+			wantCode: ErrCancelled,
+		},
+	}
+
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := newMemoryStore()
+			media := NewFakeMedia()
+			media.Width, media.Height = 1280, 720
+			ps := &ProcessingService{Objects: store, Publisher: &recordingPublisher{}, Prober: media, Transcoder: media}
+			store.objects["video-uploads/1/video.mp4"] = []byte("conteúdo do vídeo")
+			if tt.setup != nil {
+				tt.setup(store, media)
+			}
+
+			msg := ProcessingMessage{
+				VideoID: fmt.Sprintf("transcode-%d", i), Filename: "video.mp4", Bucket: "video-uploads", ObjectName: "1/video.mp4",
+				UserID: "1", JobType: JobTypeTranscode, Renditions: tt.renditions,
+			}
+			ctx, cancel := context.WithCancel(context.Background())
+			if tt.ctx != nil {
+				ctx, cancel = tt.ctx()
+			}
+			defer cancel()
+
+			result := ps.transcodeVideo(ctx, msg, ps.newJobEvents(msg, 1))
+			assert.Equal(t, JobTypeTranscode, result.JobType)
+
+			if tt.wantCode != "" {
+				assert.Equal(t, "error", result.Status)
+				assert.Equal(t, string(tt.wantCode), result.ErrorCode)
+				assert.Equal(t, tt.wantRetry, result.Retryable)
+				assert.NotContains(t, store.objects, "video-processed/"+hlsPrefix(msg.VideoID)+"master.m3u8")
+				return
+			}
+
+			require.Equal(t, "completed", result.Status, result.ErrorDetail)
+			assert.Equal(t, tt.want, result.Metadata["renditions"])
+			assert.Equal(t, hlsPrefix(msg.VideoID)+"master.m3u8", result.Metadata["hls_master"])
+
+			master := string(store.objects["video-processed/"+hlsPrefix(msg.VideoID)+"master.m3u8"])
+			resolutions := map[string]string{"360p": "640x360", "720p": "1280x720"}
+			for _, name := range tt.want {
+				assert.Contains(t, store.objects, "video-processed/"+renditionObjectName(msg.VideoID, name))
+				assert.Contains(t, store.objects, "video-processed/"+hlsPrefix(msg.VideoID)+name+"/index.m3u8")
+				assert.Contains(t, store.objects, "video-processed/"+hlsPrefix(msg.VideoID)+name+"/segment_0000.ts")
+				assert.Contains(t, master, "RESOLUTION="+resolutions[name]+"\n"+name+"/index.m3u8")
+			}
+		})
+	}
+}
+
+func TestFakeMediaIsDeterministic(t *testing.T) {
+	media := NewFakeMedia()
+	video := filepath.Join(t.TempDir(), "video.mp4")
+	require.NoError(t, os.WriteFile(video, []byte("x"), 0644))
+
+	dirA, dirB := t.TempDir(), t.TempDir()
+	countA, err := media.ExtractFrames(context.Background(), video, dirA, 2, nil, nil)
+	require.NoError(t, err)
+	countB, err := media.ExtractFrames(context.Background(), video, dirB, 2, nil, nil)
+	require.NoError(t, err)
+
+	assert.Equal(t, 10, countA)
+	assert.Equal(t, countA, countB)
+	for i := 1; i <= countA; i++ {
+		name := fmt.Sprintf("frame_%04d.png", i)
+		a, err := os.ReadFile(filepath.Join(dirA, name))
+		require.NoError(t, err)
+		b, err := os.ReadFile(filepath.Join(dirB, name))
+		require.NoError(t, err)
+		assert.Equal(t, a, b, name)
+	}
+
+	width, height, err := imageDimensions(filepath.Join(dirA, "frame_0001.png"))
+	require.NoError(t, err)
+	assert.Equal(t, media.Width, width)
+	assert.Equal(t, media.Height, height)
+}
+
+// ObjectStore que respeita o contexto como o cliente MinIO
+type contextStore struct {
+	*memoryStore
+}
+
+func (s contextStore) FGetObject(ctx context.Context, bucketName, objectName, filePath string, opts minio.GetObjectOptions) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return s.memoryStore.FGetObject(ctx, bucketName, objectName, filePath, opts)
+}
+
+func TestPrepareOverlayUsesJobContext(t *testing.T) {
+	store := newMemoryStore()
+	store.objects[userAssetsBucket+"/"+watermarkObjectName("1")] = []byte("png")
+	ps := &ProcessingService{Objects: contextStore{store}}
+	overlay := &OverlayOptions{Type: "image"}
+
+	spec, err := ps.prepareOverlay(context.Background(), overlay, "v1", "1", t.TempDir())
+	require.NoError(t, err)
+	assert.FileExists(t, spec.WatermarkPath)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err = ps.prepareOverlay(ctx, overlay, "v1", "1", t.TempDir())
+	assert.ErrorContains(t, err, context.Canceled.Error())
+}
+
+func TestScheduleRetry(t *testing.T) {
+	t.Setenv("RETRY_BACKOFF", "10s")
+	publisher := &recordingPublisher{}
+	ps := &ProcessingService{Publisher: publisher}
+
+	require.NoError(t, ps.scheduleRetry([]byte(`{"video_id":"v1"}`), 2))
+	require.Len(t, publisher.messages, 1)
+
+	// Cada passo do backoff tem sua fila, com TTL da fila
+	assert.Equal(t, []string{"video_processing_retry.20000"}, publisher.keys)
+	msg := publisher.messages[0]
+	assert.Empty(t, msg.Expiration)
+	assert.Equal(t, int32(3), msg.Headers[attemptHeader])
+	assert.Equal(t, 3, deliveryAttempt(amqp.Delivery{Headers: msg.Headers}))
+	assert.Equal(t, 1, deliveryAttempt(amqp.Delivery{}))
+}
+
+// UserDirectory fixo para os testes
+type staticUsers struct {
+	users map[string]UserInfo
+	err   error
+	calls int
+}
+
+func (s *staticUsers) LookupUser(ctx context.Context, userID string) (*UserInfo, error) {
+	s.calls++
+	if s.err != nil {
+		return nil, s.err
+	}
+	user, ok := s.users[userID]
+	if !ok {
+		return nil, errUserNotFound
+	}
+	return &user, nil
+}
+
+func TestJobEventsSequence(t *testing.T) {
+	publisher := &recordingPublisher{}
+	users := &staticUsers{users: map[string]UserInfo{"7": {ID: 7, Username: "ana", Email: "ana@example.com"}}}
+	ps := &ProcessingService{Publisher: publisher, Users: users}
+
+	// Upload já publicou uploaded (1) e queued (2)
+	msg := ProcessingMessage{VideoID: "v1", UserID: "7", Filename: "a.mp4", Sequence: 2}
+	events := ps.newJobEvents(msg, 1)
+
+	events.emit(EventStarted)
+	events.progress("extract", 1, 2)
+	require.NoError(t, events.finish(ctx, ProcessingResult{VideoID: "v1", Status: "error", ErrorCode: string(ErrCancelled)}))
+
+	assert.Equal(t, []string{"video.frames.started", "video.frames.progress", "video.frames.cancelled"}, publisher.keys)
+	for i, want := range []int64{3, 4, 5} {
+		event := publisher.event(t, i)
+		assert.Equal(t, want, event.Sequence)
+		assert.Equal(t, "v1", event.VideoID)
+		assert.Equal(t, "frames", event.JobType)
+	}
+	final := publisher.event(t, 2)
+	require.NotNil(t, final.Result)
+	assert.Equal(t, "CANCELLED", final.Result.ErrorCode)
+	assert.Equal(t, "ana@example.com", final.UserEmail)
+	assert.Equal(t, "ana", final.UserName)
+
+	body, err := events.requeuedMessage()
+	require.NoError(t, err)
+	var requeued ProcessingMessage
+	require.NoError(t, json.Unmarshal(body, &requeued))
+	assert.Equal(t, int64(5), requeued.Sequence)
+
+	transcode := ps.newJobEvents(ProcessingMessage{VideoID: "v1", JobType: JobTypeTranscode}, 1)
+	require.NoError(t, transcode.finish(ctx, ProcessingResult{Status: "completed"}))
+	assert.Equal(t, "video.transcode.completed", publisher.keys[3])
+	assert.Equal(t, int64(1), publisher.event(t, 3).Sequence)
+}
+
+func TestFinishDefersNotification(t *testing.T) {
+	t.Setenv("RETRY_BACKOFF", "10s")
+	msg := ProcessingMessage{VideoID: "v1", UserID: "7", Filename: "a.mp4"}
+
+	tests := []struct {
+		name     string
+		lookup   error
+		jobType  string
+		batchID  string
+		wantKeys []string
+	}{
+		{"auth-service indisponível", errors.New("connection refused"), "", "", []string{"video.frames.completed", "video_notifications_deferred.10000"}},
+		{"usuário inexistente", errUserNotFound, "", "", []string{"video.frames.completed"}},
+		{"transcode não notifica", errors.New("connection refused"), JobTypeTranscode, "", []string{"video.transcode.completed"}},
+		{"vídeo de lote não notifica", errors.New("connection refused"), "", "b1", []string{"video.frames.completed"}},
+		{"finalizador de lote notifica", errors.New("connection refused"), JobTypeBatch, "b1", []string{"video.batch.completed", "video_notifications_deferred.10000"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			publisher := &recordingPublisher{}
+			ps := &ProcessingService{Publisher: publisher, Users: &staticUsers{err: tt.lookup}}
+			job := msg
+			job.JobType = tt.jobType
+			job.BatchID = tt.batchID
+
+			require.NoError(t, ps.newJobEvents(job, 1).finish(ctx, ProcessingResult{VideoID: "v1", Status: "completed"}))
+
+			assert.Equal(t, tt.wantKeys, publisher.keys)
+			assert.Empty(t, publisher.event(t, 0).UserEmail, "sem fallback para endereço padrão")
+			if len(publisher.keys) > 1 {
+				deferred := publisher.event(t, 1)
+				assert.Equal(t, int64(1), deferred.Sequence)
+				assert.Empty(t, publisher.messages[1].Expiration, "TTL da fila, não da mensagem")
+				assert.Equal(t, int32(2), publisher.messages[1].Headers[attemptHeader])
+			}
+		})
+	}
+}
+
+func TestRetryNotification(t *testing.T) {
+	t.Setenv("RETRY_BACKOFF", "10s")
+	t.Setenv("MAX_NOTIFICATION_ATTEMPTS", "3")
+	event := JobEvent{Event: EventCompleted, VideoID: "v1", JobType: JobTypeFrames, UserID: "7", Sequence: 4}
+
+	// Consulta volta a funcionar: evento republicado com a mesma sequência
+	publisher := &recordingPublisher{}
+	users := &staticUsers{users: map[string]UserInfo{"7": {ID: 7, Username: "ana", Email: "ana@example.com"}}}
+	ps := &ProcessingService{Publisher: publisher, Users: users}
+	require.NoError(t, ps.retryNotification(event, 2))
+	assert.Equal(t, []string{"video.frames.completed"}, publisher.keys)
+	assert.Equal(t, int64(4), publisher.event(t, 0).Sequence)
+	assert.Equal(t, "ana@example.com", publisher.event(t, 0).UserEmail)
+
+	// Ainda falhando: adiada de novo com backoff maior
+	publisher = &recordingPublisher{}
+	ps = &ProcessingService{Publisher: publisher, Users: &staticUsers{err: errors.New("timeout")}}
+	require.NoError(t, ps.retryNotification(event, 2))
+	assert.Equal(t, []string{"video_notifications_deferred.20000"}, publisher.keys)
+
+	// Tentativas esgotadas: descartada
+	publisher = &recordingPublisher{}
+	ps = &ProcessingService{Publisher: publisher, Users: &staticUsers{err: errors.New("timeout")}}
+	require.NoError(t, ps.retryNotification(event, 3))
+	assert.Empty(t, publisher.keys)
+}
+
+func TestAuthUserClient(t *testing.T) {
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		if r.Header.Get("X-Service-Token") != "s3cret" {
+			http.Error(w, "Token de serviço inválido", http.StatusUnauthorized)
+			return
+		}
+		switch r.URL.Path {
+		case "/internal/users/7":
+			json.NewEncoder(w).Encode(UserInfo{ID: 7, Username: "ana", Email: "ana@example.com"})
+		case "/internal/users/8":
+			time.Sleep(200 * time.Millisecond)
+		default:
+			http.Error(w, "Usuário não encontrado", http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	t.Setenv("AUTH_SERVICE_URL", server.URL)
+	t.Setenv("INTERNAL_SERVICE_TOKEN", "s3cret")
+	t.Setenv("USER_LOOKUP_TIMEOUT", "50ms")
+	client := newAuthUserClient()
+
+	for i := 0; i < 2; i++ {
+		user, err := client.LookupUser(ctx, "7")
+		require.NoError(t, err)
+		assert.Equal(t, "ana@example.com", user.Email)
+	}
+	assert.Equal(t, 1, requests, "segunda consulta vem do cache")
+
+	_, err := client.LookupUser(ctx, "9")
+	assert.ErrorIs(t, err, errUserNotFound)
+
+	_, err = client.LookupUser(ctx, "8")
+	require.Error(t, err)
+	assert.NotErrorIs(t, err, errUserNotFound)
+
+	client.token = "wrong"
+	client.cache = make(map[string]cachedUser)
+	_, err = client.LookupUser(ctx, "7")
+	require.Error(t, err)
+	assert.NotErrorIs(t, err, errUserNotFound)
+}
+
+func TestEstimateWorkSpace(t *testing.T) {
+	const mb = 1 << 20
+	fps2 := &Pipeline{Stages: []PipelineStage{
+		{Type: "probe"},
+		{Type: "extract", Params: map[string]interface{}{"fps": 2.0}},
+		{Type: "archive"},
+		{Type: "upload"},
+	}}
+
+	tests := []struct {
+		name string
+		msg  ProcessingMessage
+		want uint64
+	}{
+		{"frames a 1 fps", ProcessingMessage{Size: 10 * mb, Duration: 10}, 10*mb + 3*10*estimatedFrameBytes},
+		{"frames a 2 fps", ProcessingMessage{Size: 10 * mb, Duration: 10, Pipeline: fps2}, 10*mb + 3*20*estimatedFrameBytes},
+		{"duração desconhecida", ProcessingMessage{Size: 10 * mb}, 10 * mb},
+		{"transcode", ProcessingMessage{Size: 10 * mb, JobType: JobTypeTranscode, Renditions: []string{"360p", "720p"}}, 50 * mb},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, estimateWorkSpace(tt.msg))
+		})
+	}
+}
+
+func TestPrepareWorkDir(t *testing.T) {
+	const mb = 1 << 20
+	t.Setenv("PROCESSING_TEMP_DIR", t.TempDir())
+	t.Setenv("DISK_RESERVE_MB", "0")
+	originalUsage, originalInterval := diskUsage, diskPollInterval
+	defer func() { diskUsage, diskPollInterval = originalUsage, originalInterval }()
+	diskPollInterval = time.Millisecond
+
+	ps := &ProcessingService{}
+	msg := ProcessingMessage{VideoID: "v1", Size: 100 * mb}
+
+	// Maior que o disco inteiro: recusado sem nova tentativa
+	diskUsage = func(string) (uint64, uint64, error) { return 50 * mb, 50 * mb, nil }
+	_, err := ps.prepareWorkDir(ctx, msg, framesWorkPrefix)
+	var pErr *ProcessingError
+	require.ErrorAs(t, err, &pErr)
+	assert.Equal(t, ErrInsufficientSpace, pErr.Code)
+	assert.False(t, pErr.Retryable)
+
+	// Cabe no disco: aguarda até o espaço ser liberado
+	checks := 0
+	diskUsage = func(string) (uint64, uint64, error) {
+		checks++
+		if checks < 3 {
+			return 10 * mb, 500 * mb, nil
+		}
+		return 200 * mb, 500 * mb, nil
+	}
+	dir, err := ps.prepareWorkDir(ctx, msg, framesWorkPrefix)
+	require.NoError(t, err)
+	assert.Equal(t, 3, checks)
+	assert.Equal(t, framesWorkPrefix+"v1", filepath.Base(dir))
+	assert.DirExists(t, dir)
+
+	// Espaço não liberado antes do fim do job: falha transitória
+	diskUsage = func(string) (uint64, uint64, error) { return 10 * mb, 500 * mb, nil }
+	waitCtx, cancel := context.WithTimeout(ctx, 20*time.Millisecond)
+	defer cancel()
+	_, err = ps.prepareWorkDir(waitCtx, msg, framesWorkPrefix)
+	require.ErrorAs(t, err, &pErr)
+	assert.Equal(t, ErrInsufficientSpace, pErr.Code)
+	assert.True(t, pErr.Retryable)
+}
+
+func TestProcessVideoWorkspaceErrors(t *testing.T) {
+	const mb = 1 << 20
+	originalUsage, originalInterval := diskUsage, diskPollInterval
+	defer func() { diskUsage, diskPollInterval = originalUsage, originalInterval }()
+	diskPollInterval = time.Millisecond
+
+	media := NewFakeMedia()
+	ps := &ProcessingService{Objects: newMemoryStore(), Publisher: &recordingPublisher{}, Prober: media, Extractor: media}
+	msg := ProcessingMessage{VideoID: "v1", Filename: "video.mp4", Bucket: "video-uploads", ObjectName: "1/video.mp4", Size: 100 * mb}
+	t.Setenv("DISK_RESERVE_MB", "0")
+
+	tests := []struct {
+		name      string
+		tempDir   func(t *testing.T) string
+		cancel    bool
+		wantCode  ErrorCode
+		wantRetry bool
+	}{
+		{
+			name:      "tempo limite aguardando espaço",
+			wantCode:  ErrTimeout,
+			wantRetry: true,
+		},
+		{
+			name:     "cancelado aguardando espaço",
+			cancel:   true,
+			wantCode: ErrCancelled,
+		},
+		{
+			name: "diretório de trabalho não pode ser criado",
+			tempDir: func(t *testing.T) string {
+				file := filepath.Join(t.TempDir(), "arquivo")
+				require.NoError(t, os.WriteFile(file, nil, 0644))
+				return filepath.Join(file, "work")
+			},
+			wantCode:  ErrWorkspaceFailed,
+			wantRetry: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			if tt.tempDir != nil {
+				dir = tt.tempDir(t)
+			}
+			t.Setenv("PROCESSING_TEMP_DIR", dir)
+			diskUsage = func(string) (uint64, uint64, error) { return 10 * mb, 500 * mb, nil }
+
+			jobCtx, cancel := context.WithTimeout(ctx, 20*time.Millisecond)
+			defer cancel()
+			if tt.cancel {
+				diskUsage = func(string) (uint64, uint64, error) {
+					cancel()
+					return 10 * mb, 500 * mb, nil
+				}
+			}
+
+			result := ps.processVideo(jobCtx, msg, nil)
+			assert.Equal(t, "error", result.Status)
+			assert.Equal(t, string(tt.wantCode), result.ErrorCode)
+			assert.Equal(t, tt.wantRetry, result.Retryable)
+		})
+	}
+}
+
+func TestSweepWorkDirs(t *testing.T) {
+	root := t.TempDir()
+	t.Setenv("PROCESSING_TEMP_DIR", root)
+
+	for _, name := range []string{framesWorkPrefix + "a", transcodeWorkPrefix + "b", "other"} {
+		require.NoError(t, os.MkdirAll(filepath.Join(root, name, "frames"), 0755))
+	}
+	require.NoError(t, os.WriteFile(filepath.Join(root, framesWorkPrefix+"file"), nil, 0644))
+
+	sweepWorkDirs()
+
+	entries, err := os.ReadDir(root)
+	require.NoError(t, err)
+	var names []string
+	for _, entry := range entries {
+		names = append(names, entry.Name())
+	}
+	assert.Equal(t, []string{"other", framesWorkPrefix + "file"}, names)
+}
+
+func TestScenesStage(t *testing.T) {
+	store := newMemoryStore()
+	media := NewFakeMedia()
+	media.Duration = 10
+	media.Scenes = []SceneChange{{Time: 4, Score: 0.8}, {Time: 6, Score: 0.1}, {Time: 7.5, Score: 0.55}}
+	ps := &ProcessingService{Objects: store, Publisher: &recordingPublisher{}, Prober: media, Extractor: media, Scenes: media}
+
+	msg := ProcessingMessage{
+		VideoID:    "scenes",
+		Filename:   "video.mp4",
+		Bucket:     "video-uploads",
+		ObjectName: "1/video.mp4",
+		UserID:     "1",
+		Pipeline: &Pipeline{Stages: []PipelineStage{
+			{Type: "probe"},
+			{Type: "extract", Params: map[string]interface{}{"fps": 0.5}},
+			{Type: "scenes", Params: map[string]interface{}{"threshold": 0.4}},
+			{Type: "archive"},
+			{Type: "upload"},
+		}},
+	}
+	store.objects["video-uploads/1/video.mp4"] = []byte("conteúdo do vídeo")
+
+	result := ps.processVideo(ctx, msg, nil)
+	require.Equal(t, "completed", result.Status, result.ErrorDetail)
+	assert.Equal(t, 3, result.Metadata["shot_count"])
+	assert.Equal(t, "shots_scenes.json", result.Metadata["shots_object"])
+
+	entries := zipEntries(t, store.objects["video-processed/frames_scenes.zip"])
+	assert.Subset(t, entries, []string{"shots.json", "shots.csv", "shots/shot_0001.png", "shots/shot_0002.png", "shots/shot_0003.png"})
+
+	var shots []Shot
+	require.NoError(t, json.Unmarshal(store.objects["video-processed/shots_scenes.json"], &shots))
+	assert.Equal(t, []Shot{
+		{Index: 1, Start: 0, End: 4, Duration: 4, Score: 0, Frame: "shots/shot_0001.png"},
+		{Index: 2, Start: 4, End: 7.5, Duration: 3.5, Score: 0.8, Frame: "shots/shot_0002.png"},
+		{Index: 3, Start: 7.5, End: 10, Duration: 2.5, Score: 0.55, Frame: "shots/shot_0003.png"},
+	}, shots)
+
+	csvData := string(store.objects["video-processed/shots_scenes.csv"])
+	assert.Contains(t, csvData, "index,start,end,duration,score,frame\n")
+	assert.Contains(t, csvData, "2,4.000,7.500,3.500,0.8000,shots/shot_0002.png\n")
+}
+
+func TestBuildShots(t *testing.T) {
+	// Sem mudanças de cena: um único shot cobrindo o vídeo
+	assert.Equal(t, []Shot{{Index: 1, End: 8, Duration: 8}}, buildShots(nil, 8))
+
+	// Cortes em 0, repetidos ou após o fim são ignorados
+	shots := buildShots([]SceneChange{{Time: 0, Score: 0.9}, {Time: 3, Score: 0.5}, {Time: 3, Score: 0.6}, {Time: 9, Score: 0.7}}, 8)
+	require.Len(t, shots, 2)
+	assert.Equal(t, Shot{Index: 2, Start: 3, End: 8, Duration: 5, Score: 0.5}, shots[1])
+}
+
+func TestParseSceneMetadata(t *testing.T) {
+	output := "frame:0    pts:375     pts_time:15.015\nlavfi.scene_score=0.612345\n" +
+		"frame:1    pts:1200    pts_time:48.048\nlavfi.scene_score=0.401\n"
+	assert.Equal(t, []SceneChange{{Time: 15.015, Score: 0.612345}, {Time: 48.048, Score: 0.401}}, parseSceneMetadata(output))
+	assert.Empty(t, parseSceneMetadata(""))
+}
+
+func TestScenesMustPrecedeArchive(t *testing.T) {
+	pipeline := Pipeline{Stages: []PipelineStage{{Type: "extract"}, {Type: "archive"}, {Type: "scenes"}, {Type: "upload"}}}
+	assert.ErrorContains(t, pipeline.Validate(), "scenes deve vir antes de archive")
+
+	pipeline = Pipeline{Stages: []PipelineStage{{Type: "extract"}, {Type: "scenes", Params: map[string]interface{}{"threshold": 1.5}}, {Type: "archive"}, {Type: "upload"}}}
+	assert.ErrorContains(t, pipeline.Validate(), "threshold deve estar entre 0 e 1")
+}
+
+func TestResultCacheKey(t *testing.T) {
+	msg := ProcessingMessage{VideoID: "a", UserID: "1", ContentHash: "abc"}
+	fps := func(v float64) Pipeline {
+		return Pipeline{Stages: []PipelineStage{{Type: "extract", Params: map[string]interface{}{"fps": v}}, {Type: "archive"}, {Type: "upload"}}}
+	}
+
+	key, ok := resultCacheKey(msg, fps(1))
+	require.True(t, ok)
+
+	// Outro vídeo e outro usuário com o mesmo conteúdo e opções: mesma chave
+	other := msg
+	other.VideoID, other.UserID = "b", "2"
+	otherKey, _ := resultCacheKey(other, fps(1))
+	assert.Equal(t, key, otherKey)
+
+	otherKey, _ = resultCacheKey(msg, fps(2))
+	assert.NotEqual(t, key, otherKey)
+
+	// Sem hash não há reuso
+	_, ok = resultCacheKey(ProcessingMessage{VideoID: "a"}, fps(1))
+	assert.False(t, ok)
+
+	// Texto com template muda por vídeo
+	msg.Overlay = &OverlayOptions{Type: "text", Text: "{video_id}"}
+	_, ok = resultCacheKey(msg, fps(1))
+	assert.False(t, ok)
+
+	// Marca d'água de imagem é do usuário
+	msg.Overlay = &OverlayOptions{Type: "image"}
+	other.Overlay = msg.Overlay
+	key, _ = resultCacheKey(msg, fps(1))
+	otherKey, _ = resultCacheKey(other, fps(1))
+	assert.NotEqual(t, key, otherKey)
+}
+
+func TestProcessVideoReusesResult(t *testing.T) {
+	store := newMemoryStore()
+	media := NewFakeMedia()
+	media.Duration = 3
+	results := memoryResults{}
+	ps := &ProcessingService{Objects: store, Publisher: &recordingPublisher{}, Prober: media, Extractor: media, Results: results}
+
+	first := ProcessingMessage{VideoID: "first", Filename: "a.mp4", Bucket: "video-uploads", ObjectName: "first.mp4", UserID: "1", ContentHash: "abc"}
+	store.objects["video-uploads/first.mp4"] = []byte("conteúdo do vídeo")
+
+	result := ps.processVideo(ctx, first, nil)
+	require.Equal(t, "completed", result.Status, result.ErrorDetail)
+	assert.Nil(t, result.Metadata["cache_hit"])
+	require.Len(t, results, 1)
+
+	// Mesmo conteúdo: concluído sem baixar o original (ausente no store)
+	second := ProcessingMessage{VideoID: "second", Filename: "b.mp4", Bucket: "video-uploads", ObjectName: "second.mp4", UserID: "2", ContentHash: "abc", Version: 2}
+	reused := ps.processVideo(ctx, second, nil)
+	require.Equal(t, "completed", reused.Status, reused.ErrorDetail)
+	assert.Equal(t, true, reused.Metadata["cache_hit"])
+	assert.Equal(t, "first", reused.Metadata["cache_source"])
+	assert.Equal(t, "b.mp4", reused.Metadata["original_filename"])
+	assert.Equal(t, "frames_second_v2.zip", reused.ZipObjectName)
+	assert.Equal(t, result.FrameCount, reused.FrameCount)
+	assert.Equal(t, store.objects["video-processed/frames_first.zip"], store.objects["video-processed/frames_second_v2.zip"])
+
+	// Saída de origem removida: processa normalmente
+	delete(store.objects, "video-processed/frames_first.zip")
+	store.objects["video-uploads/second.mp4"] = []byte("conteúdo do vídeo")
+	processed := ps.processVideo(ctx, second, nil)
+	require.Equal(t, "completed", processed.Status, processed.ErrorDetail)
+	assert.Nil(t, processed.Metadata["cache_hit"])
+}
+
+func memberZip(t *testing.T, names ...string) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	writer := zip.NewWriter(&buf)
+	for _, name := range names {
+		w, err := writer.Create(name)
+		require.NoError(t, err)
+		w.Write([]byte("conteúdo de " + name))
+	}
+	require.NoError(t, writer.Close())
+	return buf.Bytes()
+}
+
+func TestFinalizeBatch(t *testing.T) {
+	store := newMemoryStore()
+	publisher := &recordingPublisher{}
+	ps := &ProcessingService{Objects: store, Publisher: publisher}
+
+	store.objects["video-processed/frames_a.zip"] = memberZip(t, "frame_0001.png", "frame_0002.png")
+	msg := ProcessingMessage{
+		VideoID: "b1",
+		BatchID: "b1",
+		UserID:  "7",
+		JobType: JobTypeBatch,
+		Members: []BatchMember{
+			{VideoID: "a", Filename: "a.mp4", Status: "completed", ZipObjectName: "frames_a.zip", FrameCount: 2},
+			{VideoID: "b", Filename: "b.mp4", Status: "failed", ErrorCode: string(ErrInvalidMedia), Error: "inválido"},
+			{VideoID: "c", Filename: "c.mp4", Status: "completed", ZipObjectName: "frames_c.zip", FrameCount: 4},
+		},
+	}
+
+	result := ps.finalizeBatch(ctx, msg, ps.newJobEvents(msg, 1))
+	require.Equal(t, "completed", result.Status, result.ErrorDetail)
+	assert.Equal(t, "batch_b1.zip", result.ZipObjectName)
+	assert.Equal(t, 2, result.FrameCount)
+	assert.Equal(t, 1, result.Metadata["completed"])
+	assert.Equal(t, 2, result.Metadata["failed"])
+	require.Len(t, result.Metadata["failures"], 2)
+
+	data := store.objects["video-processed/batch_b1.zip"]
+	assert.Equal(t, []string{"a/frame_0001.png", "a/frame_0002.png", "manifest.json"}, zipEntries(t, data))
+
+	reader, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	require.NoError(t, err)
+	var manifest BatchManifest
+	for _, file := range reader.File {
+		if file.Name == "manifest.json" {
+			rc, err := file.Open()
+			require.NoError(t, err)
+			require.NoError(t, json.NewDecoder(rc).Decode(&manifest))
+			rc.Close()
+		}
+	}
+	require.Len(t, manifest.Videos, 3)
+	assert.Equal(t, "a/", manifest.Videos[0].Directory)
+	assert.Equal(t, string(ErrInvalidMedia), manifest.Videos[1].ErrorCode)
+	// ZIP do vídeo c não existe mais: entra no manifest como falha
+	assert.Equal(t, "failed", manifest.Videos[2].Status)
+	assert.Equal(t, string(ErrDownloadFailed), manifest.Videos[2].ErrorCode)
+
+	// Um evento de progresso por vídeo
+	assert.Equal(t, []string{"video.batch.progress", "video.batch.progress", "video.batch.progress"}, publisher.keys)
+}
+
+func TestJobCanceller(t *testing.T) {
+	c := newJobCanceller()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	require.True(t, c.track("video_1", cancel))
+	assert.True(t, c.cancel("video_1"))
+	assert.ErrorIs(t, ctx.Err(), context.Canceled)
+	c.untrack("video_1")
+
+	// Jobs que chegarem depois do cancelamento não rodam
+	assert.False(t, c.track("video_1", func() {}))
+	assert.False(t, c.cancel("video_2"))
+	assert.False(t, c.track("video_2", func() {}))
+	assert.True(t, c.track("video_3", func() {}))
+
+	// Sem canceller (testes e ferramentas), todo job roda
+	var none *jobCanceller
+	assert.True(t, none.track("video_1", func() {}))
+	none.untrack("video_1")
+
+	result := cancelledResult(ProcessingMessage{VideoID: "video_1", UserID: "7", JobType: JobTypeTranscode})
+	assert.Equal(t, "error", result.Status)
+	assert.Equal(t, string(ErrCancelled), result.ErrorCode)
+	assert.Equal(t, JobTypeTranscode, result.JobType)
+	assert.False(t, result.Retryable)
+}
@@ -0,0 +1,476 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+
+	"github.com/minio/minio-go/v7"
+	"github.com/streadway/amqp"
+)
+
+// Inspeção de streams e capítulos de um vídeo e exportação de uma stream de
+// legenda no formato do codec (srt, webvtt)
+type Prober interface {
+	Probe(ctx context.Context, videoPath string) (*ProbeOutput, error)
+	ConvertSubtitle(ctx context.Context, videoPath string, streamIndex int, codec, outputPath string) error
+}
+
+// Extração de frames PNG (frame_0001.png, frame_0002.png, ...) para framesDir;
+// retorna a quantidade de frames gerados. TransformFrames reescreve os frames
+// com um filtergraph que lê de [0:v] (e das entradas extras) e escreve em [out]
+type FrameExtractor interface {
+	ExtractFrames(ctx context.Context, videoPath, framesDir string, fps float64, overlay *overlaySpec, probe *ProbeOutput) (int, error)
+	TransformFrames(ctx context.Context, framesDir string, fps float64, inputs []string, filterComplex string) error
+}
+
+// Codificação de uma rendição: MP4 em mp4Path e playlist HLS
+// (index.m3u8 e segmentos) em playlistDir, que já existe
+type Transcoder interface {
+	EncodeRendition(ctx context.Context, videoPath, mp4Path, playlistDir string, profile RenditionProfile) error
+}
+
+// Detecção de mudanças de cena e captura de um frame em um instante do vídeo
+type SceneDetector interface {
+	DetectScenes(ctx context.Context, videoPath string, threshold float64) ([]SceneChange, error)
+	ExtractFrameAt(ctx context.Context, videoPath string, at float64, outputPath string) error
+}
+
+// Operações de objeto usadas pelo worker (implementada por *minio.Client)
+type ObjectStore interface {
+	FGetObject(ctx context.Context, bucketName, objectName, filePath string, opts minio.GetObjectOptions) error
+	FPutObject(ctx context.Context, bucketName, objectName, filePath string, opts minio.PutObjectOptions) (minio.UploadInfo, error)
+	CopyObject(ctx context.Context, dst minio.CopyDestOptions, src minio.CopySrcOptions) (minio.UploadInfo, error)
+}
+
+// Publicação de mensagens no RabbitMQ (implementada por *amqp.Channel)
+type Publisher interface {
+	Publish(exchange, key string, mandatory, immediate bool, msg amqp.Publishing) error
+}
+
+// Backend de mídia escolhido por MEDIA_BACKEND: "ffmpeg" (padrão) ou "fake",
+// útil para rodar o serviço localmente sem ffmpeg instalado
+func newMediaBackend() (Prober, FrameExtractor, SceneDetector, Transcoder) {
+	if getEnv("MEDIA_BACKEND", "ffmpeg") == "fake" {
+		log.Println("Aviso: usando backend de mídia fake (frames sintéticos)")
+		fake := NewFakeMedia()
+		return fake, fake, fake, fake
+	}
+	return ffmpegMedia{}, ffmpegMedia{}, ffmpegMedia{}, ffmpegMedia{}
+}
+
+// Implementação com os binários ffprobe/ffmpeg
+type ffmpegMedia struct{}
+
+func (ffmpegMedia) Probe(ctx context.Context, videoPath string) (*ProbeOutput, error) {
+	cmd := exec.CommandContext(ctx, "ffprobe",
+		"-v", "error",
+		"-print_format", "json",
+		"-show_format",
+		"-show_streams",
+		"-show_chapters",
+		videoPath,
+	)
+
+	output, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("erro no ffprobe: %v", err)
+	}
+
+	var probe ProbeOutput
+	if err := json.Unmarshal(output, &probe); err != nil {
+		return nil, fmt.Errorf("erro ao interpretar saída do ffprobe: %v", err)
+	}
+
+	return &probe, nil
+}
+
+func (ffmpegMedia) ExtractFrames(ctx context.Context, videoPath, framesDir string, fps float64, overlay *overlaySpec, probe *ProbeOutput) (int, error) {
+	// Usar ffmpeg para extrair frames (padrão: 1 frame por segundo)
+	framePattern := filepath.Join(framesDir, "frame_%04d.png")
+	fpsFilter := fmt.Sprintf("fps=%g", fps)
+
+	args := []string{"-i", videoPath}
+	if overlay == nil {
+		args = append(args, "-vf", fpsFilter)
+	} else {
+		// Aplicar overlay no mesmo filtergraph da extração
+		width, height := 0, 0
+		if probe != nil {
+			width, height = probe.videoDimensions()
+		}
+		overlayFilter, err := overlay.filter("base", "out", width, height)
+		if err != nil {
+			return 0, err
+		}
+		if overlay.WatermarkPath != "" {
+			args = append(args, "-i", overlay.WatermarkPath)
+		}
+		args = append(args,
+			"-filter_complex", "[0:v]"+fpsFilter+"[base];"+overlayFilter,
+			"-map", "[out]",
+		)
+	}
+	args = append(args,
+		"-y", // sobrescrever arquivos existentes
+		framePattern,
+	)
+
+	cmd := exec.CommandContext(ctx, "ffmpeg", args...)
+
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		if isNoSpaceOutput(string(output)) {
+			return 0, newProcessingError(ErrInsufficientSpace, "erro no ffmpeg: %s\nOutput: %s", err.Error(), string(output))
+		}
+		if isInvalidMediaOutput(string(output)) {
+			return 0, newProcessingError(ErrInvalidMedia, "erro no ffmpeg: %s\nOutput: %s", err.Error(), string(output))
+		}
+		return 0, fmt.Errorf("erro no ffmpeg: %s\nOutput: %s", err.Error(), string(output))
+	}
+
+	return countFrames(framesDir)
+}
+
+func (ffmpegMedia) ConvertSubtitle(ctx context.Context, videoPath string, streamIndex int, codec, outputPath string) error {
+	cmd := exec.CommandContext(ctx, "ffmpeg",
+		"-i", videoPath,
+		"-map", fmt.Sprintf("0:%d", streamIndex),
+		"-c:s", codec,
+		"-y",
+		outputPath,
+	)
+
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("erro ao converter legenda %d para %s: %s\nOutput: %s", streamIndex, codec, err.Error(), string(output))
+	}
+
+	return nil
+}
+
+// fps mantém os timestamps dos frames coerentes com a extração
+func (ffmpegMedia) TransformFrames(ctx context.Context, framesDir string, fps float64, inputs []string, filterComplex string) error {
+	frames, err := filepath.Glob(filepath.Join(framesDir, "*.png"))
+	if err != nil {
+		return fmt.Errorf("erro ao listar frames: %v", err)
+	}
+	if len(frames) == 0 {
+		return nil
+	}
+
+	outputDir := framesDir + "_transform"
+	if err := os.MkdirAll(outputDir, 0755); err != nil {
+		return fmt.Errorf("erro ao criar diretório temporário: %v", err)
+	}
+	defer os.RemoveAll(outputDir)
+
+	args := []string{"-framerate", fmt.Sprintf("%g", fps), "-i", filepath.Join(framesDir, "frame_%04d.png")}
+	for _, input := range inputs {
+		args = append(args, "-i", input)
+	}
+	args = append(args, "-filter_complex", filterComplex, "-map", "[out]", "-y", filepath.Join(outputDir, "frame_%04d.png"))
+
+	output, err := exec.CommandContext(ctx, "ffmpeg", args...).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("erro no ffmpeg: %s\nOutput: %s", err.Error(), string(output))
+	}
+
+	for _, frame := range frames {
+		if err := os.Rename(filepath.Join(outputDir, filepath.Base(frame)), frame); err != nil {
+			return fmt.Errorf("erro ao substituir frame %s: %v", filepath.Base(frame), err)
+		}
+	}
+
+	return nil
+}
+
+func (ffmpegMedia) EncodeRendition(ctx context.Context, videoPath, mp4Path, playlistDir string, profile RenditionProfile) error {
+	// GOP fixo para que os segmentos HLS possam ser cortados sem recodificar
+	cmd := exec.CommandContext(ctx, "ffmpeg",
+		"-i", videoPath,
+		"-vf", fmt.Sprintf("scale=-2:%d", profile.Height),
+		"-c:v", "libx264",
+		"-preset", "veryfast",
+		"-b:v", fmt.Sprintf("%dk", profile.VideoBitrate),
+		"-maxrate", fmt.Sprintf("%dk", profile.VideoBitrate*107/100),
+		"-bufsize", fmt.Sprintf("%dk", profile.VideoBitrate*3/2),
+		"-g", "48",
+		"-keyint_min", "48",
+		"-sc_threshold", "0",
+		"-c:a", "aac",
+		"-b:a", fmt.Sprintf("%dk", profile.AudioBitrate),
+		"-movflags", "+faststart",
+		"-y",
+		mp4Path,
+	)
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("erro no ffmpeg: %s\nOutput: %s", err.Error(), string(output))
+	}
+
+	cmd = exec.CommandContext(ctx, "ffmpeg",
+		"-i", mp4Path,
+		"-c", "copy",
+		"-f", "hls",
+		"-hls_time", "6",
+		"-hls_playlist_type", "vod",
+		"-hls_segment_filename", filepath.Join(playlistDir, "segment_%04d.ts"),
+		"-y",
+		filepath.Join(playlistDir, "index.m3u8"),
+	)
+	output, err = cmd.CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("erro no ffmpeg (HLS): %s\nOutput: %s", err.Error(), string(output))
+	}
+	return nil
+}
+
+func (ffmpegMedia) DetectScenes(ctx context.Context, videoPath string, threshold float64) ([]SceneChange, error) {
+	// metadata=print escreve pts_time e lavfi.scene_score de cada frame selecionado
+	cmd := exec.CommandContext(ctx, "ffmpeg",
+		"-hide_banner", "-nostats",
+		"-i", videoPath,
+		"-an", "-sn",
+		"-vf", fmt.Sprintf("select='gt(scene,%g)',metadata=print:file=-", threshold),
+		"-f", "null", "-",
+	)
+
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	output, err := cmd.Output()
+	if err != nil {
+		if isInvalidMediaOutput(stderr.String()) {
+			return nil, newProcessingError(ErrInvalidMedia, "erro no ffmpeg: %s\nOutput: %s", err.Error(), stderr.String())
+		}
+		return nil, fmt.Errorf("erro no ffmpeg: %s\nOutput: %s", err.Error(), stderr.String())
+	}
+
+	return parseSceneMetadata(string(output)), nil
+}
+
+func (ffmpegMedia) ExtractFrameAt(ctx context.Context, videoPath string, at float64, outputPath string) error {
+	cmd := exec.CommandContext(ctx, "ffmpeg",
+		"-ss", fmt.Sprintf("%.3f", at),
+		"-i", videoPath,
+		"-frames:v", "1",
+		"-y",
+		outputPath,
+	)
+
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("erro no ffmpeg: %s\nOutput: %s", err.Error(), string(output))
+	}
+	if _, err := os.Stat(outputPath); err != nil {
+		return fmt.Errorf("nenhum frame em %.3fs", at)
+	}
+	return nil
+}
+
+func countFrames(framesDir string) (int, error) {
+	frames, err := filepath.Glob(filepath.Join(framesDir, "*.png"))
+	if err != nil {
+		return 0, fmt.Errorf("erro ao listar frames: %v", err)
+	}
+	return len(frames), nil
+}
+
+// Implementação em processo, sem ffmpeg: descreve um vídeo sintético e gera
+// frames determinísticos (mesma entrada, mesmos bytes)
+type FakeMedia struct {
+	Duration float64 // segundos
+	Width    int
+	Height   int
+	Chapters []ProbeChapter
+	Subtitle bool // incluir stream de legenda de imagem (ignorada na exportação)
+	// Idiomas das streams de legenda de texto, a partir do índice 2
+	Subtitles []string
+	Scenes    []SceneChange
+
+	// Filtergraphs recebidos por TransformFrames, em ordem; os frames não mudam
+	Transforms []string
+
+	ProbeErr     error
+	ExtractErr   error
+	TransformErr error
+	EncodeErr    error
+	SubtitleErrs map[int]error // falha na conversão por índice de stream
+}
+
+func NewFakeMedia() *FakeMedia {
+	return &FakeMedia{Duration: 5, Width: 64, Height: 36}
+}
+
+func (f *FakeMedia) Probe(ctx context.Context, videoPath string) (*ProbeOutput, error) {
+	if f.ProbeErr != nil {
+		return nil, f.ProbeErr
+	}
+	if _, err := os.Stat(videoPath); err != nil {
+		return nil, fmt.Errorf("erro no ffprobe: %v", err)
+	}
+
+	probe := &ProbeOutput{
+		Streams: []ProbeStream{
+			{Index: 0, CodecType: "video", CodecName: "h264", Width: f.Width, Height: f.Height},
+		},
+		Chapters: f.Chapters,
+		Format:   ProbeFormat{Duration: fmt.Sprintf("%f", f.Duration)},
+	}
+	if f.Subtitle {
+		probe.Streams = append(probe.Streams, ProbeStream{Index: 1, CodecType: "subtitle", CodecName: "dvd_subtitle"})
+	}
+	for i, language := range f.Subtitles {
+		probe.Streams = append(probe.Streams, ProbeStream{
+			Index: 2 + i, CodecType: "subtitle", CodecName: "subrip",
+			Tags: map[string]string{"language": language},
+		})
+	}
+	return probe, nil
+}
+
+// Legenda de uma única cue identificando a stream
+func (f *FakeMedia) ConvertSubtitle(ctx context.Context, videoPath string, streamIndex int, codec, outputPath string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if err := f.SubtitleErrs[streamIndex]; err != nil {
+		return err
+	}
+	if _, err := os.Stat(videoPath); err != nil {
+		return fmt.Errorf("erro no ffmpeg: %v", err)
+	}
+
+	var content string
+	switch codec {
+	case "srt":
+		content = fmt.Sprintf("1\n00:00:00,000 --> 00:00:01,000\nlegenda %d\n", streamIndex)
+	case "webvtt":
+		content = fmt.Sprintf("WEBVTT\n\n00:00:00.000 --> 00:00:01.000\nlegenda %d\n", streamIndex)
+	default:
+		return fmt.Errorf("codec de legenda não suportado: %s", codec)
+	}
+	return os.WriteFile(outputPath, []byte(content), 0644)
+}
+
+func (f *FakeMedia) ExtractFrames(ctx context.Context, videoPath, framesDir string, fps float64, overlay *overlaySpec, probe *ProbeOutput) (int, error) {
+	if f.ExtractErr != nil {
+		return 0, f.ExtractErr
+	}
+	if _, err := os.Stat(videoPath); err != nil {
+		return 0, fmt.Errorf("erro no ffmpeg: %v", err)
+	}
+	if overlay != nil {
+		// O overlay não é desenhado, mas o filtro precisa ser válido como no ffmpeg
+		if _, err := overlay.filter("base", "out", f.Width, f.Height); err != nil {
+			return 0, err
+		}
+	}
+
+	count := int(f.Duration * fps)
+	for i := 1; i <= count; i++ {
+		if err := ctx.Err(); err != nil {
+			return 0, err
+		}
+		path := filepath.Join(framesDir, fmt.Sprintf("frame_%04d.png", i))
+		if err := writeSyntheticFrame(path, i, f.Width, f.Height); err != nil {
+			return 0, fmt.Errorf("erro ao gerar frame sintético: %v", err)
+		}
+	}
+
+	return countFrames(framesDir)
+}
+
+// Registra o filtergraph e mantém os frames; entradas extras precisam existir
+func (f *FakeMedia) TransformFrames(ctx context.Context, framesDir string, fps float64, inputs []string, filterComplex string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if f.TransformErr != nil {
+		return f.TransformErr
+	}
+	for _, input := range inputs {
+		if _, err := os.Stat(input); err != nil {
+			return fmt.Errorf("erro no ffmpeg: %v", err)
+		}
+	}
+	f.Transforms = append(f.Transforms, filterComplex)
+	return nil
+}
+
+// MP4 e playlist de um segmento com conteúdo derivado do perfil
+func (f *FakeMedia) EncodeRendition(ctx context.Context, videoPath, mp4Path, playlistDir string, profile RenditionProfile) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if f.EncodeErr != nil {
+		return f.EncodeErr
+	}
+	if _, err := os.Stat(videoPath); err != nil {
+		return fmt.Errorf("erro no ffmpeg: %v", err)
+	}
+
+	if err := os.WriteFile(mp4Path, []byte("mp4 "+profile.Name), 0644); err != nil {
+		return err
+	}
+	if err := os.WriteFile(filepath.Join(playlistDir, "segment_0000.ts"), []byte("ts "+profile.Name), 0644); err != nil {
+		return err
+	}
+	playlist := fmt.Sprintf("#EXTM3U\n#EXT-X-VERSION:3\n#EXT-X-TARGETDURATION:6\n#EXTINF:%f,\nsegment_0000.ts\n#EXT-X-ENDLIST\n", f.Duration)
+	return os.WriteFile(filepath.Join(playlistDir, "index.m3u8"), []byte(playlist), 0644)
+}
+
+// Mudanças de cena configuradas acima do limiar
+func (f *FakeMedia) DetectScenes(ctx context.Context, videoPath string, threshold float64) ([]SceneChange, error) {
+	if _, err := os.Stat(videoPath); err != nil {
+		return nil, fmt.Errorf("erro no ffmpeg: %v", err)
+	}
+	var changes []SceneChange
+	for _, change := range f.Scenes {
+		if change.Score > threshold {
+			changes = append(changes, change)
+		}
+	}
+	return changes, nil
+}
+
+func (f *FakeMedia) ExtractFrameAt(ctx context.Context, videoPath string, at float64, outputPath string) error {
+	if _, err := os.Stat(videoPath); err != nil {
+		return fmt.Errorf("erro no ffmpeg: %v", err)
+	}
+	if at < 0 || at > f.Duration {
+		return fmt.Errorf("nenhum frame em %.3fs", at)
+	}
+	return writeSyntheticFrame(outputPath, int(at)+1, f.Width, f.Height)
+}
+
+// Gradiente com a cor base derivada do índice do frame
+func writeSyntheticFrame(path string, index, width, height int) error {
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			img.Set(x, y, color.RGBA{
+				R: uint8(index * 40),
+				G: uint8(x * 255 / width),
+				B: uint8(y * 255 / height),
+				A: 255,
+			})
+		}
+	}
+
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	return png.Encode(file, img)
+}
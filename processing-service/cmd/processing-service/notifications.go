@@ -0,0 +1,108 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+
+	"github.com/streadway/amqp"
+)
+
+// Eventos finais cujo dono não pôde ser consultado aguardam nas filas de
+// espera (uma por passo do backoff, video_notifications_deferred.<ms>) e, ao
+// expirar, vão para a fila pendente para nova consulta
+const (
+	deferredNotificationsQueue = "video_notifications_deferred"
+	pendingNotificationsQueue  = "video_notifications_pending"
+)
+
+func maxNotificationAttempts() int {
+	attempts, err := strconv.Atoi(getEnv("MAX_NOTIFICATION_ATTEMPTS", "10"))
+	if err != nil || attempts < 1 {
+		return 10
+	}
+	return attempts
+}
+
+// Preencher e-mail e nome do dono do vídeo no evento
+func resolveEventUser(ctx context.Context, users UserDirectory, event *JobEvent) error {
+	if users == nil {
+		return fmt.Errorf("consulta de usuários não configurada")
+	}
+	user, err := users.LookupUser(ctx, event.UserID)
+	if err != nil {
+		return err
+	}
+	event.UserEmail = user.Email
+	event.UserName = user.Username
+	return nil
+}
+
+// Adiar a notificação de um evento já publicado sem dados de contato
+func deferNotification(publisher Publisher, event JobEvent, attempt int) error {
+	body, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("erro ao serializar evento: %v", err)
+	}
+
+	queue := delayQueueName(deferredNotificationsQueue, retryBackoff(attempt))
+	return publisher.Publish(
+		"",    // exchange
+		queue, // routing key
+		false, // mandatory
+		false, // immediate
+		amqp.Publishing{
+			ContentType:  "application/json",
+			DeliveryMode: amqp.Persistent,
+			Headers:      amqp.Table{attemptHeader: int32(attempt + 1)},
+			Body:         body,
+		})
+}
+
+// Tentar de novo a consulta dos eventos adiados; ao conseguir, o evento é
+// republicado com a mesma sequência (o storage o descarta como repetido e o
+// notification-service envia o e-mail)
+func (ps *ProcessingService) StartNotificationRetryWorker() {
+	msgs, err := ps.RabbitCh.Consume(pendingNotificationsQueue, "", false, false, false, false, nil)
+	if err != nil {
+		log.Fatalf("Erro ao configurar consumer de notificações adiadas: %v", err)
+	}
+
+	for msg := range msgs {
+		var event JobEvent
+		if err := json.Unmarshal(msg.Body, &event); err != nil {
+			log.Printf("Erro ao deserializar notificação adiada: %v", err)
+			msg.Nack(false, false)
+			continue
+		}
+
+		if err := ps.retryNotification(event, deliveryAttempt(msg)); err != nil {
+			log.Printf("Erro ao adiar notificação do vídeo %s: %v", event.VideoID, err)
+			msg.Nack(false, true)
+			continue
+		}
+		msg.Ack(false)
+	}
+}
+
+func (ps *ProcessingService) retryNotification(event JobEvent, attempt int) error {
+	err := resolveEventUser(context.Background(), ps.Users, &event)
+	if err == nil {
+		err = publishJobEvent(ps.Publisher, event)
+		if err == nil {
+			log.Printf("Notificação do vídeo %s liberada na tentativa %d", event.VideoID, attempt)
+			return nil
+		}
+	}
+
+	if errors.Is(err, errUserNotFound) || attempt >= maxNotificationAttempts() {
+		log.Printf("Notificação do vídeo %s descartada após %d tentativas: %v", event.VideoID, attempt, err)
+		return nil
+	}
+
+	log.Printf("Notificação do vídeo %s adiada novamente (tentativa %d): %v", event.VideoID, attempt, err)
+	return deferNotification(ps.Publisher, event, attempt)
+}
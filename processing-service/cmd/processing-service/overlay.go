@@ -0,0 +1,190 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"image"
+	_ "image/png"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/minio/minio-go/v7"
+)
+
+// Bucket com arquivos enviados pelo usuário (marcas d'água)
+const userAssetsBucket = "user-assets"
+
+// Opções de marca d'água/texto aplicadas sobre os frames de um job
+type OverlayOptions struct {
+	Type     string  `json:"type"`               // "image" ou "text"
+	Text     string  `json:"text,omitempty"`     // template com {video_id}, {timestamp} e {user}
+	Position string  `json:"position,omitempty"` // top-left, top-right, bottom-left, bottom-right, center
+	Opacity  float64 `json:"opacity,omitempty"`  // 0 a 1
+	Scale    float64 `json:"scale,omitempty"`    // fração da largura (imagem) ou altura (texto) do frame
+	Margin   int     `json:"margin,omitempty"`   // distância da borda em pixels
+}
+
+// Overlay pronto para uso no ffmpeg, com arquivos locais e dimensões resolvidas
+type overlaySpec struct {
+	Options       OverlayOptions
+	WatermarkPath string
+	TextFile      string
+	FontFile      string
+}
+
+func watermarkObjectName(userID string) string {
+	return fmt.Sprintf("watermarks/%s.png", userID)
+}
+
+// Preencher valores padrão das opções de overlay
+func (o *OverlayOptions) applyDefaults() {
+	if o.Position == "" {
+		o.Position = "bottom-right"
+	}
+	if o.Opacity <= 0 || o.Opacity > 1 {
+		o.Opacity = 0.5
+	}
+	if o.Scale <= 0 || o.Scale > 1 {
+		if o.Type == "image" {
+			o.Scale = 0.15
+		} else {
+			o.Scale = 0.05
+		}
+	}
+	if o.Margin <= 0 {
+		o.Margin = 10
+	}
+}
+
+// Baixar a marca d'água do usuário ou gravar o texto a ser desenhado; o
+// download segue o prazo e o cancelamento do job
+func (ps *ProcessingService) prepareOverlay(ctx context.Context, overlay *OverlayOptions, videoID, userID, workDir string) (*overlaySpec, error) {
+	if overlay == nil {
+		return nil, nil
+	}
+
+	options := *overlay
+	options.applyDefaults()
+	spec := &overlaySpec{Options: options}
+
+	switch options.Type {
+	case "image":
+		spec.WatermarkPath = filepath.Join(workDir, "watermark.png")
+		err := ps.Objects.FGetObject(ctx, userAssetsBucket, watermarkObjectName(userID), spec.WatermarkPath, minio.GetObjectOptions{})
+		if err != nil {
+			return nil, fmt.Errorf("erro ao baixar marca d'água do usuário %s: %v", userID, err)
+		}
+	case "text":
+		if strings.TrimSpace(options.Text) == "" {
+			return nil, fmt.Errorf("texto do overlay não informado")
+		}
+		spec.TextFile = filepath.Join(workDir, "overlay.txt")
+		text := renderOverlayText(options.Text, videoID, userID)
+		if err := os.WriteFile(spec.TextFile, []byte(text), 0644); err != nil {
+			return nil, fmt.Errorf("erro ao gravar texto do overlay: %v", err)
+		}
+		spec.FontFile = getEnv("OVERLAY_FONT_FILE", "/usr/share/fonts/dejavu/DejaVuSans.ttf")
+	default:
+		return nil, fmt.Errorf("tipo de overlay inválido: %s", options.Type)
+	}
+
+	return spec, nil
+}
+
+// Substituir campos do template; {timestamp} vira o tempo do frame no drawtext
+func renderOverlayText(template, videoID, userID string) string {
+	escape := strings.NewReplacer(`\`, `\\`, `%`, `\%`)
+	text := escape.Replace(template)
+	return strings.NewReplacer(
+		"{video_id}", escape.Replace(videoID),
+		"{user}", escape.Replace(userID),
+		"{timestamp}", "%{pts:hms}",
+	).Replace(text)
+}
+
+// Filtro ffmpeg do overlay; base e saída são rótulos do filtergraph e a
+// marca d'água, quando existir, deve ser a entrada 1
+func (s *overlaySpec) filter(base, output string, frameWidth, frameHeight int) (string, error) {
+	o := s.Options
+	if s.WatermarkPath != "" {
+		if frameWidth <= 0 {
+			return "", fmt.Errorf("dimensões do frame desconhecidas para aplicar marca d'água")
+		}
+		width := int(float64(frameWidth) * o.Scale)
+		if width < 1 {
+			width = 1
+		}
+		x, y := overlayPosition(o.Position, o.Margin, "W", "H", "w", "h")
+		return fmt.Sprintf("[1:v]format=rgba,scale=%d:-1,colorchannelmixer=aa=%.2f[wm];[%s][wm]overlay=x=%s:y=%s[%s]",
+			width, o.Opacity, base, x, y, output), nil
+	}
+
+	if frameHeight <= 0 {
+		return "", fmt.Errorf("dimensões do frame desconhecidas para aplicar texto")
+	}
+	fontSize := int(float64(frameHeight) * o.Scale)
+	if fontSize < 8 {
+		fontSize = 8
+	}
+	x, y := overlayPosition(o.Position, o.Margin, "w", "h", "tw", "th")
+	return fmt.Sprintf("[%s]drawtext=textfile=%s:expansion=normal:fontfile=%s:fontsize=%d:fontcolor=white@%.2f:borderw=2:bordercolor=black@%.2f:x=%s:y=%s[%s]",
+		base, s.TextFile, s.FontFile, fontSize, o.Opacity, o.Opacity, x, y, output), nil
+}
+
+func overlayPosition(position string, margin int, mainW, mainH, w, h string) (string, string) {
+	m := fmt.Sprintf("%d", margin)
+	switch position {
+	case "top-left":
+		return m, m
+	case "top-right":
+		return mainW + "-" + w + "-" + m, m
+	case "bottom-left":
+		return m, mainH + "-" + h + "-" + m
+	case "center":
+		return "(" + mainW + "-" + w + ")/2", "(" + mainH + "-" + h + ")/2"
+	default:
+		return mainW + "-" + w + "-" + m, mainH + "-" + h + "-" + m
+	}
+}
+
+// Aplicar o overlay a frames já extraídos (etapas de pós-processamento)
+func (ps *ProcessingService) applyOverlayToFrames(ctx context.Context, framesDir string, fps float64, spec *overlaySpec) error {
+	frames, err := filepath.Glob(filepath.Join(framesDir, "*.png"))
+	if err != nil {
+		return fmt.Errorf("erro ao listar frames: %v", err)
+	}
+	if len(frames) == 0 || spec == nil {
+		return nil
+	}
+
+	width, height, err := imageDimensions(frames[0])
+	if err != nil {
+		return err
+	}
+
+	filter, err := spec.filter("0:v", "out", width, height)
+	if err != nil {
+		return err
+	}
+
+	var inputs []string
+	if spec.WatermarkPath != "" {
+		inputs = append(inputs, spec.WatermarkPath)
+	}
+	return ps.Extractor.TransformFrames(ctx, framesDir, fps, inputs, filter)
+}
+
+func imageDimensions(path string) (int, int, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return 0, 0, err
+	}
+	defer file.Close()
+
+	config, _, err := image.DecodeConfig(file)
+	if err != nil {
+		return 0, 0, fmt.Errorf("erro ao ler dimensões de %s: %v", filepath.Base(path), err)
+	}
+	return config.Width, config.Height, nil
+}
@@ -0,0 +1,655 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"image"
+	"log"
+	"mime"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+// Pipeline declarativo de um job: etapas executadas em ordem pelo worker
+type Pipeline struct {
+	Stages []PipelineStage `json:"stages"`
+}
+
+type PipelineStage struct {
+	Type   string                 `json:"type"`
+	Params map[string]interface{} `json:"params,omitempty"`
+}
+
+// Estado compartilhado entre as etapas de um job
+type pipelineContext struct {
+	Ctx          context.Context // prazo e cancelamento do job
+	Events       *jobEvents      // eventos de progresso (pode ser nil)
+	Msg          ProcessingMessage
+	WorkDir      string
+	VideoPath    string
+	FramesDir    string
+	FPS          float64
+	Probe        *ProbeOutput
+	Extras       map[string]string // nome dentro do ZIP -> arquivo local
+	Uploads      map[string]string // objeto extra no MinIO -> arquivo local
+	Languages    []string
+	ChapterCount int
+	ShotCount    int
+	FrameCount   int
+	ZipPath      string
+	ZipObject    string
+	ZipSize      int64
+	// Overlay explícito no pipeline desativa o overlay no ffmpeg da extração
+	HasOverlayStage bool
+	// Alguma etapa posterior ao probe depende do resultado dele
+	ProbeRequired bool
+}
+
+// Implementação de uma etapa registrada
+type StageDefinition struct {
+	Requires []string  // etapas que precisam ter sido executadas antes
+	Before   []string  // etapas que, se presentes, precisam vir depois
+	Unique   bool      // etapa só pode aparecer uma vez
+	Failure  ErrorCode // código atribuído a erros não tipados da etapa
+	// Se a etapa depende de pc.Probe neste job; a falha do probe passa a
+	// interromper o job em vez de ser apenas registrada
+	UsesProbe func(pc *pipelineContext, params map[string]interface{}) bool
+	Validate  func(params map[string]interface{}) error
+	Run       func(ps *ProcessingService, pc *pipelineContext, params map[string]interface{}) error
+}
+
+var stageRegistry = map[string]StageDefinition{
+	"probe": {
+		Failure:  ErrInvalidMedia,
+		Unique:   true,
+		Validate: validateParams(map[string]string{"subtitles": "bool", "chapters": "bool"}),
+		Run:      runProbeStage,
+	},
+	"extract": {
+		Failure: ErrExtractionFailed,
+		Unique:  true,
+		Validate: func(params map[string]interface{}) error {
+			if err := validateParams(map[string]string{"fps": "number"})(params); err != nil {
+				return err
+			}
+			fps := paramFloat(params, "fps", 1)
+			if fps <= 0 || fps > 30 {
+				return fmt.Errorf("fps deve estar entre 0 e 30")
+			}
+			return nil
+		},
+		// Overlay do job no ffmpeg da extração usa as dimensões do vídeo
+		UsesProbe: func(pc *pipelineContext, params map[string]interface{}) bool {
+			return pc.Msg.Overlay != nil && !pc.HasOverlayStage
+		},
+		Run: runExtractStage,
+	},
+	"filter": {
+		Failure:  ErrExtractionFailed,
+		Requires: []string{"extract"},
+		Validate: func(params map[string]interface{}) error {
+			if err := validateParams(map[string]string{"name": "string", "strength": "number"})(params); err != nil {
+				return err
+			}
+			_, err := frameFilter(params)
+			return err
+		},
+		Run: runFilterStage,
+	},
+	"resize": {
+		Failure:  ErrExtractionFailed,
+		Requires: []string{"extract"},
+		Validate: func(params map[string]interface{}) error {
+			if err := validateParams(map[string]string{"width": "number", "height": "number"})(params); err != nil {
+				return err
+			}
+			width, height := paramInt(params, "width", 0), paramInt(params, "height", 0)
+			if width < 0 || height < 0 || width > 7680 || height > 4320 {
+				return fmt.Errorf("dimensões devem estar entre 0 e 7680x4320")
+			}
+			if width == 0 && height == 0 {
+				return fmt.Errorf("informe width e/ou height")
+			}
+			return nil
+		},
+		Run: runResizeStage,
+	},
+	"overlay": {
+		Failure:  ErrExtractionFailed,
+		Requires: []string{"extract"},
+		Validate: func(params map[string]interface{}) error {
+			if len(params) == 0 {
+				return nil // usa o overlay do job
+			}
+			_, err := overlayFromParams(params)
+			return err
+		},
+		Run: runOverlayStage,
+	},
+	"dedup": {
+		Failure:  ErrExtractionFailed,
+		Requires: []string{"extract"},
+		Validate: func(params map[string]interface{}) error {
+			if err := validateParams(map[string]string{"threshold": "number"})(params); err != nil {
+				return err
+			}
+			threshold := paramInt(params, "threshold", 5)
+			if threshold < 0 || threshold > 64 {
+				return fmt.Errorf("threshold deve estar entre 0 e 64")
+			}
+			return nil
+		},
+		Run: runDedupStage,
+	},
+	"scenes": {
+		Failure: ErrExtractionFailed,
+		Unique:  true,
+		Before:  []string{"archive"},
+		// Sem a duração medida no upload, o fim do último shot vem do probe
+		UsesProbe: func(pc *pipelineContext, params map[string]interface{}) bool {
+			return pc.Msg.Duration <= 0
+		},
+		Validate: validateScenesParams,
+		Run:      runScenesStage,
+	},
+	"archive": {
+		Failure:  ErrArchiveFailed,
+		Requires: []string{"extract"},
+		Unique:   true,
+		Validate: validateParams(map[string]string{}),
+		Run:      runArchiveStage,
+	},
+	"upload": {
+		Failure:  ErrUploadFailed,
+		Requires: []string{"archive"},
+		Unique:   true,
+		Validate: validateParams(map[string]string{}),
+		Run:      runUploadStage,
+	},
+}
+
+// Pipeline equivalente ao processamento original (1 frame por segundo em ZIP)
+func defaultPipeline() Pipeline {
+	return Pipeline{Stages: []PipelineStage{
+		{Type: "probe"},
+		{Type: "extract"},
+		{Type: "archive"},
+		{Type: "upload"},
+	}}
+}
+
+// Validar etapas, parâmetros e ordem do pipeline
+func (p Pipeline) Validate() error {
+	if len(p.Stages) == 0 {
+		return fmt.Errorf("pipeline sem etapas")
+	}
+
+	seen := make(map[string]bool)
+	for i, stage := range p.Stages {
+		definition, ok := stageRegistry[stage.Type]
+		if !ok {
+			return fmt.Errorf("etapa %d: tipo desconhecido %q", i+1, stage.Type)
+		}
+		if definition.Unique && seen[stage.Type] {
+			return fmt.Errorf("etapa %d: %s só pode aparecer uma vez", i+1, stage.Type)
+		}
+		for _, required := range definition.Requires {
+			if !seen[required] {
+				return fmt.Errorf("etapa %d: %s requer %s antes", i+1, stage.Type, required)
+			}
+		}
+		for _, later := range definition.Before {
+			if seen[later] {
+				return fmt.Errorf("etapa %d: %s deve vir antes de %s", i+1, stage.Type, later)
+			}
+		}
+		if err := definition.Validate(stage.Params); err != nil {
+			return fmt.Errorf("etapa %d (%s): %v", i+1, stage.Type, err)
+		}
+		seen[stage.Type] = true
+	}
+
+	if !seen["upload"] {
+		return fmt.Errorf("pipeline deve terminar com a etapa upload")
+	}
+	if p.Stages[len(p.Stages)-1].Type != "upload" {
+		return fmt.Errorf("upload deve ser a última etapa")
+	}
+
+	return nil
+}
+
+func (p Pipeline) stageTypes() []string {
+	types := make([]string, len(p.Stages))
+	for i, stage := range p.Stages {
+		types[i] = stage.Type
+	}
+	return types
+}
+
+// Executar as etapas em ordem; para na primeira falha
+func (ps *ProcessingService) runPipeline(p Pipeline, pc *pipelineContext) error {
+	for _, stage := range p.Stages {
+		if stage.Type == "overlay" {
+			pc.HasOverlayStage = true
+		}
+	}
+	probed := false
+	for _, stage := range p.Stages {
+		usesProbe := stageRegistry[stage.Type].UsesProbe
+		if probed && usesProbe != nil && usesProbe(pc, stage.Params) {
+			pc.ProbeRequired = true
+		}
+		probed = probed || stage.Type == "probe"
+	}
+
+	for i, stage := range p.Stages {
+		definition := stageRegistry[stage.Type]
+		if err := pc.Ctx.Err(); err != nil {
+			return classifyError(pc.Ctx, definition.Failure, fmt.Errorf("antes da etapa %s: %v", stage.Type, err))
+		}
+
+		log.Printf("Vídeo %s: etapa %d/%d (%s)", pc.Msg.VideoID, i+1, len(p.Stages), stage.Type)
+		if err := definition.Run(ps, pc, stage.Params); err != nil {
+			pErr := classifyError(pc.Ctx, definition.Failure, err)
+			pErr.Detail = fmt.Sprintf("etapa %s: %s", stage.Type, pErr.Detail)
+			return pErr
+		}
+		pc.Events.progress(stage.Type, i+1, len(p.Stages))
+	}
+	return nil
+}
+
+func runProbeStage(ps *ProcessingService, pc *pipelineContext, params map[string]interface{}) error {
+	probe, err := ps.Prober.Probe(pc.Ctx, pc.VideoPath)
+	if err != nil {
+		if pc.ProbeRequired {
+			return fmt.Errorf("erro ao inspecionar vídeo: %w", err)
+		}
+		// Sem ffprobe o processamento segue, apenas sem legendas e capítulos
+		log.Printf("Aviso: não foi possível inspecionar streams do vídeo %s: %v", pc.Msg.VideoID, err)
+		return nil
+	}
+	pc.Probe = probe
+
+	if paramBool(params, "subtitles", true) {
+		tracks, err := ps.extractSubtitles(pc.Ctx, pc.VideoPath, filepath.Join(pc.WorkDir, "subtitles"), probe)
+		if err != nil {
+			log.Printf("Aviso: erro ao exportar legendas do vídeo %s: %v", pc.Msg.VideoID, err)
+		}
+		for _, track := range tracks {
+			pc.Extras["subtitles/"+filepath.Base(track.SRTPath)] = track.SRTPath
+			pc.Extras["subtitles/"+filepath.Base(track.VTTPath)] = track.VTTPath
+		}
+		pc.Languages = subtitleLanguages(tracks)
+	}
+
+	if paramBool(params, "chapters", true) {
+		chaptersPath := filepath.Join(pc.WorkDir, "chapters.json")
+		chapters, err := ps.writeChapters(chaptersPath, probe)
+		if err != nil {
+			log.Printf("Aviso: erro ao exportar capítulos do vídeo %s: %v", pc.Msg.VideoID, err)
+		} else if len(chapters) > 0 {
+			pc.Extras["chapters.json"] = chaptersPath
+			pc.ChapterCount = len(chapters)
+		}
+	}
+
+	log.Printf("Vídeo %s: legendas %v, %d capítulos", pc.Msg.VideoID, pc.Languages, pc.ChapterCount)
+	return nil
+}
+
+func runExtractStage(ps *ProcessingService, pc *pipelineContext, params map[string]interface{}) error {
+	pc.FramesDir = filepath.Join(pc.WorkDir, "frames")
+	if err := os.MkdirAll(pc.FramesDir, 0755); err != nil {
+		return fmt.Errorf("erro ao criar diretório de frames: %v", err)
+	}
+
+	// Overlay do job aplicado no próprio ffmpeg quando não há etapa overlay
+	var overlay *overlaySpec
+	if !pc.HasOverlayStage {
+		spec, err := ps.prepareOverlay(pc.Ctx, pc.Msg.Overlay, pc.Msg.VideoID, pc.Msg.UserID, pc.WorkDir)
+		if err != nil {
+			return newProcessingError(ErrInvalidJob, "erro ao preparar overlay: %v", err)
+		}
+		overlay = spec
+	}
+
+	// Pipeline sem probe: as dimensões vêm do primeiro frame extraído e o
+	// overlay é aplicado depois da extração
+	var lateOverlay *overlaySpec
+	if overlay != nil && !pc.Probe.hasDimensions() {
+		lateOverlay, overlay = overlay, nil
+	}
+
+	pc.FPS = paramFloat(params, "fps", 1)
+	frameCount, err := ps.Extractor.ExtractFrames(pc.Ctx, pc.VideoPath, pc.FramesDir, pc.FPS, overlay, pc.Probe)
+	if err != nil {
+		return fmt.Errorf("erro ao extrair frames: %w", err)
+	}
+	if frameCount == 0 {
+		return newProcessingError(ErrNoFrames, "nenhum frame foi extraído do vídeo")
+	}
+	if lateOverlay != nil {
+		if err := ps.applyOverlayToFrames(pc.Ctx, pc.FramesDir, pc.FPS, lateOverlay); err != nil {
+			return err
+		}
+	}
+
+	pc.FrameCount = frameCount
+	log.Printf("Extraídos %d frames do vídeo %s", frameCount, pc.Msg.VideoID)
+	return nil
+}
+
+// Filtros de imagem permitidos na etapa filter
+func frameFilter(params map[string]interface{}) (string, error) {
+	name := paramString(params, "name", "")
+	switch name {
+	case "grayscale":
+		return "format=gray", nil
+	case "negate":
+		return "negate", nil
+	case "denoise":
+		return "hqdn3d", nil
+	case "blur":
+		strength := paramFloat(params, "strength", 2)
+		if strength <= 0 || strength > 20 {
+			return "", fmt.Errorf("strength do blur deve estar entre 0 e 20")
+		}
+		return fmt.Sprintf("boxblur=%g", strength), nil
+	case "sharpen":
+		strength := paramFloat(params, "strength", 1)
+		if strength <= 0 || strength > 5 {
+			return "", fmt.Errorf("strength do sharpen deve estar entre 0 e 5")
+		}
+		return fmt.Sprintf("unsharp=5:5:%g", strength), nil
+	default:
+		return "", fmt.Errorf("filtro desconhecido %q (use grayscale, negate, denoise, blur ou sharpen)", name)
+	}
+}
+
+func runFilterStage(ps *ProcessingService, pc *pipelineContext, params map[string]interface{}) error {
+	filter, err := frameFilter(params)
+	if err != nil {
+		return err
+	}
+	return ps.Extractor.TransformFrames(pc.Ctx, pc.FramesDir, pc.FPS, nil, "[0:v]"+filter+"[out]")
+}
+
+func runResizeStage(ps *ProcessingService, pc *pipelineContext, params map[string]interface{}) error {
+	width, height := paramInt(params, "width", 0), paramInt(params, "height", 0)
+	if width == 0 {
+		width = -2
+	}
+	if height == 0 {
+		height = -2
+	}
+	return ps.Extractor.TransformFrames(pc.Ctx, pc.FramesDir, pc.FPS, nil, fmt.Sprintf("[0:v]scale=%d:%d[out]", width, height))
+}
+
+// Converter parâmetros da etapa overlay em OverlayOptions
+func overlayFromParams(params map[string]interface{}) (*OverlayOptions, error) {
+	data, err := json.Marshal(params)
+	if err != nil {
+		return nil, err
+	}
+	var options OverlayOptions
+	if err := json.Unmarshal(data, &options); err != nil {
+		return nil, fmt.Errorf("parâmetros de overlay inválidos: %v", err)
+	}
+	if options.Type != "image" && options.Type != "text" {
+		return nil, fmt.Errorf("tipo de overlay inválido: %q (use image ou text)", options.Type)
+	}
+	if options.Type == "text" && options.Text == "" {
+		return nil, fmt.Errorf("overlay de texto requer o campo text")
+	}
+	return &options, nil
+}
+
+func runOverlayStage(ps *ProcessingService, pc *pipelineContext, params map[string]interface{}) error {
+	options := pc.Msg.Overlay
+	if len(params) > 0 {
+		parsed, err := overlayFromParams(params)
+		if err != nil {
+			return err
+		}
+		options = parsed
+	}
+	if options == nil {
+		return newProcessingError(ErrInvalidJob, "nenhum overlay configurado para o job")
+	}
+
+	spec, err := ps.prepareOverlay(pc.Ctx, options, pc.Msg.VideoID, pc.Msg.UserID, pc.WorkDir)
+	if err != nil {
+		return newProcessingError(ErrInvalidJob, "erro ao preparar overlay: %v", err)
+	}
+	return ps.applyOverlayToFrames(pc.Ctx, pc.FramesDir, pc.FPS, spec)
+}
+
+func runDedupStage(ps *ProcessingService, pc *pipelineContext, params map[string]interface{}) error {
+	removed, err := dedupFrames(pc.FramesDir, paramInt(params, "threshold", 5))
+	if err != nil {
+		return err
+	}
+	pc.FrameCount -= removed
+	log.Printf("Vídeo %s: %d frames duplicados removidos", pc.Msg.VideoID, removed)
+	return nil
+}
+
+func runArchiveStage(ps *ProcessingService, pc *pipelineContext, params map[string]interface{}) error {
+	pc.ZipPath = filepath.Join(pc.WorkDir, fmt.Sprintf("frames_%s.zip", pc.Msg.VideoID))
+	if err := ps.createZipFromFrames(pc.FramesDir, pc.ZipPath, pc.Extras); err != nil {
+		return fmt.Errorf("erro ao criar ZIP: %v", err)
+	}
+	return nil
+}
+
+func runUploadStage(ps *ProcessingService, pc *pipelineContext, params map[string]interface{}) error {
+	pc.ZipObject = versionedObject("frames", pc.Msg, "zip")
+	size, err := ps.uploadZipToMinio(pc.Ctx, pc.ZipPath, pc.ZipObject)
+	if err != nil {
+		return fmt.Errorf("erro ao fazer upload do ZIP: %v", err)
+	}
+	pc.ZipSize = size
+	log.Printf("ZIP criado e enviado com sucesso: %s (%d bytes)", pc.ZipObject, size)
+
+	objects := make([]string, 0, len(pc.Uploads))
+	for object := range pc.Uploads {
+		objects = append(objects, object)
+	}
+	sort.Strings(objects)
+	for _, object := range objects {
+		if _, err := ps.uploadFileToMinio(pc.Ctx, pc.Uploads[object], object, mime.TypeByExtension(filepath.Ext(object))); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Nome do objeto de saída: a primeira execução mantém frames_{id}.zip e os
+// reprocessamentos ganham sufixo de versão (frames_{id}_v2.zip)
+func versionedObject(prefix string, msg ProcessingMessage, ext string) string {
+	if msg.Version > 1 {
+		return fmt.Sprintf("%s_%s_v%d.%s", prefix, msg.VideoID, msg.Version, ext)
+	}
+	return fmt.Sprintf("%s_%s.%s", prefix, msg.VideoID, ext)
+}
+
+// Remover frames quase idênticos ao anterior mantido (hash médio 8x8) e
+// renumerar os restantes para manter a sequência contínua
+func dedupFrames(framesDir string, threshold int) (int, error) {
+	frames, err := filepath.Glob(filepath.Join(framesDir, "*.png"))
+	if err != nil {
+		return 0, fmt.Errorf("erro ao listar frames: %v", err)
+	}
+	sort.Strings(frames)
+
+	var kept []string
+	var lastHash uint64
+	removed := 0
+	for i, frame := range frames {
+		hash, err := averageHash(frame)
+		if err != nil {
+			return 0, err
+		}
+		if i > 0 && hammingDistance(hash, lastHash) <= threshold {
+			if err := os.Remove(frame); err != nil {
+				return 0, fmt.Errorf("erro ao remover frame duplicado: %v", err)
+			}
+			removed++
+			continue
+		}
+		lastHash = hash
+		kept = append(kept, frame)
+	}
+
+	for i, frame := range kept {
+		target := filepath.Join(framesDir, fmt.Sprintf("frame_%04d.png", i+1))
+		if frame == target {
+			continue
+		}
+		if err := os.Rename(frame, target); err != nil {
+			return 0, fmt.Errorf("erro ao renumerar frames: %v", err)
+		}
+	}
+
+	return removed, nil
+}
+
+func averageHash(path string) (uint64, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer file.Close()
+
+	img, _, err := image.Decode(file)
+	if err != nil {
+		return 0, fmt.Errorf("erro ao decodificar %s: %v", filepath.Base(path), err)
+	}
+
+	// Luminância média de cada célula de uma grade 8x8 (amostrada em 4x4 pontos)
+	bounds := img.Bounds()
+	var cells [64]float64
+	var total float64
+	for cy := 0; cy < 8; cy++ {
+		for cx := 0; cx < 8; cx++ {
+			var sum float64
+			for sy := 0; sy < 4; sy++ {
+				for sx := 0; sx < 4; sx++ {
+					x := bounds.Min.X + (cx*4+sx)*bounds.Dx()/32
+					y := bounds.Min.Y + (cy*4+sy)*bounds.Dy()/32
+					r, g, b, _ := img.At(x, y).RGBA()
+					sum += 0.299*float64(r) + 0.587*float64(g) + 0.114*float64(b)
+				}
+			}
+			cells[cy*8+cx] = sum / 16
+			total += sum / 16
+		}
+	}
+
+	mean := total / 64
+	var hash uint64
+	for i, value := range cells {
+		if value > mean {
+			hash |= 1 << uint(i)
+		}
+	}
+	return hash, nil
+}
+
+func hammingDistance(a, b uint64) int {
+	distance := 0
+	for x := a ^ b; x != 0; x &= x - 1 {
+		distance++
+	}
+	return distance
+}
+
+// Validar que só parâmetros conhecidos, com o tipo esperado, foram informados
+func validateParams(schema map[string]string) func(map[string]interface{}) error {
+	return func(params map[string]interface{}) error {
+		for key, value := range params {
+			kind, ok := schema[key]
+			if !ok {
+				return fmt.Errorf("parâmetro desconhecido %q", key)
+			}
+			valid := false
+			switch kind {
+			case "bool":
+				_, valid = value.(bool)
+			case "number":
+				_, valid = value.(float64)
+			case "string":
+				_, valid = value.(string)
+			}
+			if !valid {
+				return fmt.Errorf("parâmetro %q deve ser do tipo %s", key, kind)
+			}
+		}
+		return nil
+	}
+}
+
+func paramFloat(params map[string]interface{}, key string, defaultValue float64) float64 {
+	if value, ok := params[key].(float64); ok {
+		return value
+	}
+	return defaultValue
+}
+
+func paramInt(params map[string]interface{}, key string, defaultValue int) int {
+	return int(paramFloat(params, key, float64(defaultValue)))
+}
+
+func paramString(params map[string]interface{}, key, defaultValue string) string {
+	if value, ok := params[key].(string); ok {
+		return value
+	}
+	return defaultValue
+}
+
+func paramBool(params map[string]interface{}, key string, defaultValue bool) bool {
+	if value, ok := params[key].(bool); ok {
+		return value
+	}
+	return defaultValue
+}
+
+// Handler para validar um pipeline antes de enfileirar o job
+func (ps *ProcessingService) ValidatePipelineHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	var pipeline Pipeline
+	if err := json.NewDecoder(r.Body).Decode(&pipeline); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]interface{}{"valid": false, "error": "JSON inválido: " + err.Error()})
+		return
+	}
+
+	if err := pipeline.Validate(); err != nil {
+		w.WriteHeader(http.StatusUnprocessableEntity)
+		json.NewEncoder(w).Encode(map[string]interface{}{"valid": false, "error": err.Error()})
+		return
+	}
+
+	json.NewEncoder(w).Encode(map[string]interface{}{"valid": true, "stages": pipeline.stageTypes()})
+}
+
+// Handler que lista as etapas registradas e o pipeline padrão
+func (ps *ProcessingService) PipelineStagesHandler(w http.ResponseWriter, r *http.Request) {
+	stages := make([]string, 0, len(stageRegistry))
+	for name := range stageRegistry {
+		stages = append(stages, name)
+	}
+	sort.Strings(stages)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"stages":  stages,
+		"default": defaultPipeline(),
+	})
+}
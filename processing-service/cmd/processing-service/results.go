@@ -0,0 +1,145 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/minio/minio-go/v7"
+)
+
+// Índice dos resultados concluídos no bucket video-processed, chaveado pelo
+// SHA-256 do original e pela forma canônica das opções do job
+const resultsIndexPrefix = "results-index/"
+
+// Reuso de resultados entre uploads idênticos
+type ResultCache interface {
+	// Resultado registrado para a chave; nil se não houver
+	Lookup(ctx context.Context, key string) (*ProcessingResult, error)
+	Store(ctx context.Context, key string, result ProcessingResult) error
+}
+
+// Índice de resultados guardado como JSON no MinIO
+type minioResultCache struct {
+	client *minio.Client
+}
+
+func (c *minioResultCache) Lookup(ctx context.Context, key string) (*ProcessingResult, error) {
+	object, err := c.client.GetObject(ctx, "video-processed", resultsIndexPrefix+key+".json", minio.GetObjectOptions{})
+	if err != nil {
+		return nil, err
+	}
+	defer object.Close()
+
+	var result ProcessingResult
+	if err := json.NewDecoder(object).Decode(&result); err != nil {
+		if minio.ToErrorResponse(err).Code == "NoSuchKey" {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("erro ao ler índice de resultados: %v", err)
+	}
+	return &result, nil
+}
+
+func (c *minioResultCache) Store(ctx context.Context, key string, result ProcessingResult) error {
+	data, err := json.Marshal(result)
+	if err != nil {
+		return fmt.Errorf("erro ao serializar resultado: %v", err)
+	}
+	_, err = c.client.PutObject(ctx, "video-processed", resultsIndexPrefix+key+".json", bytes.NewReader(data), int64(len(data)), minio.PutObjectOptions{
+		ContentType: "application/json",
+	})
+	return err
+}
+
+// Chave do resultado: hash do conteúdo + pipeline efetivo + overlay. Overlays
+// de texto com template ({video_id}, {timestamp}) geram frames diferentes por
+// vídeo e não são reaproveitados; a marca d'água de imagem é do usuário
+func resultCacheKey(msg ProcessingMessage, pipeline Pipeline) (string, bool) {
+	if msg.ContentHash == "" {
+		return "", false
+	}
+
+	owner := ""
+	if msg.Overlay != nil {
+		switch {
+		case msg.Overlay.Type == "text" && strings.Contains(msg.Overlay.Text, "{"):
+			return "", false
+		case msg.Overlay.Type == "image":
+			owner = msg.UserID
+		}
+	}
+
+	// encoding/json ordena as chaves dos mapas, então params equivalentes
+	// serializam igual
+	canonical, err := json.Marshal(struct {
+		ContentHash string          `json:"content_hash"`
+		JobType     string          `json:"job_type"`
+		Pipeline    Pipeline        `json:"pipeline"`
+		Overlay     *OverlayOptions `json:"overlay"`
+		Owner       string          `json:"owner,omitempty"`
+	}{msg.ContentHash, JobTypeFrames, pipeline, msg.Overlay, owner})
+	if err != nil {
+		return "", false
+	}
+
+	sum := sha256.Sum256(canonical)
+	return hex.EncodeToString(sum[:]), true
+}
+
+// Concluir o job copiando as saídas de um resultado idêntico já processado.
+// Se algum objeto de origem não existir mais (vídeo removido, versão podada),
+// retorna erro e o job segue pelo pipeline normal
+func (ps *ProcessingService) reuseResult(ctx context.Context, msg ProcessingMessage, cached *ProcessingResult, result *ProcessingResult) error {
+	copies := map[string]string{cached.ZipObjectName: versionedObject("frames", msg, "zip")}
+	metadata := make(map[string]interface{}, len(cached.Metadata)+2)
+	for key, value := range cached.Metadata {
+		metadata[key] = value
+	}
+	if source, ok := cached.Metadata["shots_object"].(string); ok && source != "" {
+		copies[source] = versionedObject("shots", msg, "json")
+		metadata["shots_object"] = copies[source]
+	}
+	if source, ok := cached.Metadata["shots_csv_object"].(string); ok && source != "" {
+		copies[source] = versionedObject("shots", msg, "csv")
+		metadata["shots_csv_object"] = copies[source]
+	}
+
+	for source, target := range copies {
+		_, err := ps.Objects.CopyObject(ctx,
+			minio.CopyDestOptions{Bucket: "video-processed", Object: target},
+			minio.CopySrcOptions{Bucket: "video-processed", Object: source})
+		if err != nil {
+			return fmt.Errorf("erro ao copiar %s: %v", source, err)
+		}
+	}
+
+	metadata["original_filename"] = msg.Filename
+	metadata["cache_hit"] = true
+	metadata["cache_source"] = cached.VideoID
+
+	result.Status = "completed"
+	result.FrameCount = cached.FrameCount
+	result.ZipSize = cached.ZipSize
+	result.ZipObjectName = versionedObject("frames", msg, "zip")
+	result.Metadata = metadata
+	return nil
+}
+
+// Procurar um resultado reaproveitável para o job
+func (ps *ProcessingService) cachedResult(ctx context.Context, key string) *ProcessingResult {
+	cached, err := ps.Results.Lookup(ctx, key)
+	if err != nil {
+		log.Printf("Erro ao consultar índice de resultados: %v", err)
+		return nil
+	}
+	if cached == nil || cached.Status != "completed" || cached.ZipObjectName == "" {
+		return nil
+	}
+	return cached
+}
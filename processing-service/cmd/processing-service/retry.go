@@ -0,0 +1,99 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"strconv"
+	"time"
+
+	"github.com/streadway/amqp"
+)
+
+// Prefixo das filas onde jobs com falha transitória aguardam o backoff, uma
+// por passo (video_processing_retry.<ms>)
+const retryQueue = "video_processing_retry"
+
+// Header com o número da tentativa atual do job
+const attemptHeader = "x-attempt"
+
+func maxJobAttempts() int {
+	attempts, err := strconv.Atoi(getEnv("MAX_JOB_ATTEMPTS", "3"))
+	if err != nil || attempts < 1 {
+		return 3
+	}
+	return attempts
+}
+
+// Tempo máximo de um job (WORKER_TIMEOUT, em segundos) antes de falhar com TIMEOUT
+func jobTimeout() time.Duration {
+	seconds, err := strconv.Atoi(getEnv("WORKER_TIMEOUT", "1800"))
+	if err != nil || seconds <= 0 {
+		log.Printf("WORKER_TIMEOUT inválido, usando 1800s")
+		return 30 * time.Minute
+	}
+	return time.Duration(seconds) * time.Second
+}
+
+// Backoff exponencial a partir de RETRY_BACKOFF (padrão 30s)
+func retryBackoff(attempt int) time.Duration {
+	base, err := time.ParseDuration(getEnv("RETRY_BACKOFF", "30s"))
+	if err != nil || base <= 0 {
+		base = 30 * time.Second
+	}
+	return base * time.Duration(1<<uint(attempt-1))
+}
+
+// Fila de espera de um passo do backoff. O TTL é da fila e não da mensagem:
+// o RabbitMQ só expira mensagens do início da fila, então prazos diferentes na
+// mesma fila fariam uma espera longa segurar as curtas enfileiradas atrás dela.
+// O prazo entra no nome para que mudar RETRY_BACKOFF crie filas novas em vez
+// de conflitar com o x-message-ttl das existentes
+func delayQueueName(prefix string, delay time.Duration) string {
+	return fmt.Sprintf("%s.%d", prefix, delay.Milliseconds())
+}
+
+// Declarar as filas de espera das tentativas 1 a steps; ao expirar, a
+// mensagem volta para target
+func declareDelayQueues(ch *amqp.Channel, prefix, target string, steps int) error {
+	for attempt := 1; attempt <= steps; attempt++ {
+		delay := retryBackoff(attempt)
+		_, err := ch.QueueDeclare(delayQueueName(prefix, delay), true, false, false, false, amqp.Table{
+			"x-message-ttl":             delay.Milliseconds(),
+			"x-dead-letter-exchange":    "",
+			"x-dead-letter-routing-key": target,
+		})
+		if err != nil {
+			return fmt.Errorf("erro ao declarar fila de espera %s: %v", delayQueueName(prefix, delay), err)
+		}
+	}
+	return nil
+}
+
+func deliveryAttempt(msg amqp.Delivery) int {
+	switch value := msg.Headers[attemptHeader].(type) {
+	case int32:
+		return int(value)
+	case int64:
+		return int(value)
+	case int:
+		return value
+	}
+	return 1
+}
+
+// Publicar o job na fila de espera da tentativa; ao expirar o TTL ele volta
+// para video_processing
+func (ps *ProcessingService) scheduleRetry(body []byte, attempt int) error {
+	queue := delayQueueName(retryQueue, retryBackoff(attempt))
+	return ps.Publisher.Publish(
+		"",    // exchange
+		queue, // routing key
+		false, // mandatory
+		false, // immediate
+		amqp.Publishing{
+			ContentType:  "application/json",
+			DeliveryMode: amqp.Persistent,
+			Headers:      amqp.Table{attemptHeader: int32(attempt + 1)},
+			Body:         body,
+		})
+}
@@ -0,0 +1,177 @@
+package main
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// Mudança de cena detectada no vídeo (filtro scene do ffmpeg)
+type SceneChange struct {
+	Time  float64 // segundos
+	Score float64 // 0 a 1
+}
+
+// Shot exportado em shots.json e shots.csv
+type Shot struct {
+	Index    int     `json:"index"`
+	Start    float64 `json:"start"`
+	End      float64 `json:"end"`
+	Duration float64 `json:"duration"`
+	Score    float64 `json:"score"` // score da mudança de cena que abre o shot (0 no primeiro)
+	Frame    string  `json:"frame"` // frame representativo dentro do ZIP
+}
+
+func validateScenesParams(params map[string]interface{}) error {
+	if err := validateParams(map[string]string{"threshold": "number"})(params); err != nil {
+		return err
+	}
+	threshold := paramFloat(params, "threshold", 0.3)
+	if threshold <= 0 || threshold >= 1 {
+		return fmt.Errorf("threshold deve estar entre 0 e 1")
+	}
+	return nil
+}
+
+// Detectar mudanças de cena e exportar a lista de shots (JSON e CSV) com um
+// frame representativo por shot, no ZIP e como objetos próprios no MinIO
+func runScenesStage(ps *ProcessingService, pc *pipelineContext, params map[string]interface{}) error {
+	changes, err := ps.Scenes.DetectScenes(pc.Ctx, pc.VideoPath, paramFloat(params, "threshold", 0.3))
+	if err != nil {
+		return fmt.Errorf("erro na detecção de cenas: %w", err)
+	}
+
+	duration := pc.Msg.Duration
+	if pc.Probe != nil && pc.Probe.duration() > 0 {
+		duration = pc.Probe.duration()
+	}
+	shots := buildShots(changes, duration)
+
+	shotsDir := filepath.Join(pc.WorkDir, "shots")
+	if err := os.MkdirAll(shotsDir, 0755); err != nil {
+		return fmt.Errorf("erro ao criar diretório de shots: %v", err)
+	}
+	for i := range shots {
+		name := fmt.Sprintf("shot_%04d.png", shots[i].Index)
+		path := filepath.Join(shotsDir, name)
+		if err := ps.Scenes.ExtractFrameAt(pc.Ctx, pc.VideoPath, (shots[i].Start+shots[i].End)/2, path); err != nil {
+			return fmt.Errorf("erro ao extrair frame do shot %d: %w", shots[i].Index, err)
+		}
+		shots[i].Frame = "shots/" + name
+		pc.Extras[shots[i].Frame] = path
+	}
+
+	jsonPath := filepath.Join(pc.WorkDir, "shots.json")
+	csvPath := filepath.Join(pc.WorkDir, "shots.csv")
+	if err := writeShotsJSON(jsonPath, shots); err != nil {
+		return err
+	}
+	if err := writeShotsCSV(csvPath, shots); err != nil {
+		return err
+	}
+
+	pc.Extras["shots.json"] = jsonPath
+	pc.Extras["shots.csv"] = csvPath
+	pc.Uploads[versionedObject("shots", pc.Msg, "json")] = jsonPath
+	pc.Uploads[versionedObject("shots", pc.Msg, "csv")] = csvPath
+	pc.ShotCount = len(shots)
+
+	log.Printf("Vídeo %s: %d shots detectados", pc.Msg.VideoID, len(shots))
+	return nil
+}
+
+// Converter mudanças de cena em shots contíguos cobrindo o vídeo inteiro
+func buildShots(changes []SceneChange, duration float64) []Shot {
+	shots := []Shot{{Index: 1}}
+	for _, change := range changes {
+		last := &shots[len(shots)-1]
+		if change.Time <= last.Start || (duration > 0 && change.Time >= duration) {
+			continue
+		}
+		last.End = change.Time
+		shots = append(shots, Shot{Index: len(shots) + 1, Start: change.Time, Score: change.Score})
+	}
+
+	last := &shots[len(shots)-1]
+	last.End = duration
+	if last.End < last.Start {
+		last.End = last.Start
+	}
+
+	for i := range shots {
+		shots[i].Duration = shots[i].End - shots[i].Start
+	}
+	return shots
+}
+
+func writeShotsJSON(path string, shots []Shot) error {
+	data, err := json.MarshalIndent(shots, "", "  ")
+	if err != nil {
+		return fmt.Errorf("erro ao serializar shots: %v", err)
+	}
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		return fmt.Errorf("erro ao gravar shots.json: %v", err)
+	}
+	return nil
+}
+
+func writeShotsCSV(path string, shots []Shot) error {
+	file, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("erro ao criar shots.csv: %v", err)
+	}
+	defer file.Close()
+
+	writer := csv.NewWriter(file)
+	writer.Write([]string{"index", "start", "end", "duration", "score", "frame"})
+	for _, shot := range shots {
+		writer.Write([]string{
+			strconv.Itoa(shot.Index),
+			strconv.FormatFloat(shot.Start, 'f', 3, 64),
+			strconv.FormatFloat(shot.End, 'f', 3, 64),
+			strconv.FormatFloat(shot.Duration, 'f', 3, 64),
+			strconv.FormatFloat(shot.Score, 'f', 4, 64),
+			shot.Frame,
+		})
+	}
+	writer.Flush()
+	if err := writer.Error(); err != nil {
+		return fmt.Errorf("erro ao gravar shots.csv: %v", err)
+	}
+	return nil
+}
+
+// Interpretar a saída do filtro metadata=print do ffmpeg:
+//
+//	frame:0    pts:375     pts_time:15.015
+//	lavfi.scene_score=0.612345
+func parseSceneMetadata(output string) []SceneChange {
+	var changes []SceneChange
+	var current *SceneChange
+
+	scanner := bufio.NewScanner(strings.NewReader(output))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		switch {
+		case strings.HasPrefix(line, "frame:"):
+			current = nil
+			for _, field := range strings.Fields(line) {
+				if value, ok := strings.CutPrefix(field, "pts_time:"); ok {
+					if t, err := strconv.ParseFloat(value, 64); err == nil {
+						changes = append(changes, SceneChange{Time: t})
+						current = &changes[len(changes)-1]
+					}
+				}
+			}
+		case strings.HasPrefix(line, "lavfi.scene_score=") && current != nil:
+			current.Score, _ = strconv.ParseFloat(strings.TrimPrefix(line, "lavfi.scene_score="), 64)
+		}
+	}
+	return changes
+}
@@ -0,0 +1,203 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// Saída do ffprobe com streams e capítulos do container
+type ProbeOutput struct {
+	Streams  []ProbeStream  `json:"streams"`
+	Chapters []ProbeChapter `json:"chapters"`
+	Format   ProbeFormat    `json:"format"`
+}
+
+type ProbeFormat struct {
+	Duration string `json:"duration"`
+}
+
+type ProbeStream struct {
+	Index     int               `json:"index"`
+	CodecType string            `json:"codec_type"`
+	CodecName string            `json:"codec_name"`
+	Width     int               `json:"width"`
+	Height    int               `json:"height"`
+	Tags      map[string]string `json:"tags"`
+}
+
+type ProbeChapter struct {
+	ID        int64             `json:"id"`
+	StartTime string            `json:"start_time"`
+	EndTime   string            `json:"end_time"`
+	Tags      map[string]string `json:"tags"`
+}
+
+// Capítulo exportado em chapters.json
+type Chapter struct {
+	Index int     `json:"index"`
+	Title string  `json:"title"`
+	Start float64 `json:"start"`
+	End   float64 `json:"end"`
+}
+
+// Legenda exportada em SRT e WebVTT
+type SubtitleTrack struct {
+	Language    string `json:"language"`
+	StreamIndex int    `json:"stream_index"`
+	Codec       string `json:"codec"`
+	SRTPath     string `json:"-"`
+	VTTPath     string `json:"-"`
+}
+
+// Codecs de legenda baseados em imagem não podem ser convertidos para texto
+var bitmapSubtitleCodecs = map[string]bool{
+	"hdmv_pgs_subtitle": true,
+	"dvd_subtitle":      true,
+	"dvb_subtitle":      true,
+	"dvb_teletext":      true,
+	"xsub":              true,
+}
+
+// Exportar cada stream de legenda de texto como SRT e WebVTT; uma faixa que
+// falha é registrada e ignorada, sem descartar as já convertidas
+func (ps *ProcessingService) extractSubtitles(ctx context.Context, videoPath, outputDir string, probe *ProbeOutput) ([]SubtitleTrack, error) {
+	var tracks []SubtitleTrack
+	usedNames := make(map[string]int)
+
+	for _, stream := range probe.Streams {
+		if stream.CodecType != "subtitle" {
+			continue
+		}
+		if bitmapSubtitleCodecs[stream.CodecName] {
+			log.Printf("Legenda %d ignorada: codec de imagem %s", stream.Index, stream.CodecName)
+			continue
+		}
+
+		if len(tracks) == 0 {
+			if err := os.MkdirAll(outputDir, 0755); err != nil {
+				return nil, fmt.Errorf("erro ao criar diretório de legendas: %v", err)
+			}
+		}
+
+		language := streamLanguage(stream)
+		name := language
+		usedNames[language]++
+		if usedNames[language] > 1 {
+			name = fmt.Sprintf("%s_%d", language, usedNames[language])
+		}
+
+		track := SubtitleTrack{
+			Language:    language,
+			StreamIndex: stream.Index,
+			Codec:       stream.CodecName,
+			SRTPath:     filepath.Join(outputDir, name+".srt"),
+			VTTPath:     filepath.Join(outputDir, name+".vtt"),
+		}
+
+		err := ps.Prober.ConvertSubtitle(ctx, videoPath, stream.Index, "srt", track.SRTPath)
+		if err == nil {
+			err = ps.Prober.ConvertSubtitle(ctx, videoPath, stream.Index, "webvtt", track.VTTPath)
+		}
+		if err != nil {
+			// Job cancelado ou expirado: as demais faixas falhariam da mesma forma
+			if ctx.Err() != nil {
+				return tracks, ctx.Err()
+			}
+			log.Printf("Legenda %d ignorada: %v", stream.Index, err)
+			os.Remove(track.SRTPath)
+			os.Remove(track.VTTPath)
+			continue
+		}
+
+		tracks = append(tracks, track)
+	}
+
+	return tracks, nil
+}
+
+// Gravar capítulos do container em JSON; retorna os capítulos exportados
+func (ps *ProcessingService) writeChapters(outputPath string, probe *ProbeOutput) ([]Chapter, error) {
+	if len(probe.Chapters) == 0 {
+		return nil, nil
+	}
+
+	chapters := make([]Chapter, 0, len(probe.Chapters))
+	for i, c := range probe.Chapters {
+		start, _ := strconv.ParseFloat(c.StartTime, 64)
+		end, _ := strconv.ParseFloat(c.EndTime, 64)
+
+		title := c.Tags["title"]
+		if title == "" {
+			title = fmt.Sprintf("Capítulo %d", i+1)
+		}
+
+		chapters = append(chapters, Chapter{
+			Index: i + 1,
+			Title: title,
+			Start: start,
+			End:   end,
+		})
+	}
+
+	data, err := json.MarshalIndent(chapters, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("erro ao serializar capítulos: %v", err)
+	}
+
+	if err := os.WriteFile(outputPath, data, 0644); err != nil {
+		return nil, fmt.Errorf("erro ao gravar capítulos: %v", err)
+	}
+
+	return chapters, nil
+}
+
+// Dimensões do primeiro stream de vídeo
+func (p *ProbeOutput) videoDimensions() (int, int) {
+	for _, stream := range p.Streams {
+		if stream.CodecType == "video" {
+			return stream.Width, stream.Height
+		}
+	}
+	return 0, 0
+}
+
+// Largura e altura do vídeo conhecidas (probe pode ser nil)
+func (p *ProbeOutput) hasDimensions() bool {
+	if p == nil {
+		return false
+	}
+	width, height := p.videoDimensions()
+	return width > 0 && height > 0
+}
+
+// Duração do container em segundos (0 se desconhecida)
+func (p *ProbeOutput) duration() float64 {
+	duration, _ := strconv.ParseFloat(p.Format.Duration, 64)
+	return duration
+}
+
+func streamLanguage(stream ProbeStream) string {
+	language := strings.ToLower(strings.TrimSpace(stream.Tags["language"]))
+	if language == "" {
+		return "und"
+	}
+	return language
+}
+
+func subtitleLanguages(tracks []SubtitleTrack) []string {
+	seen := make(map[string]bool)
+	var languages []string
+	for _, track := range tracks {
+		if !seen[track.Language] {
+			seen[track.Language] = true
+			languages = append(languages, track.Language)
+		}
+	}
+	return languages
+}
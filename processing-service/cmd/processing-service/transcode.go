@@ -0,0 +1,259 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/minio/minio-go/v7"
+)
+
+// Tipos de job aceitos na fila video_processing
+const (
+	JobTypeFrames    = "frames"
+	JobTypeTranscode = "transcode"
+	JobTypeBatch     = "batch" // finalizador de lote, enfileirado pelo storage-service
+)
+
+// Perfil de uma rendição MP4/HLS
+type RenditionProfile struct {
+	Name         string
+	Height       int
+	VideoBitrate int // kbps
+	AudioBitrate int // kbps
+}
+
+// Escada de rendições suportada, da menor para a maior
+var renditionLadder = []RenditionProfile{
+	{Name: "360p", Height: 360, VideoBitrate: 800, AudioBitrate: 96},
+	{Name: "720p", Height: 720, VideoBitrate: 2800, AudioBitrate: 128},
+	{Name: "1080p", Height: 1080, VideoBitrate: 5000, AudioBitrate: 192},
+}
+
+// Rendição gerada e enviada ao MinIO
+type Rendition struct {
+	Name            string `json:"name"`
+	Width           int    `json:"width"`
+	Height          int    `json:"height"`
+	ObjectName      string `json:"object_name"`
+	Size            int64  `json:"size"`
+	PlaylistObject  string `json:"playlist_object"`
+	BandwidthBitsPS int    `json:"bandwidth"`
+}
+
+func renditionObjectName(videoID, name string) string {
+	return fmt.Sprintf("%s_%s.mp4", videoID, name)
+}
+
+func hlsPrefix(videoID string) string {
+	return fmt.Sprintf("hls/%s/", videoID)
+}
+
+// Selecionar perfis pedidos no job (ou os padrão), sem ampliar além da altura de origem
+func selectRenditions(requested []string, sourceHeight int) []RenditionProfile {
+	if len(requested) == 0 {
+		requested = strings.Split(getEnv("DEFAULT_RENDITIONS", "360p,720p,1080p"), ",")
+	}
+
+	wanted := make(map[string]bool)
+	for _, name := range requested {
+		wanted[strings.TrimSpace(name)] = true
+	}
+
+	var profiles []RenditionProfile
+	for _, profile := range renditionLadder {
+		if !wanted[profile.Name] {
+			continue
+		}
+		if sourceHeight > 0 && profile.Height > sourceHeight {
+			log.Printf("Rendição %s ignorada: maior que a altura de origem (%dp)", profile.Name, sourceHeight)
+			continue
+		}
+		profiles = append(profiles, profile)
+	}
+
+	// Vídeo menor que todas as rendições pedidas: gerar ao menos a menor delas
+	if len(profiles) == 0 && len(requested) > 0 {
+		for _, profile := range renditionLadder {
+			if wanted[profile.Name] {
+				profiles = append(profiles, profile)
+				break
+			}
+		}
+	}
+
+	return profiles
+}
+
+// Job de transcodificação: gera rendições MP4 e uma escada HLS com playlist master
+func (ps *ProcessingService) transcodeVideo(ctx context.Context, msg ProcessingMessage, events *jobEvents) ProcessingResult {
+	result := ProcessingResult{
+		VideoID:     msg.VideoID,
+		JobType:     JobTypeTranscode,
+		ProcessedAt: time.Now(),
+		UserID:      msg.UserID,
+		Metadata:    make(map[string]interface{}),
+	}
+
+	log.Printf("Iniciando transcodificação do vídeo: %s", msg.VideoID)
+
+	tempDir, err := ps.prepareWorkDir(ctx, msg, transcodeWorkPrefix)
+	if err != nil {
+		log.Printf("Diretório de trabalho indisponível para vídeo %s: %v", msg.VideoID, err)
+		result.fail(classifyError(ctx, ErrWorkspaceFailed, err))
+		return result
+	}
+	defer os.RemoveAll(tempDir)
+
+	videoPath := filepath.Join(tempDir, msg.Filename)
+	err = ps.downloadVideoFromMinio(ctx, msg.Bucket, msg.ObjectName, videoPath)
+	if err != nil {
+		log.Printf("Erro ao baixar vídeo do MinIO: %v", err)
+		result.fail(classifyError(ctx, ErrDownloadFailed, err))
+		return result
+	}
+
+	probe, err := ps.Prober.Probe(ctx, videoPath)
+	if err != nil {
+		log.Printf("Erro ao inspecionar vídeo: %v", err)
+		result.fail(classifyError(ctx, ErrInvalidMedia, err))
+		return result
+	}
+	sourceWidth, sourceHeight := probe.videoDimensions()
+
+	profiles := selectRenditions(msg.Renditions, sourceHeight)
+	if len(profiles) == 0 {
+		result.fail(newProcessingError(ErrInvalidJob, "nenhuma rendição válida solicitada"))
+		return result
+	}
+
+	hlsDir := filepath.Join(tempDir, "hls")
+	var renditions []Rendition
+	for i, profile := range profiles {
+		rendition, err := ps.encodeRendition(ctx, msg.VideoID, videoPath, tempDir, hlsDir, profile, sourceWidth, sourceHeight)
+		if err != nil {
+			log.Printf("Erro ao gerar rendição %s: %v", profile.Name, err)
+			result.fail(classifyError(ctx, ErrTranscodeFailed, fmt.Errorf("rendição %s: %w", profile.Name, err)))
+			return result
+		}
+		renditions = append(renditions, *rendition)
+		events.progress(profile.Name, i+1, len(profiles)+1)
+	}
+
+	masterPath := filepath.Join(hlsDir, "master.m3u8")
+	if err := writeMasterPlaylist(masterPath, renditions); err != nil {
+		result.fail(newProcessingError(ErrTranscodeFailed, "erro ao gerar playlist master: %v", err))
+		return result
+	}
+
+	if err := ps.uploadDirToMinio(ctx, hlsDir, hlsPrefix(msg.VideoID)); err != nil {
+		log.Printf("Erro ao enviar HLS: %v", err)
+		result.fail(classifyError(ctx, ErrUploadFailed, err))
+		return result
+	}
+
+	names := make([]string, len(renditions))
+	for i, rendition := range renditions {
+		names[i] = rendition.Name
+	}
+
+	result.Status = "completed"
+	result.Metadata["original_filename"] = msg.Filename
+	result.Metadata["renditions"] = names
+	result.Metadata["rendition_details"] = renditions
+	result.Metadata["hls_master"] = hlsPrefix(msg.VideoID) + "master.m3u8"
+
+	log.Printf("Transcodificação concluída para %s: %v", msg.VideoID, names)
+	return result
+}
+
+func (ps *ProcessingService) encodeRendition(ctx context.Context, videoID, videoPath, workDir, hlsDir string, profile RenditionProfile, sourceWidth, sourceHeight int) (*Rendition, error) {
+	mp4Path := filepath.Join(workDir, renditionObjectName(videoID, profile.Name))
+
+	playlistDir := filepath.Join(hlsDir, profile.Name)
+	if err := os.MkdirAll(playlistDir, 0755); err != nil {
+		return nil, fmt.Errorf("erro ao criar diretório HLS: %v", err)
+	}
+	if err := ps.Transcoder.EncodeRendition(ctx, videoPath, mp4Path, playlistDir, profile); err != nil {
+		return nil, err
+	}
+
+	objectName := renditionObjectName(videoID, profile.Name)
+	size, err := ps.uploadFileToMinio(ctx, mp4Path, objectName, "video/mp4")
+	if err != nil {
+		return nil, err
+	}
+
+	width := 0
+	if sourceHeight > 0 {
+		width = (sourceWidth*profile.Height/sourceHeight + 1) &^ 1
+	}
+
+	return &Rendition{
+		Name:            profile.Name,
+		Width:           width,
+		Height:          profile.Height,
+		ObjectName:      objectName,
+		Size:            size,
+		PlaylistObject:  hlsPrefix(videoID) + profile.Name + "/index.m3u8",
+		BandwidthBitsPS: (profile.VideoBitrate + profile.AudioBitrate) * 1000,
+	}, nil
+}
+
+func writeMasterPlaylist(path string, renditions []Rendition) error {
+	var b strings.Builder
+	b.WriteString("#EXTM3U\n#EXT-X-VERSION:3\n")
+	for _, rendition := range renditions {
+		fmt.Fprintf(&b, "#EXT-X-STREAM-INF:BANDWIDTH=%d", rendition.BandwidthBitsPS)
+		if rendition.Width > 0 {
+			fmt.Fprintf(&b, ",RESOLUTION=%dx%d", rendition.Width, rendition.Height)
+		}
+		fmt.Fprintf(&b, "\n%s/index.m3u8\n", rendition.Name)
+	}
+	return os.WriteFile(path, []byte(b.String()), 0644)
+}
+
+func (ps *ProcessingService) uploadFileToMinio(ctx context.Context, path, objectName, contentType string) (int64, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return 0, fmt.Errorf("erro ao obter informações de %s: %v", filepath.Base(path), err)
+	}
+
+	_, err = ps.Objects.FPutObject(ctx, "video-processed", objectName, path, minio.PutObjectOptions{
+		ContentType: contentType,
+	})
+	if err != nil {
+		return 0, newProcessingError(ErrUploadFailed, "erro ao fazer upload de %s para MinIO: %v", objectName, err)
+	}
+
+	return info.Size(), nil
+}
+
+// Enviar todos os arquivos de um diretório mantendo a estrutura relativa
+func (ps *ProcessingService) uploadDirToMinio(ctx context.Context, dir, prefix string) error {
+	return filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() {
+			return err
+		}
+
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+
+		contentType := "application/octet-stream"
+		switch filepath.Ext(path) {
+		case ".m3u8":
+			contentType = "application/vnd.apple.mpegurl"
+		case ".ts":
+			contentType = "video/mp2t"
+		}
+
+		_, err = ps.uploadFileToMinio(ctx, path, prefix+filepath.ToSlash(rel), contentType)
+		return err
+	})
+}
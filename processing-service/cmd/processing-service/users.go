@@ -0,0 +1,111 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+)
+
+// Usuário retornado pela consulta interna do auth-service
+type UserInfo struct {
+	ID       int    `json:"id"`
+	Username string `json:"username"`
+	Email    string `json:"email"`
+}
+
+// Consulta de dados de contato do dono do vídeo
+type UserDirectory interface {
+	LookupUser(ctx context.Context, userID string) (*UserInfo, error)
+}
+
+// Usuário inexistente: não adianta tentar novamente
+var errUserNotFound = errors.New("usuário não encontrado")
+
+// Cliente do endpoint interno GET /internal/users/{id} do auth-service,
+// com timeout por chamada e cache em memória dos usuários encontrados
+type authUserClient struct {
+	baseURL string
+	token   string
+	client  *http.Client
+	ttl     time.Duration
+
+	mu    sync.Mutex
+	cache map[string]cachedUser
+}
+
+type cachedUser struct {
+	user      UserInfo
+	expiresAt time.Time
+}
+
+func newAuthUserClient() *authUserClient {
+	timeout, err := time.ParseDuration(getEnv("USER_LOOKUP_TIMEOUT", "5s"))
+	if err != nil || timeout <= 0 {
+		timeout = 5 * time.Second
+	}
+	ttl, err := time.ParseDuration(getEnv("USER_CACHE_TTL", "10m"))
+	if err != nil || ttl < 0 {
+		ttl = 10 * time.Minute
+	}
+
+	return &authUserClient{
+		baseURL: getEnv("AUTH_SERVICE_URL", "http://auth-service:8081"),
+		token:   getEnv("INTERNAL_SERVICE_TOKEN", ""),
+		client:  &http.Client{Timeout: timeout},
+		ttl:     ttl,
+		cache:   make(map[string]cachedUser),
+	}
+}
+
+func (c *authUserClient) LookupUser(ctx context.Context, userID string) (*UserInfo, error) {
+	if userID == "" {
+		return nil, errUserNotFound
+	}
+
+	c.mu.Lock()
+	entry, ok := c.cache[userID]
+	c.mu.Unlock()
+	if ok && time.Now().Before(entry.expiresAt) {
+		user := entry.user
+		return &user, nil
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.baseURL+"/internal/users/"+url.PathEscape(userID), nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("X-Service-Token", c.token)
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("erro ao consultar auth-service: %v", err)
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusNotFound, http.StatusBadRequest:
+		return nil, errUserNotFound
+	default:
+		return nil, fmt.Errorf("auth-service respondeu %d", resp.StatusCode)
+	}
+
+	var user UserInfo
+	if err := json.NewDecoder(resp.Body).Decode(&user); err != nil {
+		return nil, fmt.Errorf("erro ao interpretar usuário: %v", err)
+	}
+	if user.Email == "" {
+		return nil, fmt.Errorf("usuário %s sem e-mail", userID)
+	}
+
+	c.mu.Lock()
+	c.cache[userID] = cachedUser{user: user, expiresAt: time.Now().Add(c.ttl)}
+	c.mu.Unlock()
+
+	return &user, nil
+}
@@ -0,0 +1,151 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"math"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// Prefixos dos diretórios de trabalho criados sob PROCESSING_TEMP_DIR
+const (
+	framesWorkPrefix    = "video_processing_"
+	transcodeWorkPrefix = "video_transcode_"
+	batchWorkPrefix     = "video_batch_"
+)
+
+// Tamanho médio estimado de um frame PNG extraído
+const estimatedFrameBytes = 2 << 20
+
+// Intervalo entre verificações de espaço livre enquanto o worker aguarda
+var diskPollInterval = 10 * time.Second
+
+// Espaço livre e capacidade do sistema de arquivos de path (substituível em testes)
+var diskUsage = func(path string) (free, total uint64, err error) {
+	var stat syscall.Statfs_t
+	if err := syscall.Statfs(path, &stat); err != nil {
+		return 0, 0, err
+	}
+	return stat.Bavail * uint64(stat.Bsize), stat.Blocks * uint64(stat.Bsize), nil
+}
+
+// Diretório onde os jobs gravam vídeo, frames e ZIP. Não deve ser
+// compartilhado entre workers: a limpeza de inicialização remove tudo
+func workRoot() string {
+	return getEnv("PROCESSING_TEMP_DIR", os.TempDir())
+}
+
+// Folga mantida livre no disco além da estimativa do job (DISK_RESERVE_MB)
+func diskReserve() uint64 {
+	mb, err := strconv.Atoi(getEnv("DISK_RESERVE_MB", "256"))
+	if err != nil || mb < 0 {
+		mb = 256
+	}
+	return uint64(mb) << 20
+}
+
+// Estimar o espaço usado pelo job a partir do tamanho e da duração do vídeo
+func estimateWorkSpace(msg ProcessingMessage) uint64 {
+	size := uint64(msg.Size)
+
+	if msg.JobType == JobTypeTranscode {
+		// Original + MP4 e HLS de cada rendição (no máximo do tamanho do original)
+		return size + 2*size*uint64(len(msg.Renditions))
+	}
+
+	if msg.JobType == JobTypeBatch {
+		// ZIP combinado + o maior ZIP de vídeo baixado por vez
+		var total, largest uint64
+		for _, member := range msg.Members {
+			total += uint64(member.ZipSize)
+			largest = max(largest, uint64(member.ZipSize))
+		}
+		return total + largest
+	}
+
+	pipeline := defaultPipeline()
+	if msg.Pipeline != nil {
+		pipeline = *msg.Pipeline
+	}
+	fps := 1.0
+	for _, stage := range pipeline.Stages {
+		if stage.Type == "extract" {
+			fps = paramFloat(stage.Params, "fps", 1)
+		}
+	}
+
+	// Original + frames + cópia das transformações + ZIP (PNG quase não comprime)
+	frames := uint64(math.Ceil(msg.Duration*fps)) * estimatedFrameBytes
+	return size + 3*frames
+}
+
+// Criar o diretório de trabalho do job após a verificação de espaço. Se o job
+// cabe no disco mas não no espaço livre atual, o worker aguarda (sem consumir
+// novas mensagens) até liberar espaço ou o job expirar
+func (ps *ProcessingService) prepareWorkDir(ctx context.Context, msg ProcessingMessage, prefix string) (string, error) {
+	root := workRoot()
+	if err := os.MkdirAll(root, 0755); err != nil {
+		return "", fmt.Errorf("erro ao criar diretório de trabalho: %w", err)
+	}
+
+	need := estimateWorkSpace(msg) + diskReserve()
+	free, total, err := diskUsage(root)
+	if err != nil {
+		log.Printf("Aviso: não foi possível verificar espaço em %s: %v", root, err)
+	} else if need > total {
+		pErr := newProcessingError(ErrInsufficientSpace, "job precisa de %d MB e o disco tem %d MB", need>>20, total>>20)
+		pErr.Retryable = false
+		return "", pErr
+	}
+
+	for err == nil && free < need {
+		log.Printf("Aguardando espaço em disco para o vídeo %s: livre %d MB, necessário %d MB", msg.VideoID, free>>20, need>>20)
+		select {
+		case <-ctx.Done():
+			return "", newProcessingError(ErrInsufficientSpace, "espaço não liberado a tempo: livre %d MB, necessário %d MB", free>>20, need>>20)
+		case <-time.After(diskPollInterval):
+		}
+		free, _, err = diskUsage(root)
+	}
+
+	dir := filepath.Join(root, prefix+msg.VideoID)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", fmt.Errorf("erro ao criar diretório de trabalho: %w", err)
+	}
+	return dir, nil
+}
+
+// Remover diretórios de jobs interrompidos (crash, OOM) na inicialização
+func sweepWorkDirs() {
+	root := workRoot()
+	entries, err := os.ReadDir(root)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			log.Printf("Erro ao listar diretórios de trabalho em %s: %v", root, err)
+		}
+		return
+	}
+
+	removed := 0
+	for _, entry := range entries {
+		name := entry.Name()
+		if !entry.IsDir() || !(strings.HasPrefix(name, framesWorkPrefix) || strings.HasPrefix(name, transcodeWorkPrefix) || strings.HasPrefix(name, batchWorkPrefix)) {
+			continue
+		}
+		if err := os.RemoveAll(filepath.Join(root, name)); err != nil {
+			log.Printf("Erro ao remover diretório órfão %s: %v", name, err)
+			continue
+		}
+		removed++
+	}
+
+	if removed > 0 {
+		log.Printf("%d diretórios de trabalho órfãos removidos de %s", removed, root)
+	}
+}
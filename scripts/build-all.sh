@@ -24,7 +24,12 @@ build_and_push() {
     
     if [ -d "$dir" ] && [ -f "$dir/Dockerfile" ]; then
         echo "🔨 Construindo $service..."
-        docker build -t $REGISTRY/$service:$TAG $dir
+        # Serviços que usam o módulo shared são construídos a partir da raiz
+        if grep -q "=> ../shared" "$dir/go.mod" 2>/dev/null; then
+            docker build -f $dir/Dockerfile -t $REGISTRY/$service:$TAG .
+        else
+            docker build -t $REGISTRY/$service:$TAG $dir
+        fi
         
         # Verificar se a build foi bem-sucedida
         if [ $? -eq 0 ]; then
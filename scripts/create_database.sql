@@ -2,6 +2,10 @@
 -- SCRIPT DE CRIAÇÃO DO BANCO DE DADOS - PROJETO FIAP-X
 -- Sistema de Processamento de Vídeos
 -- =====================================================
+-- As tabelas de vídeos (processing_jobs e relacionadas) NÃO são criadas
+-- aqui: o storage-service as cria e evolui pelas migrações versionadas em
+-- storage-service/cmd/storage-service/migrations, aplicadas na inicialização.
+-- =====================================================
 
 -- Criar extensões necessárias
 CREATE EXTENSION IF NOT EXISTS "uuid-ossp";
@@ -26,35 +30,6 @@ CREATE INDEX IF NOT EXISTS idx_users_username ON users(username);
 CREATE INDEX IF NOT EXISTS idx_users_email ON users(email);
 CREATE INDEX IF NOT EXISTS idx_users_created_at ON users(created_at);
 
--- =====================================================
--- TABELA DE JOBS DE PROCESSAMENTO
--- =====================================================
-CREATE TABLE IF NOT EXISTS processing_jobs (
-    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
-    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
-    original_filename VARCHAR(255) NOT NULL,
-    file_path VARCHAR(500) NOT NULL,
-    file_size BIGINT NOT NULL,
-    mime_type VARCHAR(50) NOT NULL,
-    status VARCHAR(20) NOT NULL DEFAULT 'PENDING',
-    -- Status: PENDING, PROCESSING, COMPLETED, ERROR, CANCELLED
-    progress INTEGER DEFAULT 0, -- 0-100
-    frames_extracted INTEGER DEFAULT 0,
-    total_frames INTEGER,
-    error_message TEXT,
-    result_zip_path VARCHAR(500),
-    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
-    started_at TIMESTAMP WITH TIME ZONE,
-    completed_at TIMESTAMP WITH TIME ZONE,
-    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
-);
-
--- Índices para performance
-CREATE INDEX IF NOT EXISTS idx_jobs_user_id ON processing_jobs(user_id);
-CREATE INDEX IF NOT EXISTS idx_jobs_status ON processing_jobs(status);
-CREATE INDEX IF NOT EXISTS idx_jobs_created_at ON processing_jobs(created_at);
-CREATE INDEX IF NOT EXISTS idx_jobs_user_status ON processing_jobs(user_id, status);
-
 -- =====================================================
 -- TABELA DE SESSÕES (JWT/Redis backup)
 -- =====================================================
@@ -107,55 +82,11 @@ END;
 $$ language 'plpgsql';
 
 -- Triggers
+DROP TRIGGER IF EXISTS update_users_updated_at ON users;
 CREATE TRIGGER update_users_updated_at 
     BEFORE UPDATE ON users 
     FOR EACH ROW EXECUTE FUNCTION update_updated_at_column();
 
-CREATE TRIGGER update_jobs_updated_at 
-    BEFORE UPDATE ON processing_jobs 
-    FOR EACH ROW EXECUTE FUNCTION update_updated_at_column();
-
--- =====================================================
--- VIEWS ÚTEIS
--- =====================================================
-
--- View para estatísticas por usuário
-CREATE OR REPLACE VIEW user_stats AS
-SELECT 
-    u.id,
-    u.username,
-    u.email,
-    COUNT(pj.id) as total_jobs,
-    COUNT(CASE WHEN pj.status = 'COMPLETED' THEN 1 END) as completed_jobs,
-    COUNT(CASE WHEN pj.status = 'ERROR' THEN 1 END) as error_jobs,
-    COUNT(CASE WHEN pj.status = 'PROCESSING' THEN 1 END) as processing_jobs,
-    COUNT(CASE WHEN pj.status = 'PENDING' THEN 1 END) as pending_jobs,
-    MAX(pj.created_at) as last_job_date,
-    u.created_at as user_since
-FROM users u
-LEFT JOIN processing_jobs pj ON u.id = pj.user_id
-GROUP BY u.id, u.username, u.email, u.created_at;
-
--- View para jobs recentes
-CREATE OR REPLACE VIEW recent_jobs AS
-SELECT 
-    pj.id,
-    pj.user_id,
-    u.username,
-    pj.original_filename,
-    pj.status,
-    pj.progress,
-    pj.created_at,
-    pj.completed_at,
-    CASE 
-        WHEN pj.completed_at IS NOT NULL AND pj.started_at IS NOT NULL 
-        THEN EXTRACT(EPOCH FROM (pj.completed_at - pj.started_at))
-        ELSE NULL 
-    END as processing_time_seconds
-FROM processing_jobs pj
-JOIN users u ON pj.user_id = u.id
-ORDER BY pj.created_at DESC;
-
 -- =====================================================
 -- FUNÇÃO PARA CLEANUP DE DADOS ANTIGOS
 -- =====================================================
@@ -172,11 +103,6 @@ BEGIN
     DELETE FROM audit_logs WHERE created_at < CURRENT_TIMESTAMP - INTERVAL '1 day' * days_to_keep;
     GET DIAGNOSTICS deleted_count = deleted_count + ROW_COUNT;
     
-    -- Limpar jobs completados antigos (opcional - comentado por segurança)
-    -- DELETE FROM processing_jobs 
-    -- WHERE status = 'COMPLETED' 
-    --   AND completed_at < CURRENT_TIMESTAMP - INTERVAL '1 day' * days_to_keep;
-    
     RETURN deleted_count;
 END;
 $$ LANGUAGE plpgsql;
@@ -221,41 +147,17 @@ CREATE OR REPLACE VIEW performance_metrics AS
 SELECT 
     'total_users' as metric,
     COUNT(*)::text as value
-FROM users
-UNION ALL
-SELECT 
-    'active_jobs' as metric,
-    COUNT(*)::text as value
-FROM processing_jobs WHERE status IN ('PENDING', 'PROCESSING')
-UNION ALL
-SELECT 
-    'completed_today' as metric,
-    COUNT(*)::text as value
-FROM processing_jobs 
-WHERE status = 'COMPLETED' 
-  AND completed_at > CURRENT_DATE
-UNION ALL
-SELECT 
-    'error_rate_today' as metric,
-    ROUND(
-        (COUNT(CASE WHEN status = 'ERROR' THEN 1 END) * 100.0 / 
-         NULLIF(COUNT(*), 0)), 2
-    )::text || '%' as value
-FROM processing_jobs 
-WHERE created_at > CURRENT_DATE;
+FROM users;
 
 -- =====================================================
 -- COMENTÁRIOS E DOCUMENTAÇÃO
 -- =====================================================
 
 COMMENT ON TABLE users IS 'Tabela de usuários do sistema';
-COMMENT ON TABLE processing_jobs IS 'Jobs de processamento de vídeo';
 COMMENT ON TABLE user_sessions IS 'Sessões ativas de usuários';
 COMMENT ON TABLE audit_logs IS 'Logs de auditoria do sistema';
 
 COMMENT ON COLUMN users.password_hash IS 'Hash bcrypt da senha do usuário';
-COMMENT ON COLUMN processing_jobs.status IS 'Status: PENDING, PROCESSING, COMPLETED, ERROR, CANCELLED';
-COMMENT ON COLUMN processing_jobs.progress IS 'Progresso de 0 a 100%';
 
 -- =====================================================
 -- VALIDAÇÃO FINAL
@@ -269,10 +171,10 @@ BEGIN
     SELECT COUNT(*) INTO table_count
     FROM information_schema.tables 
     WHERE table_schema = 'public' 
-      AND table_name IN ('users', 'processing_jobs', 'user_sessions', 'audit_logs');
+      AND table_name IN ('users', 'user_sessions', 'audit_logs');
     
-    IF table_count = 4 THEN
-        RAISE NOTICE 'SUCCESS: Todas as 4 tabelas foram criadas com sucesso!';
+    IF table_count = 3 THEN
+        RAISE NOTICE 'SUCCESS: Todas as 3 tabelas foram criadas com sucesso!';
     ELSE
         RAISE EXCEPTION 'ERRO: Nem todas as tabelas foram criadas. Encontradas: %', table_count;
     END IF;
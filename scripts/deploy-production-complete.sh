@@ -82,11 +82,12 @@ cd ..
 for service in auth-service api-gateway upload-service processing-service storage-service; do
     if [ -d "$service" ]; then
         echo "Building $service..."
-        cd $service
-        if [ -f "Dockerfile" ]; then
-            docker build -t $service:latest .
+        # Serviços que usam o módulo shared são construídos a partir da raiz
+        if grep -q "=> ../shared" "$service/go.mod" 2>/dev/null; then
+            docker build -f $service/Dockerfile -t $service:latest .
+        elif [ -f "$service/Dockerfile" ]; then
+            (cd $service && docker build -t $service:latest .)
         fi
-        cd ..
     fi
 done
 
@@ -0,0 +1,165 @@
+// Package auth verifica os JWT emitidos pelo auth-service e expõe um
+// middleware que coloca a identidade do usuário no contexto da requisição.
+//
+// Usado pelo upload-service e pelo storage-service através do módulo shared
+// (diretiva replace no go.mod de cada serviço).
+package auth
+
+import (
+	"context"
+	"crypto"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// Folga para diferenças de relógio entre os serviços
+const clockSkew = 30 * time.Second
+
+// Usuário autenticado pelo token
+type Identity struct {
+	UserID   int
+	Username string
+	Email    string
+}
+
+type Config struct {
+	// Segredo HMAC compartilhado com o auth-service (HS256)
+	Secret string
+	// Chave pública PEM (RSA ou ECDSA) para tokens RS256/ES256; quando
+	// informada, tokens HMAC são recusados
+	PublicKey string
+	Issuer    string
+	Audience  string
+}
+
+// Configuração a partir de JWT_SECRET, JWT_PUBLIC_KEY, JWT_ISSUER e
+// JWT_AUDIENCE, com os mesmos padrões do auth-service
+func ConfigFromEnv() Config {
+	return Config{
+		Secret:    getEnv("JWT_SECRET", "secret_change_me"),
+		PublicKey: os.Getenv("JWT_PUBLIC_KEY"),
+		Issuer:    getEnv("JWT_ISSUER", "fiapx-auth-service"),
+		Audience:  getEnv("JWT_AUDIENCE", "fiapx"),
+	}
+}
+
+type Verifier struct {
+	parser *jwt.Parser
+	key    interface{}
+}
+
+func NewVerifier(cfg Config) (*Verifier, error) {
+	options := []jwt.ParserOption{
+		jwt.WithExpirationRequired(),
+		jwt.WithIssuedAt(),
+		jwt.WithLeeway(clockSkew),
+	}
+	if cfg.Issuer != "" {
+		options = append(options, jwt.WithIssuer(cfg.Issuer))
+	}
+	if cfg.Audience != "" {
+		options = append(options, jwt.WithAudience(cfg.Audience))
+	}
+
+	v := &Verifier{}
+	switch {
+	case cfg.PublicKey != "":
+		key, err := parsePublicKey(cfg.PublicKey)
+		if err != nil {
+			return nil, err
+		}
+		v.key = key
+		options = append(options, jwt.WithValidMethods([]string{"RS256", "RS384", "RS512", "ES256", "ES384", "ES512"}))
+	case cfg.Secret != "":
+		v.key = []byte(cfg.Secret)
+		options = append(options, jwt.WithValidMethods([]string{"HS256", "HS384", "HS512"}))
+	default:
+		return nil, errors.New("configure JWT_SECRET ou JWT_PUBLIC_KEY")
+	}
+	v.parser = jwt.NewParser(options...)
+	return v, nil
+}
+
+func parsePublicKey(data string) (crypto.PublicKey, error) {
+	block, _ := pem.Decode([]byte(data))
+	if block == nil {
+		return nil, errors.New("JWT_PUBLIC_KEY não está em formato PEM")
+	}
+	key, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		if rsaKey, rsaErr := x509.ParsePKCS1PublicKey(block.Bytes); rsaErr == nil {
+			return rsaKey, nil
+		}
+		return nil, fmt.Errorf("JWT_PUBLIC_KEY inválida: %v", err)
+	}
+	return key, nil
+}
+
+// Validar assinatura, expiração, emissor e audiência do token e extrair a
+// identidade; aceita o valor do header Authorization com ou sem "Bearer "
+func (v *Verifier) Verify(tokenString string) (*Identity, error) {
+	tokenString = strings.TrimSpace(strings.TrimPrefix(tokenString, "Bearer "))
+	if tokenString == "" {
+		return nil, errors.New("token vazio")
+	}
+
+	claims := jwt.MapClaims{}
+	_, err := v.parser.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
+		return v.key, nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("token inválido: %v", err)
+	}
+
+	userID, ok := claims["user_id"].(float64)
+	if !ok || userID <= 0 || userID != float64(int(userID)) {
+		return nil, errors.New("user_id não encontrado no token")
+	}
+	identity := &Identity{UserID: int(userID)}
+	identity.Username, _ = claims["username"].(string)
+	identity.Email, _ = claims["email"].(string)
+	return identity, nil
+}
+
+type contextKey struct{}
+
+// Recusar com 401 requisições sem token válido e guardar a identidade
+// verificada no contexto para os handlers
+func (v *Verifier) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		identity, err := v.Verify(r.Header.Get("Authorization"))
+		if err != nil {
+			log.Printf("Requisição %s %s recusada: %v", r.Method, r.URL.Path, err)
+			w.Header().Set("WWW-Authenticate", `Bearer realm="fiapx"`)
+			http.Error(w, "Token de autenticação inválido", http.StatusUnauthorized)
+			return
+		}
+		next.ServeHTTP(w, r.WithContext(WithIdentity(r.Context(), identity)))
+	})
+}
+
+func WithIdentity(ctx context.Context, identity *Identity) context.Context {
+	return context.WithValue(ctx, contextKey{}, identity)
+}
+
+// Identidade colocada pelo Middleware
+func FromContext(ctx context.Context) (*Identity, bool) {
+	identity, ok := ctx.Value(contextKey{}).(*Identity)
+	return identity, ok && identity != nil
+}
+
+func getEnv(key, defaultValue string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	return defaultValue
+}
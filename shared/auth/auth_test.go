@@ -0,0 +1,158 @@
+package auth
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var testConfig = Config{Secret: "segredo-de-teste", Issuer: "fiapx-auth-service", Audience: "fiapx"}
+
+func validClaims() jwt.MapClaims {
+	return jwt.MapClaims{
+		"user_id":  float64(42),
+		"username": "maria",
+		"email":    "maria@example.com",
+		"iss":      "fiapx-auth-service",
+		"aud":      "fiapx",
+		"iat":      time.Now().Unix(),
+		"exp":      time.Now().Add(time.Hour).Unix(),
+	}
+}
+
+func sign(t *testing.T, method jwt.SigningMethod, key interface{}, claims jwt.MapClaims) string {
+	t.Helper()
+	token, err := jwt.NewWithClaims(method, claims).SignedString(key)
+	require.NoError(t, err)
+	return token
+}
+
+func TestVerify(t *testing.T) {
+	verifier, err := NewVerifier(testConfig)
+	require.NoError(t, err)
+	secret := []byte(testConfig.Secret)
+
+	t.Run("token válido", func(t *testing.T) {
+		identity, err := verifier.Verify("Bearer " + sign(t, jwt.SigningMethodHS256, secret, validClaims()))
+		require.NoError(t, err)
+		assert.Equal(t, &Identity{UserID: 42, Username: "maria", Email: "maria@example.com"}, identity)
+	})
+
+	cases := map[string]func() string{
+		"token vazio": func() string { return "" },
+		"assinatura com outro segredo": func() string {
+			return sign(t, jwt.SigningMethodHS256, []byte("outro"), validClaims())
+		},
+		"sem assinatura": func() string {
+			return sign(t, jwt.SigningMethodNone, jwt.UnsafeAllowNoneSignatureType, validClaims())
+		},
+		"expirado": func() string {
+			claims := validClaims()
+			claims["exp"] = time.Now().Add(-time.Hour).Unix()
+			return sign(t, jwt.SigningMethodHS256, secret, claims)
+		},
+		"sem expiração": func() string {
+			claims := validClaims()
+			delete(claims, "exp")
+			return sign(t, jwt.SigningMethodHS256, secret, claims)
+		},
+		"outro emissor": func() string {
+			claims := validClaims()
+			claims["iss"] = "outro-servico"
+			return sign(t, jwt.SigningMethodHS256, secret, claims)
+		},
+		"outra audiência": func() string {
+			claims := validClaims()
+			claims["aud"] = "outro-sistema"
+			return sign(t, jwt.SigningMethodHS256, secret, claims)
+		},
+		"sem user_id": func() string {
+			claims := validClaims()
+			delete(claims, "user_id")
+			return sign(t, jwt.SigningMethodHS256, secret, claims)
+		},
+		"user_id em texto": func() string {
+			claims := validClaims()
+			claims["user_id"] = "42"
+			return sign(t, jwt.SigningMethodHS256, secret, claims)
+		},
+	}
+	for name, token := range cases {
+		t.Run(name, func(t *testing.T) {
+			_, err := verifier.Verify(token())
+			assert.Error(t, err)
+		})
+	}
+}
+
+func TestVerifyPublicKey(t *testing.T) {
+	privateKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	der, err := x509.MarshalPKIXPublicKey(&privateKey.PublicKey)
+	require.NoError(t, err)
+	publicPEM := string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}))
+
+	cfg := testConfig
+	cfg.PublicKey = publicPEM
+	verifier, err := NewVerifier(cfg)
+	require.NoError(t, err)
+
+	identity, err := verifier.Verify(sign(t, jwt.SigningMethodES256, privateKey, validClaims()))
+	require.NoError(t, err)
+	assert.Equal(t, 42, identity.UserID)
+
+	// Com chave pública configurada, HMAC não é aceito (nem assinado com a
+	// própria chave pública como segredo)
+	_, err = verifier.Verify(sign(t, jwt.SigningMethodHS256, []byte(testConfig.Secret), validClaims()))
+	assert.Error(t, err)
+	_, err = verifier.Verify(sign(t, jwt.SigningMethodHS256, []byte(publicPEM), validClaims()))
+	assert.Error(t, err)
+}
+
+func TestMiddleware(t *testing.T) {
+	verifier, err := NewVerifier(testConfig)
+	require.NoError(t, err)
+
+	var got *Identity
+	handler := verifier.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got, _ = FromContext(r.Context())
+	}))
+
+	t.Run("sem token responde 401", func(t *testing.T) {
+		got = nil
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/videos", nil))
+		assert.Equal(t, http.StatusUnauthorized, rec.Code)
+		assert.Nil(t, got)
+	})
+
+	t.Run("token forjado responde 401", func(t *testing.T) {
+		got = nil
+		req := httptest.NewRequest(http.MethodGet, "/videos", nil)
+		req.Header.Set("Authorization", "Bearer "+sign(t, jwt.SigningMethodHS256, []byte("forjado"), validClaims()))
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		assert.Equal(t, http.StatusUnauthorized, rec.Code)
+		assert.Nil(t, got)
+	})
+
+	t.Run("token válido chega ao handler com a identidade", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodGet, "/videos", nil)
+		req.Header.Set("Authorization", "Bearer "+sign(t, jwt.SigningMethodHS256, []byte(testConfig.Secret), validClaims()))
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		assert.Equal(t, http.StatusOK, rec.Code)
+		require.NotNil(t, got)
+		assert.Equal(t, 42, got.UserID)
+	})
+}
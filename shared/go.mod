@@ -0,0 +1,14 @@
+module github.com/fiap/projeto-fiapx/shared
+
+go 1.21
+
+require (
+	github.com/golang-jwt/jwt/v5 v5.2.0
+	github.com/stretchr/testify v1.10.0
+)
+
+require (
+	github.com/davecgh/go-spew v1.1.1 // indirect
+	github.com/pmezard/go-difflib v1.0.0 // indirect
+	gopkg.in/yaml.v3 v3.0.1 // indirect
+)
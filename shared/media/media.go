@@ -0,0 +1,96 @@
+// Package media reúne as regras de validação de vídeo compartilhadas pelo
+// upload-service e pelo processador da raiz: códigos de rejeição, codecs
+// aceitos, assinaturas de container e a leitura via ffprobe.
+package media
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+)
+
+// Códigos de rejeição devolvidos antes do processamento
+const (
+	RejectUnsupportedExtension = "UNSUPPORTED_EXTENSION"
+	RejectUnrecognizedFormat   = "UNRECOGNIZED_FORMAT"
+	RejectCorruptFile          = "CORRUPT_FILE"
+	RejectNoVideoStream        = "NO_VIDEO_STREAM"
+	RejectUnsupportedCodec     = "UNSUPPORTED_CODEC"
+	RejectZeroDuration         = "ZERO_DURATION"
+)
+
+// Arquivo recusado na validação de mídia
+type Rejection struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+	Detail  string `json:"detail,omitempty"`
+}
+
+func (r *Rejection) Error() string {
+	if r.Detail != "" {
+		return fmt.Sprintf("%s: %s (%s)", r.Code, r.Message, r.Detail)
+	}
+	return fmt.Sprintf("%s: %s", r.Code, r.Message)
+}
+
+// Codecs de vídeo que o ffmpeg das imagens de processamento decodifica
+var SupportedVideoCodecs = map[string]bool{
+	"h264":       true,
+	"hevc":       true,
+	"mpeg4":      true,
+	"mpeg2video": true,
+	"msmpeg4v3":  true,
+	"wmv2":       true,
+	"wmv3":       true,
+	"flv1":       true,
+	"vp8":        true,
+	"vp9":        true,
+	"av1":        true,
+	"mjpeg":      true,
+	"theora":     true,
+	"prores":     true,
+}
+
+// Assinaturas dos containers aceitos
+func DetectContainer(header []byte) string {
+	switch {
+	case len(header) >= 12 && string(header[4:8]) == "ftyp":
+		return "mp4"
+	case len(header) >= 8 && (string(header[4:8]) == "moov" || string(header[4:8]) == "mdat" || string(header[4:8]) == "wide" || string(header[4:8]) == "free"):
+		return "mov"
+	case len(header) >= 4 && bytes.Equal(header[:4], []byte{0x1A, 0x45, 0xDF, 0xA3}):
+		return "matroska"
+	case len(header) >= 12 && string(header[:4]) == "RIFF" && string(header[8:12]) == "AVI ":
+		return "avi"
+	case len(header) >= 8 && bytes.Equal(header[:8], []byte{0x30, 0x26, 0xB2, 0x75, 0x8E, 0x66, 0xCF, 0x11}):
+		return "asf"
+	case len(header) >= 3 && string(header[:3]) == "FLV":
+		return "flv"
+	default:
+		return ""
+	}
+}
+
+// Verificar o resultado do probe: stream de vídeo, codec aceito e duração
+func CheckInfo(info *Info) error {
+	if info.VideoCodec == "" {
+		return &Rejection{Code: RejectNoVideoStream, Message: "O arquivo não contém stream de vídeo"}
+	}
+	if !SupportedVideoCodecs[info.VideoCodec] {
+		return &Rejection{Code: RejectUnsupportedCodec, Message: "Codec de vídeo não suportado", Detail: info.VideoCodec}
+	}
+	if info.Duration <= 0 {
+		return &Rejection{Code: RejectZeroDuration, Message: "O vídeo não tem duração"}
+	}
+	return nil
+}
+
+// Arquivo ilegível vira rejeição CORRUPT_FILE; ferramenta ausente ou tempo
+// esgotado seguem como erro
+func ProbeRejection(err error) error {
+	var probeErr *ProbeError
+	if errors.As(err, &probeErr) {
+		return &Rejection{Code: RejectCorruptFile, Message: probeErr.Message, Detail: probeErr.Detail}
+	}
+	return err
+}
@@ -0,0 +1,105 @@
+package media
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDetectContainer(t *testing.T) {
+	tests := map[string][]byte{
+		"mp4":      []byte("\x00\x00\x00\x20ftypisom"),
+		"mov":      []byte("\x00\x00\x00\x08wide\x00\x00"),
+		"matroska": {0x1A, 0x45, 0xDF, 0xA3, 0x01, 0x00},
+		"avi":      []byte("RIFF\x00\x00\x00\x00AVI LIST"),
+		"asf":      {0x30, 0x26, 0xB2, 0x75, 0x8E, 0x66, 0xCF, 0x11, 0xA6, 0xD9},
+		"flv":      []byte("FLV\x01\x05"),
+		"":         []byte("GIF89a"),
+	}
+	for want, header := range tests {
+		assert.Equal(t, want, DetectContainer(header), "%q", header)
+	}
+}
+
+func TestCheckInfo(t *testing.T) {
+	tests := []struct {
+		name     string
+		info     Info
+		wantCode string
+	}{
+		{"h264", Info{VideoCodec: "h264", Duration: 10}, ""},
+		{"msmpeg4v3 em AVI", Info{VideoCodec: "msmpeg4v3", Duration: 10}, ""},
+		{"wmv3", Info{VideoCodec: "wmv3", Duration: 10}, ""},
+		{"flv1", Info{VideoCodec: "flv1", Duration: 10}, ""},
+		{"só áudio", Info{Duration: 180}, RejectNoVideoStream},
+		{"codec não suportado", Info{VideoCodec: "cinepak", Duration: 10}, RejectUnsupportedCodec},
+		{"duração zero", Info{VideoCodec: "h264"}, RejectZeroDuration},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := CheckInfo(&tt.info)
+			if tt.wantCode == "" {
+				assert.NoError(t, err)
+				return
+			}
+			var rejection *Rejection
+			require.ErrorAs(t, err, &rejection)
+			assert.Equal(t, tt.wantCode, rejection.Code)
+		})
+	}
+}
+
+func TestParseProbeOutput(t *testing.T) {
+	tests := []struct {
+		name   string
+		output string
+		want   Info
+	}{
+		{
+			name:   "duração do container",
+			output: `{"streams": [{"codec_type": "audio", "codec_name": "aac"}, {"codec_type": "video", "codec_name": "h264", "duration": "9.5"}], "format": {"duration": "10.0"}}`,
+			want:   Info{VideoCodec: "h264", Duration: 10},
+		},
+		{
+			name:   "duração só no stream",
+			output: `{"streams": [{"codec_type": "video", "codec_name": "vp9", "duration": "4.25"}], "format": {}}`,
+			want:   Info{VideoCodec: "vp9", Duration: 4.25},
+		},
+		{
+			name:   "capa embutida não é vídeo",
+			output: `{"streams": [{"codec_type": "audio", "codec_name": "mp3"}, {"codec_type": "video", "codec_name": "mjpeg", "disposition": {"attached_pic": 1}}], "format": {"duration": "180"}}`,
+			want:   Info{Duration: 180},
+		},
+		{
+			name:   "capa antes do vídeo",
+			output: `{"streams": [{"codec_type": "video", "codec_name": "mjpeg", "disposition": {"attached_pic": 1}}, {"codec_type": "video", "codec_name": "hevc", "duration": "7.5"}], "format": {}}`,
+			want:   Info{VideoCodec: "hevc", Duration: 7.5},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			info, err := ParseProbeOutput([]byte(tt.output))
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, *info)
+		})
+	}
+
+	var probeErr *ProbeError
+	_, err := ParseProbeOutput([]byte("não é JSON"))
+	assert.ErrorAs(t, err, &probeErr)
+}
+
+func TestProbeRejection(t *testing.T) {
+	var rejection *Rejection
+	err := ProbeRejection(&ProbeError{Message: "Não foi possível decodificar o vídeo", Detail: "moov atom not found"})
+	require.ErrorAs(t, err, &rejection)
+	assert.Equal(t, RejectCorruptFile, rejection.Code)
+	assert.Equal(t, "moov atom not found", rejection.Detail)
+
+	// Ferramenta ausente não é defeito do arquivo
+	err = ProbeRejection(ErrProberUnavailable)
+	assert.ErrorIs(t, err, ErrProberUnavailable)
+	assert.False(t, errors.As(err, &rejection))
+}
@@ -0,0 +1,130 @@
+package media
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os/exec"
+	"strconv"
+)
+
+// Container, codec e duração de um vídeo, lidos sem decodificá-lo inteiro
+type Prober interface {
+	Probe(ctx context.Context, videoPath string) (*Info, error)
+	// Decodificar o primeiro frame, para detectar arquivos truncados que o
+	// container ainda descreve como válidos
+	DecodeFirstFrame(ctx context.Context, videoPath string) error
+}
+
+type Info struct {
+	// Codec do primeiro stream de vídeo; vazio se não houver (capas embutidas
+	// não contam)
+	VideoCodec string
+	// Segundos, do container ou, se ausente, do stream de vídeo
+	Duration float64
+}
+
+// Ferramenta de leitura de mídia ausente: não há como validar o arquivo
+var ErrProberUnavailable = errors.New("ffprobe/ffmpeg indisponível")
+
+// Arquivo que o ffprobe/ffmpeg não conseguiu ler, com a última linha do erro
+type ProbeError struct {
+	Message string
+	Detail  string
+}
+
+func (e *ProbeError) Error() string {
+	if e.Detail != "" {
+		return fmt.Sprintf("%s (%s)", e.Message, e.Detail)
+	}
+	return e.Message
+}
+
+// Leitura real via ffprobe e ffmpeg
+type FFprobe struct{}
+
+func (FFprobe) Probe(ctx context.Context, videoPath string) (*Info, error) {
+	if _, err := exec.LookPath("ffprobe"); err != nil {
+		return nil, ErrProberUnavailable
+	}
+
+	var stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, "ffprobe",
+		"-v", "error",
+		"-print_format", "json",
+		"-show_format",
+		"-show_streams",
+		videoPath,
+	)
+	cmd.Stderr = &stderr
+	output, err := cmd.Output()
+	if ctx.Err() != nil {
+		return nil, fmt.Errorf("tempo esgotado no ffprobe: %w", ctx.Err())
+	}
+	if err != nil {
+		return nil, &ProbeError{Message: "Não foi possível ler o container do vídeo", Detail: lastLine(stderr.String())}
+	}
+	return ParseProbeOutput(output)
+}
+
+func (FFprobe) DecodeFirstFrame(ctx context.Context, videoPath string) error {
+	if _, err := exec.LookPath("ffmpeg"); err != nil {
+		return ErrProberUnavailable
+	}
+
+	var stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, "ffmpeg", "-v", "error", "-i", videoPath, "-map", "0:v:0", "-frames:v", "1", "-f", "null", "-")
+	cmd.Stderr = &stderr
+	err := cmd.Run()
+	if ctx.Err() != nil {
+		return fmt.Errorf("tempo esgotado no ffmpeg: %w", ctx.Err())
+	}
+	if err != nil {
+		return &ProbeError{Message: "Não foi possível decodificar o vídeo", Detail: lastLine(stderr.String())}
+	}
+	return nil
+}
+
+type probeResult struct {
+	Streams []struct {
+		CodecType string `json:"codec_type"`
+		CodecName string `json:"codec_name"`
+		Duration  string `json:"duration"`
+		// Capa embutida (attached_pic) aparece como stream de vídeo
+		Disposition struct {
+			AttachedPic int `json:"attached_pic"`
+		} `json:"disposition"`
+	} `json:"streams"`
+	Format struct {
+		Duration string `json:"duration"`
+	} `json:"format"`
+}
+
+// Converter a saída JSON do ffprobe (-show_format -show_streams)
+func ParseProbeOutput(output []byte) (*Info, error) {
+	var probe probeResult
+	if err := json.Unmarshal(output, &probe); err != nil {
+		return nil, &ProbeError{Message: "Não foi possível ler o container do vídeo"}
+	}
+
+	info := &Info{}
+	info.Duration, _ = strconv.ParseFloat(probe.Format.Duration, 64)
+	for _, stream := range probe.Streams {
+		if stream.CodecType != "video" || stream.Disposition.AttachedPic == 1 {
+			continue
+		}
+		info.VideoCodec = stream.CodecName
+		if info.Duration <= 0 {
+			info.Duration, _ = strconv.ParseFloat(stream.Duration, 64)
+		}
+		break
+	}
+	return info, nil
+}
+
+func lastLine(s string) string {
+	lines := bytes.Split(bytes.TrimSpace([]byte(s)), []byte("\n"))
+	return string(lines[len(lines)-1])
+}
@@ -0,0 +1,147 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/url"
+	"path"
+	"strconv"
+	"time"
+
+	"github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/credentials"
+)
+
+// Limite do SigV4 para URLs pré-assinadas
+const maxPresignExpiry = 7 * 24 * time.Hour
+
+// Artefato gerado para um vídeo, com a URL pré-assinada entregue ao cliente
+type videoArtifact struct {
+	Type        string `json:"type"` // frames_zip, shots_json, shots_csv, rendition, hls_master, hls_playlist
+	Name        string `json:"name"`
+	Version     int    `json:"version,omitempty"`
+	Resolution  string `json:"resolution,omitempty"`
+	ContentType string `json:"content_type"`
+	Size        int64  `json:"size,omitempty"`
+	URL         string `json:"url"`
+
+	bucket string
+	object string
+}
+
+// Validade das URLs pré-assinadas: padrão de PRESIGNED_URL_EXPIRY e teto de
+// PRESIGNED_URL_MAX_EXPIRY (no máximo 7 dias)
+type presignExpiry struct {
+	Default time.Duration
+	Max     time.Duration
+}
+
+func presignExpiryFromEnv() presignExpiry {
+	expiry := presignExpiry{Default: time.Hour, Max: 24 * time.Hour}
+	if value, err := time.ParseDuration(getEnv("PRESIGNED_URL_MAX_EXPIRY", "24h")); err == nil && value > 0 {
+		expiry.Max = min(value, maxPresignExpiry)
+	}
+	if value, err := time.ParseDuration(getEnv("PRESIGNED_URL_EXPIRY", "1h")); err == nil && value > 0 {
+		expiry.Default = value
+	}
+	expiry.Default = min(expiry.Default, expiry.Max)
+	return expiry
+}
+
+// Validade pedida em ?expires_in (segundos), limitada ao teto
+func (e presignExpiry) parse(value string) (time.Duration, error) {
+	if value == "" {
+		return e.Default, nil
+	}
+	seconds, err := strconv.Atoi(value)
+	if err != nil || seconds < 1 {
+		return 0, errors.New("expires_in deve ser um número positivo de segundos")
+	}
+	return min(time.Duration(seconds)*time.Second, e.Max), nil
+}
+
+// Cliente MinIO usado só para assinar URLs entregues aos clientes: a
+// assinatura SigV4 inclui o host, então ela precisa ser feita com o endereço
+// público (MINIO_PUBLIC_ENDPOINT) e não com o interno minio:9000. A região
+// fixa evita consultar o bucket pelo endereço público, que pode não ser
+// acessível de dentro do cluster
+func newPublicMinioClient(accessKey, secretKey string) (*minio.Client, error) {
+	endpoint := getEnv("MINIO_PUBLIC_ENDPOINT", "")
+	if endpoint == "" {
+		endpoint = getEnv("MINIO_ENDPOINT", "minio:9000")
+		log.Printf("MINIO_PUBLIC_ENDPOINT não definido; URLs pré-assinadas usarão %s", endpoint)
+	}
+	useSSL := getEnv("MINIO_PUBLIC_USE_SSL", getEnv("MINIO_USE_SSL", "false")) == "true"
+
+	client, err := minio.New(endpoint, &minio.Options{
+		Creds:  credentials.NewStaticV4(accessKey, secretKey, ""),
+		Secure: useSSL,
+		Region: getEnv("MINIO_REGION", "us-east-1"),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("erro ao configurar endpoint público do MinIO: %v", err)
+	}
+	return client, nil
+}
+
+// Objetos registrados para o vídeo: ZIP e shots da versão servida, rendições
+// MP4 e playlists HLS
+func videoArtifacts(video *VideoData) []*videoArtifact {
+	artifacts := []*videoArtifact{}
+	add := func(artifact *videoArtifact) {
+		if artifact.object == "" {
+			return
+		}
+		artifact.bucket = "video-processed"
+		artifact.Name = path.Base(artifact.object)
+		artifacts = append(artifacts, artifact)
+	}
+
+	// Mesma versão servida pelo DownloadVideoHandler
+	if latest := video.latestCompletedVersion(); latest != nil {
+		add(&videoArtifact{Type: "frames_zip", Version: latest.Version, ContentType: "application/zip", Size: latest.ZipSize, object: latest.ZipObjectName})
+		add(&videoArtifact{Type: "shots_json", Version: latest.Version, ContentType: "application/json", object: latest.ShotsObject})
+		add(&videoArtifact{Type: "shots_csv", Version: latest.Version, ContentType: "text/csv", object: latest.ShotsCSVObject})
+	} else if video.Status == "completed" {
+		add(&videoArtifact{Type: "frames_zip", ContentType: "application/zip", Size: video.ZipSize, object: video.ZipObjectName})
+		add(&videoArtifact{Type: "shots_json", ContentType: "application/json", object: video.ShotsObject})
+		add(&videoArtifact{Type: "shots_csv", ContentType: "text/csv", object: video.ShotsCSVObject})
+	}
+
+	for _, name := range video.Renditions {
+		add(&videoArtifact{Type: "rendition", Resolution: name, ContentType: "video/mp4", object: renditionObject(video.VideoID, name)})
+	}
+	if video.HLSMasterObject != "" {
+		add(&videoArtifact{Type: "hls_master", ContentType: "application/vnd.apple.mpegurl", object: video.HLSMasterObject})
+		for _, name := range video.Renditions {
+			playlist := path.Join(path.Dir(video.HLSMasterObject), name, "index.m3u8")
+			add(&videoArtifact{Type: "hls_playlist", Resolution: name, ContentType: "application/vnd.apple.mpegurl", object: playlist})
+		}
+	}
+	return artifacts
+}
+
+// Nome da rendição MP4 gravada pelo job de transcodificação
+func renditionObject(videoID, name string) string {
+	return fmt.Sprintf("%s_%s.mp4", videoID, name)
+}
+
+// Assinar as URLs dos artefatos com o endpoint público. ZIP e listas de shots
+// são baixados como anexo; rendições e playlists são abertos pelo player
+func (ss *StorageService) presignArtifacts(ctx context.Context, artifacts []*videoArtifact, expiry time.Duration) error {
+	for _, artifact := range artifacts {
+		params := url.Values{}
+		switch artifact.Type {
+		case "frames_zip", "shots_json", "shots_csv":
+			params.Set("response-content-disposition", fmt.Sprintf("attachment; filename=%q", artifact.Name))
+		}
+		presigned, err := ss.PublicMinio.PresignedGetObject(ctx, artifact.bucket, artifact.object, expiry, params)
+		if err != nil {
+			return fmt.Errorf("erro ao assinar %s: %v", artifact.object, err)
+		}
+		artifact.URL = presigned.String()
+	}
+	return nil
+}
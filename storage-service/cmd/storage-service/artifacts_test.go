@@ -0,0 +1,93 @@
+package main
+
+import (
+	"context"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestVideoArtifacts(t *testing.T) {
+	video := &VideoData{
+		VideoID:         "video_1",
+		Status:          "completed",
+		ZipObjectName:   "frames_video_1.zip",
+		Renditions:      []string{"480p", "720p"},
+		HLSMasterObject: "hls/video_1/master.m3u8",
+		Versions: []VideoVersion{
+			{Version: 1, Status: "completed", ZipObjectName: "frames_video_1.zip", ZipSize: 10},
+			{Version: 2, Status: "completed", ZipObjectName: "frames_video_1_v2.zip", ZipSize: 20, ShotsObject: "shots_video_1_v2.json", ShotsCSVObject: "shots_video_1_v2.csv"},
+			{Version: 3, Status: "failed"},
+		},
+	}
+
+	var objects []string
+	for _, artifact := range videoArtifacts(video) {
+		objects = append(objects, artifact.Type+" "+artifact.object)
+	}
+	assert.Equal(t, []string{
+		"frames_zip frames_video_1_v2.zip",
+		"shots_json shots_video_1_v2.json",
+		"shots_csv shots_video_1_v2.csv",
+		"rendition video_1_480p.mp4",
+		"rendition video_1_720p.mp4",
+		"hls_master hls/video_1/master.m3u8",
+		"hls_playlist hls/video_1/480p/index.m3u8",
+		"hls_playlist hls/video_1/720p/index.m3u8",
+	}, objects)
+
+	// Ainda processando e sem rendições: nenhum artefato
+	assert.Empty(t, videoArtifacts(&VideoData{VideoID: "video_2", Status: "processing"}))
+}
+
+func TestPresignExpiry(t *testing.T) {
+	t.Setenv("PRESIGNED_URL_EXPIRY", "48h")
+	t.Setenv("PRESIGNED_URL_MAX_EXPIRY", "720h")
+	expiry := presignExpiryFromEnv()
+	assert.Equal(t, maxPresignExpiry, expiry.Max, "teto limitado ao máximo do SigV4")
+	assert.Equal(t, 48*time.Hour, expiry.Default)
+
+	expiry = presignExpiry{Default: time.Hour, Max: 2 * time.Hour}
+	got, err := expiry.parse("")
+	require.NoError(t, err)
+	assert.Equal(t, time.Hour, got)
+	got, err = expiry.parse("600")
+	require.NoError(t, err)
+	assert.Equal(t, 10*time.Minute, got)
+	got, err = expiry.parse("86400")
+	require.NoError(t, err)
+	assert.Equal(t, 2*time.Hour, got)
+	for _, value := range []string{"0", "-5", "1h"} {
+		_, err := expiry.parse(value)
+		assert.Error(t, err, value)
+	}
+}
+
+func TestPresignArtifactsUsesPublicEndpoint(t *testing.T) {
+	t.Setenv("MINIO_ENDPOINT", "minio:9000")
+	t.Setenv("MINIO_PUBLIC_ENDPOINT", "videos.example.com")
+	t.Setenv("MINIO_PUBLIC_USE_SSL", "true")
+	client, err := newPublicMinioClient("chave", "segredo")
+	require.NoError(t, err)
+	ss := &StorageService{PublicMinio: client}
+
+	artifacts := videoArtifacts(&VideoData{VideoID: "video_1", Status: "completed", ZipObjectName: "frames_video_1.zip", Renditions: []string{"720p"}})
+	require.NoError(t, ss.presignArtifacts(context.Background(), artifacts, 15*time.Minute))
+	require.Len(t, artifacts, 2)
+
+	zip, err := url.Parse(artifacts[0].URL)
+	require.NoError(t, err)
+	assert.Equal(t, "https", zip.Scheme)
+	assert.Equal(t, "videos.example.com", zip.Host)
+	assert.Equal(t, "/video-processed/frames_video_1.zip", zip.Path)
+	assert.Equal(t, "900", zip.Query().Get("X-Amz-Expires"))
+	assert.Equal(t, `attachment; filename="frames_video_1.zip"`, zip.Query().Get("response-content-disposition"))
+
+	rendition, err := url.Parse(artifacts[1].URL)
+	require.NoError(t, err)
+	assert.Equal(t, "videos.example.com", rendition.Host)
+	assert.Empty(t, rendition.Query().Get("response-content-disposition"))
+}
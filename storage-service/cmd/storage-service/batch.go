@@ -0,0 +1,305 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/minio/minio-go/v7"
+)
+
+// Lote de vídeos enviados juntos. Os vídeos são processados individualmente;
+// quando todos terminam, o storage enfileira o job finalizador que monta um
+// ZIP único com um diretório por vídeo e um manifest combinado
+type BatchData struct {
+	BatchID     string     `json:"batch_id"`
+	UserID      int        `json:"user_id"`
+	Status      string     `json:"status"` // processing, finalizing, completed, partial, failed
+	CreatedAt   time.Time  `json:"created_at"`
+	CompletedAt *time.Time `json:"completed_at,omitempty"`
+	Size        int        `json:"size"` // vídeos esperados no lote
+	VideoIDs    []string   `json:"video_ids"`
+	Completed   int        `json:"completed"`
+	Failed      int        `json:"failed"`
+	ZipSize     int64      `json:"zip_size"`
+	ErrorCode   string     `json:"error_code,omitempty"`
+	// ZIP combinado e última sequência de evento do finalizador
+	ZipObjectName string `json:"-"`
+	LastEventSeq  int64  `json:"-"`
+}
+
+// Vídeo do lote no formato do job finalizador do processing-service
+type BatchMember struct {
+	VideoID       string `json:"video_id"`
+	Filename      string `json:"filename"`
+	Status        string `json:"status"` // completed, failed ou cancelled
+	ZipObjectName string `json:"zip_object_name,omitempty"`
+	ZipSize       int64  `json:"zip_size,omitempty"`
+	FrameCount    int    `json:"frame_count,omitempty"`
+	ErrorCode     string `json:"error_code,omitempty"`
+	Error         string `json:"error,omitempty"`
+}
+
+// Status finais de um vídeo
+func isTerminalStatus(status string) bool {
+	return status == "completed" || status == "error" || status == "cancelled"
+}
+
+// Associar o vídeo ao lote informado pelo evento
+func trackBatchMember(video *VideoData, event JobEvent) {
+	if event.BatchID != "" && video.BatchID == "" {
+		video.BatchID = event.BatchID
+	}
+}
+
+// Registrar o lote no primeiro evento de um de seus vídeos; os vídeos do lote
+// são os registros de processing_jobs com o mesmo batch_id
+func (ss *StorageService) registerBatch(event JobEvent, userID int) error {
+	if event.BatchID == "" {
+		return nil
+	}
+	return ss.Videos.CreateBatch(ctx, &BatchData{
+		BatchID:   event.BatchID,
+		UserID:    userID,
+		Status:    "processing",
+		CreatedAt: event.Timestamp,
+		Size:      event.BatchSize,
+	})
+}
+
+// Enfileirar o finalizador quando todos os vídeos do lote terminaram
+func (ss *StorageService) checkBatch(batchID string) error {
+	if batchID == "" {
+		return nil
+	}
+
+	batch, err := ss.Videos.GetBatch(ctx, batchID)
+	if errors.Is(err, errBatchNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if batch.Status != "processing" || len(batch.VideoIDs) < batch.Size {
+		return nil
+	}
+
+	videos, err := ss.Videos.List(ctx, VideoFilter{BatchID: batchID, Ascending: true})
+	if err != nil {
+		return err
+	}
+	members := make([]BatchMember, 0, len(videos))
+	completed := 0
+	for _, video := range videos {
+		if !isTerminalStatus(video.Status) {
+			return nil
+		}
+
+		member := BatchMember{
+			VideoID:   video.VideoID,
+			Filename:  video.Title,
+			Status:    video.Status,
+			ErrorCode: video.ErrorCode,
+			Error:     video.ErrorMessage,
+		}
+		switch {
+		case video.Status == "completed" && video.ZipObjectName != "":
+			member.ZipObjectName = video.ZipObjectName
+			member.ZipSize = video.ZipSize
+			member.FrameCount = video.FrameCount
+			completed++
+		case video.Status == "error":
+			member.Status = "failed"
+		}
+		members = append(members, member)
+	}
+
+	// Só uma réplica passa o lote para finalizing e enfileira o finalizador
+	var message *ProcessingMessage
+	err = ss.Videos.UpdateBatch(ctx, batchID, func(batch *BatchData) (*BatchData, error) {
+		if batch.Status != "processing" {
+			return nil, nil
+		}
+		batch.Status = "finalizing"
+		batch.Completed = completed
+		batch.Failed = len(members) - completed
+		batch.LastEventSeq = 1
+		message = &ProcessingMessage{
+			VideoID:  batch.BatchID,
+			BatchID:  batch.BatchID,
+			UserID:   strconv.Itoa(batch.UserID),
+			JobType:  "batch",
+			Members:  members,
+			Sequence: batch.LastEventSeq,
+		}
+		return batch, nil
+	})
+	if err != nil || message == nil {
+		return err
+	}
+
+	if err := ss.publishJob(*message); err != nil {
+		rollbackErr := ss.Videos.UpdateBatch(ctx, batchID, func(batch *BatchData) (*BatchData, error) {
+			batch.Status = "processing"
+			return batch, nil
+		})
+		if rollbackErr != nil {
+			log.Printf("Erro ao reabrir lote %s: %v", batchID, rollbackErr)
+		}
+		return fmt.Errorf("erro ao enfileirar finalizador do lote %s: %v", batchID, err)
+	}
+
+	log.Printf("Lote %s completo (%d de %d vídeos concluídos), finalizador enfileirado", batchID, completed, len(members))
+	return nil
+}
+
+// Aplicar eventos do job finalizador (video_id é o ID do lote)
+func (ss *StorageService) handleBatchEvent(event JobEvent) error {
+	err := ss.Videos.UpdateBatch(ctx, event.VideoID, func(batch *BatchData) (*BatchData, error) {
+		if event.Sequence <= batch.LastEventSeq {
+			log.Printf("Evento %s do lote %s ignorado (sequência %d já aplicada)", event.Event, event.VideoID, event.Sequence)
+			return nil, nil
+		}
+		batch.LastEventSeq = event.Sequence
+
+		switch event.Event {
+		case "completed":
+			if event.Result == nil {
+				return nil, fmt.Errorf("evento %s sem resultado", event.Event)
+			}
+			batch.Status = "completed"
+			if failed, ok := event.Result.Metadata["failed"].(float64); ok {
+				batch.Failed = int(failed)
+				batch.Completed = len(batch.VideoIDs) - batch.Failed
+			}
+			if batch.Failed > 0 {
+				batch.Status = "partial"
+			}
+			batch.ZipObjectName = event.Result.ZipObjectName
+			batch.ZipSize = event.Result.ZipSize
+			completedAt := event.Timestamp
+			batch.CompletedAt = &completedAt
+		case "failed", "cancelled":
+			batch.Status = "failed"
+			if event.Result != nil {
+				batch.ErrorCode = event.Result.ErrorCode
+			}
+			completedAt := event.Timestamp
+			batch.CompletedAt = &completedAt
+		default:
+			batch.Status = "finalizing"
+		}
+		return batch, nil
+	})
+	if errors.Is(err, errBatchNotFound) {
+		log.Printf("Evento %s de lote desconhecido: %s", event.Event, event.VideoID)
+		return nil
+	}
+	return err
+}
+
+// Status do lote com o andamento de cada vídeo
+func (ss *StorageService) GetBatchHandler(w http.ResponseWriter, r *http.Request) {
+	batchID := mux.Vars(r)["id"]
+
+	// Usuário verificado pelo middleware de autenticação
+	userID, err := requestUserID(r)
+	if err != nil {
+		http.Error(w, "Token de autenticação inválido", http.StatusUnauthorized)
+		return
+	}
+
+	batch, err := ss.Videos.GetBatch(r.Context(), batchID)
+	if err != nil && !errors.Is(err, errBatchNotFound) {
+		log.Printf("Erro ao buscar lote %s: %v", batchID, err)
+		http.Error(w, "Erro interno do servidor", http.StatusInternalServerError)
+		return
+	}
+	if err != nil || batch.UserID != userID {
+		http.Error(w, "Lote não encontrado", http.StatusNotFound)
+		return
+	}
+	members, err := ss.Videos.List(r.Context(), VideoFilter{BatchID: batchID, Ascending: true})
+	if err != nil {
+		log.Printf("Erro ao listar vídeos do lote %s: %v", batchID, err)
+		http.Error(w, "Erro interno do servidor", http.StatusInternalServerError)
+		return
+	}
+
+	videos := make([]map[string]interface{}, 0, len(members))
+	for _, video := range members {
+		videos = append(videos, map[string]interface{}{
+			"video_id":      video.VideoID,
+			"title":         video.Title,
+			"status":        video.Status,
+			"progress":      video.Progress,
+			"frame_count":   video.FrameCount,
+			"error_code":    video.ErrorCode,
+			"error_message": video.ErrorMessage,
+		})
+	}
+	response := map[string]interface{}{
+		"batch":  *batch,
+		"videos": videos,
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// Download do ZIP combinado do lote
+func (ss *StorageService) DownloadBatchHandler(w http.ResponseWriter, r *http.Request) {
+	batchID := mux.Vars(r)["id"]
+
+	// Usuário verificado pelo middleware de autenticação
+	userID, err := requestUserID(r)
+	if err != nil {
+		http.Error(w, "Token de autenticação inválido", http.StatusUnauthorized)
+		return
+	}
+
+	batch, err := ss.Videos.GetBatch(r.Context(), batchID)
+	if err != nil && !errors.Is(err, errBatchNotFound) {
+		log.Printf("Erro ao buscar lote %s: %v", batchID, err)
+		http.Error(w, "Erro interno do servidor", http.StatusInternalServerError)
+		return
+	}
+	if err != nil || batch.UserID != userID {
+		http.Error(w, "Lote não encontrado", http.StatusNotFound)
+		return
+	}
+	zipObjectName := batch.ZipObjectName
+
+	if zipObjectName == "" {
+		http.Error(w, "Lote ainda não foi finalizado", http.StatusNotFound)
+		return
+	}
+
+	object, err := ss.MinioClient.GetObject(r.Context(), "video-processed", zipObjectName, minio.GetObjectOptions{})
+	if err != nil {
+		log.Printf("Erro ao baixar ZIP do lote %s: %v", batchID, err)
+		http.Error(w, "Erro ao baixar arquivo", http.StatusInternalServerError)
+		return
+	}
+	defer object.Close()
+
+	info, err := object.Stat()
+	if err != nil {
+		log.Printf("Erro ao obter informações do ZIP do lote %s: %v", batchID, err)
+		http.Error(w, "Erro ao baixar arquivo", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/zip")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=\"%s\"", zipObjectName))
+	w.Header().Set("Content-Length", strconv.FormatInt(info.Size, 10))
+	if _, err := io.Copy(w, object); err != nil {
+		log.Printf("Erro ao copiar ZIP do lote %s: %v", batchID, err)
+	}
+}
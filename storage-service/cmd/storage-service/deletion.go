@@ -0,0 +1,278 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/minio/minio-go/v7"
+	"github.com/streadway/amqp"
+)
+
+// Exchange fanout de controle dos jobs, assinado por todas as réplicas do
+// processing-service
+const controlExchange = "video.control"
+
+// Tempo que uma réplica tem para remover os objetos antes que a exclusão
+// volte a ficar disponível para outra (queda no meio da remoção)
+const deletionLease = 10 * time.Minute
+
+// Exclusão de um vídeo: o registro já saiu do banco e os objetos listados em
+// Targets são removidos em segundo plano até a conclusão
+type VideoDeletion struct {
+	VideoID     string
+	UserID      int
+	Status      string // pending, completed
+	Targets     []DeletionTarget
+	Attempts    int
+	LastError   string
+	RequestedAt time.Time
+	// Próxima tentativa; enquanto uma réplica remove, é o fim do lease
+	NextAttemptAt time.Time
+	CompletedAt   *time.Time
+}
+
+// Objeto ou prefixo a remover de um bucket
+type DeletionTarget struct {
+	Bucket string `json:"bucket"`
+	Object string `json:"object,omitempty"`
+	Prefix string `json:"prefix,omitempty"`
+}
+
+// Mensagem de controle para o processing-service
+type JobControl struct {
+	Action  string `json:"action"` // cancel
+	VideoID string `json:"video_id"`
+	Reason  string `json:"reason,omitempty"`
+}
+
+func declareControlExchange(ch *amqp.Channel) error {
+	if err := ch.ExchangeDeclare(controlExchange, "fanout", true, false, false, false, nil); err != nil {
+		return fmt.Errorf("erro ao declarar exchange de controle: %v", err)
+	}
+	return nil
+}
+
+// Todos os objetos do vídeo: os registrados no banco e os nomes derivados do
+// ID, para cobrir saídas que um job ainda em execução venha a gravar
+func deletionTargets(video *VideoData) []DeletionTarget {
+	var targets []DeletionTarget
+	targets = append(targets, originalTargets(video)...)
+	targets = append(targets, frameTargets(video)...)
+	targets = append(targets, renditionTargets(video)...)
+	return uniqueTargets(targets)
+}
+
+// Original: {id}.{ext}
+func originalTargets(video *VideoData) []DeletionTarget {
+	return uniqueTargets([]DeletionTarget{
+		{Bucket: "video-uploads", Object: video.OriginalObject},
+		{Bucket: "video-uploads", Prefix: video.VideoID + "."},
+	})
+}
+
+// ZIPs e shots de todas as versões e frames em cache
+func frameTargets(video *VideoData) []DeletionTarget {
+	id := video.VideoID
+	targets := []DeletionTarget{
+		{Bucket: "video-processed", Object: video.ZipObjectName},
+		{Bucket: "video-processed", Object: video.ShotsObject},
+		{Bucket: "video-processed", Object: video.ShotsCSVObject},
+	}
+	for _, version := range video.Versions {
+		targets = append(targets,
+			DeletionTarget{Bucket: "video-processed", Object: version.ZipObjectName},
+			DeletionTarget{Bucket: "video-processed", Object: version.ShotsObject},
+			DeletionTarget{Bucket: "video-processed", Object: version.ShotsCSVObject},
+		)
+	}
+	targets = append(targets,
+		DeletionTarget{Bucket: "video-processed", Object: "frames_" + id + ".zip"},
+		DeletionTarget{Bucket: "video-processed", Prefix: "frames_" + id + "_v"},
+		DeletionTarget{Bucket: "video-processed", Object: "shots_" + id + ".json"},
+		DeletionTarget{Bucket: "video-processed", Object: "shots_" + id + ".csv"},
+		DeletionTarget{Bucket: "video-processed", Prefix: "shots_" + id + "_v"},
+		DeletionTarget{Bucket: "video-processed", Prefix: "frames-cache/" + id + "/"},
+	)
+	return uniqueTargets(targets)
+}
+
+// Rendições MP4 ({id}_{nome}.mp4) e HLS
+func renditionTargets(video *VideoData) []DeletionTarget {
+	return uniqueTargets([]DeletionTarget{
+		{Bucket: "video-processed", Prefix: video.VideoID + "_"},
+		{Bucket: "video-processed", Prefix: "hls/" + video.VideoID + "/"},
+	})
+}
+
+// Alvos sem objeto nem prefixo e repetidos saem, mantendo a ordem
+func uniqueTargets(targets []DeletionTarget) []DeletionTarget {
+	seen := make(map[DeletionTarget]bool)
+	var unique []DeletionTarget
+	for _, target := range targets {
+		if (target.Object == "" && target.Prefix == "") || seen[target] {
+			continue
+		}
+		seen[target] = true
+		unique = append(unique, target)
+	}
+	return unique
+}
+
+// Remover o registro do vídeo, cancelar jobs em andamento e agendar a limpeza
+// dos objetos no MinIO
+func (ss *StorageService) deleteVideo(ctx context.Context, video *VideoData) error {
+	deletion := &VideoDeletion{
+		VideoID:     video.VideoID,
+		UserID:      video.UserID,
+		Status:      "pending",
+		Targets:     deletionTargets(video),
+		RequestedAt: time.Now(),
+	}
+	deletion.NextAttemptAt = deletion.RequestedAt
+	if err := ss.Videos.ScheduleDeletion(ctx, deletion); err != nil {
+		return err
+	}
+
+	// Jobs ainda na fila ou rodando (inclusive transcodificação e
+	// reprocessamentos de vídeos já concluídos) são cancelados
+	if err := ss.cancelJobs(video.VideoID, "vídeo excluído"); err != nil {
+		log.Printf("Erro ao cancelar jobs do vídeo %s: %v", video.VideoID, err)
+	}
+	ss.wakeDeletionWorker()
+	return nil
+}
+
+func (ss *StorageService) cancelJobs(videoID, reason string) error {
+	body, err := json.Marshal(JobControl{Action: "cancel", VideoID: videoID, Reason: reason})
+	if err != nil {
+		return err
+	}
+	return ss.RabbitCh.Publish(controlExchange, "", false, false, amqp.Publishing{
+		ContentType:  "application/json",
+		DeliveryMode: amqp.Persistent,
+		Body:         body,
+	})
+}
+
+func (ss *StorageService) wakeDeletionWorker() {
+	select {
+	case ss.deletionWake <- struct{}{}:
+	default:
+	}
+}
+
+// Eventos de um vídeo excluído não recriam o registro. Um job que terminou
+// depois da exclusão pode ter gravado saídas novas: reabrir a limpeza
+func (ss *StorageService) handleDeletedVideoEvent(event JobEvent) error {
+	log.Printf("Evento %s do vídeo %s ignorado (vídeo excluído)", event.Event, event.VideoID)
+	if event.Event != "completed" && event.Event != "failed" && event.Event != "cancelled" {
+		return nil
+	}
+	if err := ss.Videos.ReopenDeletion(ctx, event.VideoID); err != nil {
+		return err
+	}
+	ss.wakeDeletionWorker()
+	return nil
+}
+
+// Worker das exclusões pendentes: roda a cada DELETION_POLL_INTERVAL e logo
+// após cada nova exclusão. Exclusões interrompidas por queda são retomadas
+// quando o lease expira
+func (ss *StorageService) StartDeletionWorker() {
+	interval, err := time.ParseDuration(getEnv("DELETION_POLL_INTERVAL", "30s"))
+	if err != nil || interval <= 0 {
+		interval = 30 * time.Second
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	log.Println("Worker de exclusões iniciado")
+	for {
+		ss.runPendingDeletions()
+		select {
+		case <-ticker.C:
+		case <-ss.deletionWake:
+		}
+	}
+}
+
+func (ss *StorageService) runPendingDeletions() {
+	for {
+		deletion, err := ss.Videos.ClaimDeletion(ctx, deletionLease)
+		if err != nil {
+			log.Printf("Erro ao buscar exclusões pendentes: %v", err)
+			return
+		}
+		if deletion == nil {
+			return
+		}
+
+		if err := ss.removeTargets(deletion.Targets); err != nil {
+			retryAt := time.Now().Add(deletionBackoff(deletion.Attempts))
+			log.Printf("Erro ao remover objetos do vídeo %s (tentativa %d, nova tentativa às %s): %v",
+				deletion.VideoID, deletion.Attempts, retryAt.Format(time.RFC3339), err)
+			if err := ss.Videos.FailDeletion(ctx, deletion.VideoID, err.Error(), retryAt); err != nil {
+				log.Printf("Erro ao registrar falha da exclusão do vídeo %s: %v", deletion.VideoID, err)
+			}
+			continue
+		}
+
+		if err := ss.Videos.CompleteDeletion(ctx, deletion.VideoID); err != nil {
+			log.Printf("Erro ao concluir exclusão do vídeo %s: %v", deletion.VideoID, err)
+			continue
+		}
+		log.Printf("Objetos do vídeo %s removidos do MinIO", deletion.VideoID)
+	}
+}
+
+// Backoff exponencial a partir de 30s, limitado a 1h
+func deletionBackoff(attempts int) time.Duration {
+	if attempts < 1 {
+		attempts = 1
+	}
+	if attempts > 8 {
+		return time.Hour
+	}
+	backoff := 30 * time.Second * time.Duration(1<<uint(attempts-1))
+	if backoff > time.Hour {
+		return time.Hour
+	}
+	return backoff
+}
+
+// Remover todos os alvos; continua nos seguintes quando um falha e devolve
+// os erros juntos. Remover um objeto que não existe não é erro
+func (ss *StorageService) removeTargets(targets []DeletionTarget) error {
+	ctx, cancel := context.WithTimeout(context.Background(), deletionLease)
+	defer cancel()
+
+	var failures []string
+	remove := func(bucket, object string) {
+		if err := ss.MinioClient.RemoveObject(ctx, bucket, object, minio.RemoveObjectOptions{}); err != nil {
+			failures = append(failures, fmt.Sprintf("%s/%s: %v", bucket, object, err))
+		}
+	}
+
+	for _, target := range targets {
+		if target.Object != "" {
+			remove(target.Bucket, target.Object)
+			continue
+		}
+		for object := range ss.MinioClient.ListObjects(ctx, target.Bucket, minio.ListObjectsOptions{Prefix: target.Prefix, Recursive: true}) {
+			if object.Err != nil {
+				failures = append(failures, fmt.Sprintf("%s/%s*: %v", target.Bucket, target.Prefix, object.Err))
+				break
+			}
+			remove(target.Bucket, object.Key)
+		}
+	}
+
+	if len(failures) > 0 {
+		return fmt.Errorf("%d falhas: %s", len(failures), strings.Join(failures, "; "))
+	}
+	return nil
+}
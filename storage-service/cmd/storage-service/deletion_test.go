@@ -0,0 +1,42 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDeletionTargets(t *testing.T) {
+	video := &VideoData{
+		VideoID:        "video_123",
+		OriginalObject: "video_123.mp4",
+		ZipObjectName:  "frames_video_123_v2.zip",
+		ShotsObject:    "shots_video_123_v2.json",
+		Versions: []VideoVersion{
+			{Version: 1, ZipObjectName: "frames_video_123.zip", ShotsObject: "shots_video_123.json"},
+			{Version: 2, ZipObjectName: "frames_video_123_v2.zip", ShotsObject: "shots_video_123_v2.json"},
+		},
+	}
+
+	targets := deletionTargets(video)
+	assert.Contains(t, targets, DeletionTarget{Bucket: "video-uploads", Object: "video_123.mp4"})
+	assert.Contains(t, targets, DeletionTarget{Bucket: "video-processed", Object: "frames_video_123_v2.zip"})
+	assert.Contains(t, targets, DeletionTarget{Bucket: "video-processed", Prefix: "hls/video_123/"})
+	assert.Contains(t, targets, DeletionTarget{Bucket: "video-processed", Prefix: "frames-cache/video_123/"})
+	assert.Contains(t, targets, DeletionTarget{Bucket: "video-processed", Prefix: "video_123_"})
+
+	seen := make(map[DeletionTarget]bool)
+	for _, target := range targets {
+		assert.False(t, seen[target], "alvo repetido: %+v", target)
+		seen[target] = true
+
+		// Nenhum alvo pode alcançar objetos de outro vídeo cujo ID começa
+		// com o mesmo prefixo (video_1234)
+		if target.Prefix != "" {
+			for _, other := range []string{"video_1234.mp4", "frames_video_1234.zip", "shots_video_1234_v2.csv", "video_1234_720p.mp4", "hls/video_1234/master.m3u8"} {
+				assert.False(t, strings.HasPrefix(other, target.Prefix), "prefixo %q alcança %s", target.Prefix, other)
+			}
+		}
+	}
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/minio/minio-go/v7"
+)
+
+// Servir um objeto do MinIO com Range, If-Range, ETag e Last-Modified, para
+// que downloads interrompidos sejam retomados (curl -C -, gerenciadores de
+// download). O tamanho vem de um HEAD (StatObject) e http.ServeContent faz a
+// negociação: HEAD e respostas 304/412 não leem o objeto, e os bytes pedidos
+// são lidos com GETs ranged no MinIO, sem passar pelo objeto inteiro
+func (ss *StorageService) serveObject(w http.ResponseWriter, r *http.Request, bucket, objectName, filename, contentType string) {
+	info, err := ss.MinioClient.StatObject(r.Context(), bucket, objectName, minio.StatObjectOptions{})
+	if err != nil {
+		if minio.ToErrorResponse(err).Code == "NoSuchKey" {
+			http.Error(w, "Arquivo não encontrado", http.StatusNotFound)
+			return
+		}
+		log.Printf("Erro ao consultar objeto %s/%s: %v", bucket, objectName, err)
+		http.Error(w, "Erro ao baixar arquivo", http.StatusInternalServerError)
+		return
+	}
+
+	// Ler sempre a versão consultada: se o objeto for regravado no meio do
+	// download, o MinIO recusa a leitura em vez de misturar conteúdos
+	opts := minio.GetObjectOptions{}
+	if err := opts.SetMatchETag(info.ETag); err != nil {
+		log.Printf("ETag inválido para %s/%s: %v", bucket, objectName, err)
+	}
+	object, err := ss.MinioClient.GetObject(r.Context(), bucket, objectName, opts)
+	if err != nil {
+		log.Printf("Erro ao abrir objeto %s/%s: %v", bucket, objectName, err)
+		http.Error(w, "Erro ao baixar arquivo", http.StatusInternalServerError)
+		return
+	}
+	defer object.Close()
+
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
+	w.Header().Set("ETag", fmt.Sprintf("%q", info.ETag))
+
+	// ReadAt do minio.Object faz o GET a partir do offset pedido; o
+	// SectionReader evita outra consulta ao MinIO para descobrir o tamanho
+	http.ServeContent(w, r, filename, info.LastModified, io.NewSectionReader(object, 0, info.Size))
+}
+
+// ZIP de frames servido para o vídeo: a versão pedida em ?version=N ou a
+// mais recente concluída. Retorna "" quando a resposta de erro já foi enviada
+func servedZipObject(w http.ResponseWriter, r *http.Request, video *VideoData) string {
+	if video.Status == "expired" {
+		http.Error(w, "Arquivos do vídeo expiraram", http.StatusGone)
+		return ""
+	}
+
+	zipObjectName := ""
+	if value := r.URL.Query().Get("version"); value != "" {
+		number, err := strconv.Atoi(value)
+		version := video.version(number)
+		if err != nil || version == nil {
+			http.Error(w, "Versão não encontrada", http.StatusNotFound)
+			return ""
+		}
+		if version.Pruned {
+			http.Error(w, "Versão removida do histórico", http.StatusGone)
+			return ""
+		}
+		if version.Status == "completed" {
+			zipObjectName = version.ZipObjectName
+		}
+	} else if latest := video.latestCompletedVersion(); latest != nil {
+		zipObjectName = latest.ZipObjectName
+	} else if video.Status == "completed" {
+		zipObjectName = video.ZipObjectName
+	}
+
+	// Verificar se o vídeo foi processado
+	if zipObjectName == "" {
+		http.Error(w, "Vídeo ainda não foi processado", http.StatusNotFound)
+	}
+	return zipObjectName
+}
@@ -0,0 +1,160 @@
+package main
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/credentials"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// MinIO falso com um único objeto, registrando as requisições recebidas
+type fakeObjectStore struct {
+	mu       sync.Mutex
+	requests []string // "METHOD Range"
+	deleted  []string // bucket/objeto
+	content  []byte
+	etag     string
+	modified time.Time
+}
+
+func (f *fakeObjectStore) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	f.requests = append(f.requests, strings.TrimSpace(r.Method+" "+r.Header.Get("Range")))
+	f.mu.Unlock()
+
+	// Remoções e listagens por prefixo (retenção): nada a listar
+	if r.Method == http.MethodDelete {
+		f.mu.Lock()
+		f.deleted = append(f.deleted, strings.TrimPrefix(r.URL.Path, "/"))
+		f.mu.Unlock()
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	if r.URL.Query().Has("list-type") {
+		w.Header().Set("Content-Type", "application/xml")
+		w.Write([]byte(`<ListBucketResult><IsTruncated>false</IsTruncated></ListBucketResult>`))
+		return
+	}
+
+	if r.URL.Path != "/video-processed/frames_video_1.zip" {
+		w.Header().Set("Content-Type", "application/xml")
+		w.WriteHeader(http.StatusNotFound)
+		if r.Method != http.MethodHead {
+			w.Write([]byte(`<Error><Code>NoSuchKey</Code><Message>não existe</Message></Error>`))
+		}
+		return
+	}
+	w.Header().Set("ETag", `"`+f.etag+`"`)
+	http.ServeContent(w, r, "", f.modified, bytes.NewReader(f.content))
+}
+
+func (f *fakeObjectStore) gets() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var gets []string
+	for _, request := range f.requests {
+		if strings.HasPrefix(request, "GET") {
+			gets = append(gets, request)
+		}
+	}
+	return gets
+}
+
+func newFakeObjectStore(t *testing.T) (*fakeObjectStore, *StorageService) {
+	store := &fakeObjectStore{
+		content:  []byte(strings.Repeat("0123456789", 100)),
+		etag:     "abc123",
+		modified: time.Date(2024, 3, 10, 12, 0, 0, 0, time.UTC),
+	}
+	server := httptest.NewServer(store)
+	t.Cleanup(server.Close)
+
+	client, err := minio.New(strings.TrimPrefix(server.URL, "http://"), &minio.Options{
+		Creds:  credentials.NewStaticV4("chave", "segredo", ""),
+		Region: "us-east-1",
+	})
+	require.NoError(t, err)
+	return store, &StorageService{MinioClient: client}
+}
+
+func serveTestObject(ss *StorageService, method, object string, headers map[string]string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, "/download/video_1", nil)
+	for name, value := range headers {
+		req.Header.Set(name, value)
+	}
+	rec := httptest.NewRecorder()
+	ss.serveObject(rec, req, "video-processed", object, "frames_video_1.zip", "application/zip")
+	return rec
+}
+
+func TestServeObject(t *testing.T) {
+	const object = "frames_video_1.zip"
+
+	t.Run("download completo com ETag e Last-Modified", func(t *testing.T) {
+		store, ss := newFakeObjectStore(t)
+		rec := serveTestObject(ss, http.MethodGet, object, nil)
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.Equal(t, store.content, rec.Body.Bytes())
+		assert.Equal(t, "1000", rec.Header().Get("Content-Length"))
+		assert.Equal(t, "bytes", rec.Header().Get("Accept-Ranges"))
+		assert.Equal(t, `"abc123"`, rec.Header().Get("ETag"))
+		assert.Equal(t, "Sun, 10 Mar 2024 12:00:00 GMT", rec.Header().Get("Last-Modified"))
+		assert.Equal(t, "application/zip", rec.Header().Get("Content-Type"))
+	})
+
+	t.Run("Range é repassado ao MinIO", func(t *testing.T) {
+		store, ss := newFakeObjectStore(t)
+		rec := serveTestObject(ss, http.MethodGet, object, map[string]string{"Range": "bytes=990-"})
+		assert.Equal(t, http.StatusPartialContent, rec.Code)
+		assert.Equal(t, "bytes 990-999/1000", rec.Header().Get("Content-Range"))
+		assert.Equal(t, store.content[990:], rec.Body.Bytes())
+		require.NotEmpty(t, store.gets())
+		for _, get := range store.gets() {
+			assert.True(t, strings.HasPrefix(get, "GET bytes=990-"), "leitura fora do trecho pedido: %s", get)
+		}
+	})
+
+	t.Run("If-Range com ETag atual retoma do offset", func(t *testing.T) {
+		_, ss := newFakeObjectStore(t)
+		rec := serveTestObject(ss, http.MethodGet, object, map[string]string{"Range": "bytes=500-", "If-Range": `"abc123"`})
+		assert.Equal(t, http.StatusPartialContent, rec.Code)
+		assert.Equal(t, 500, rec.Body.Len())
+	})
+
+	t.Run("If-Range com ETag antigo devolve o arquivo inteiro", func(t *testing.T) {
+		_, ss := newFakeObjectStore(t)
+		rec := serveTestObject(ss, http.MethodGet, object, map[string]string{"Range": "bytes=500-", "If-Range": `"antigo"`})
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.Equal(t, 1000, rec.Body.Len())
+	})
+
+	t.Run("If-None-Match responde 304 sem ler o objeto", func(t *testing.T) {
+		store, ss := newFakeObjectStore(t)
+		rec := serveTestObject(ss, http.MethodGet, object, map[string]string{"If-None-Match": `"abc123"`})
+		assert.Equal(t, http.StatusNotModified, rec.Code)
+		assert.Empty(t, store.gets())
+	})
+
+	t.Run("HEAD informa o tamanho sem ler o objeto", func(t *testing.T) {
+		store, ss := newFakeObjectStore(t)
+		rec := serveTestObject(ss, http.MethodHead, object, nil)
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.Equal(t, "1000", rec.Header().Get("Content-Length"))
+		assert.Empty(t, rec.Body.Bytes())
+		assert.Empty(t, store.gets())
+	})
+
+	t.Run("objeto inexistente responde 404", func(t *testing.T) {
+		_, ss := newFakeObjectStore(t)
+		rec := serveTestObject(ss, http.MethodGet, "frames_outro.zip", nil)
+		assert.Equal(t, http.StatusNotFound, rec.Code)
+	})
+}
@@ -0,0 +1,248 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"time"
+
+	"github.com/streadway/amqp"
+)
+
+// Exchange topic com os eventos de ciclo de vida dos jobs (video.<job_type>.<evento>)
+const eventsExchange = "video.events"
+
+// Fila do storage-service e routing keys assinadas
+const storageEventsQueue = "storage.video_events"
+
+var storageEventKeys = []string{
+	"video.frames.*",
+	"video.transcode.completed",
+	"video.transcode.failed",
+	"video.batch.*",
+}
+
+// Evento de ciclo de vida publicado por upload-service e processing-service
+type JobEvent struct {
+	Event       string            `json:"event"`
+	VideoID     string            `json:"video_id"`
+	JobType     string            `json:"job_type"`
+	UserID      string            `json:"user_id"`
+	Sequence    int64             `json:"sequence"`
+	Timestamp   time.Time         `json:"timestamp"`
+	Filename    string            `json:"filename,omitempty"`
+	Object      string            `json:"object_name,omitempty"`  // original em video-uploads
+	ContentHash string            `json:"content_hash,omitempty"` // SHA-256 do original
+	Size        int64             `json:"size,omitempty"`         // bytes do original
+	Duration    float64           `json:"duration,omitempty"`     // segundos
+	BatchID     string            `json:"batch_id,omitempty"`
+	BatchSize   int               `json:"batch_size,omitempty"`
+	Attempt     int               `json:"attempt,omitempty"`
+	Stage       string            `json:"stage,omitempty"`
+	Progress    int               `json:"progress,omitempty"`
+	UserEmail   string            `json:"user_email,omitempty"`
+	UserName    string            `json:"user_name,omitempty"`
+	ExpiresAt   *time.Time        `json:"expires_at,omitempty"` // aviso de expiração
+	Result      *ProcessingResult `json:"result,omitempty"`
+}
+
+// Declarar exchange e fila do storage com os bindings por routing key
+func declareEventQueue(ch *amqp.Channel) error {
+	err := ch.ExchangeDeclare(eventsExchange, "topic", true, false, false, false, nil)
+	if err != nil {
+		return fmt.Errorf("erro ao declarar exchange de eventos: %v", err)
+	}
+
+	_, err = ch.QueueDeclare(storageEventsQueue, true, false, false, false, nil)
+	if err != nil {
+		return fmt.Errorf("erro ao declarar fila de eventos: %v", err)
+	}
+
+	for _, key := range storageEventKeys {
+		if err := ch.QueueBind(storageEventsQueue, key, eventsExchange, false, nil); err != nil {
+			return fmt.Errorf("erro ao assinar %s: %v", key, err)
+		}
+	}
+	return nil
+}
+
+// Aplicar um evento ao vídeo no banco; eventos com sequência já vista são descartados
+func (ss *StorageService) handleJobEvent(event JobEvent) error {
+	if event.JobType == "batch" {
+		return ss.handleBatchEvent(event)
+	}
+	err := ss.handleVideoEvent(event)
+	if errors.Is(err, errVideoDeleted) {
+		return ss.handleDeletedVideoEvent(event)
+	}
+	return err
+}
+
+func (ss *StorageService) handleVideoEvent(event JobEvent) error {
+	if event.JobType == "transcode" {
+		if event.Event == "failed" || event.Event == "cancelled" {
+			// Transcodificação encerrada sem resultado: só libera a reserva
+			if err := ss.recordEventUsage(event, nil); err != nil {
+				return err
+			}
+		}
+		if event.Result == nil {
+			return nil
+		}
+		if event.Event == "completed" {
+			video, err := ss.Videos.Get(ctx, event.VideoID)
+			if err != nil && !errors.Is(err, errVideoNotFound) {
+				return err
+			}
+			if err := ss.recordEventUsage(event, video); err != nil {
+				return err
+			}
+		}
+		return ss.storeVideoMetadata(*event.Result)
+	}
+
+	video, err := ss.Videos.Get(ctx, event.VideoID)
+	if err != nil && !errors.Is(err, errVideoNotFound) {
+		return err
+	}
+	// Antes do descarte por sequência: o registro é idempotente e uma entrega
+	// anterior pode ter aplicado o evento sem registrar o consumo
+	if err := ss.recordEventUsage(event, video); err != nil {
+		return err
+	}
+	stale := video != nil && event.Sequence <= video.LastEventSeq
+	batchID := event.BatchID
+	if video != nil && video.BatchID != "" {
+		batchID = video.BatchID
+	}
+	if stale {
+		log.Printf("Evento %s do vídeo %s ignorado (sequência %d já aplicada)", event.Event, event.VideoID, event.Sequence)
+		// O finalizador pode não ter sido enfileirado na entrega anterior
+		return ss.checkBatch(batchID)
+	}
+
+	userID, _ := strconv.Atoi(event.UserID)
+
+	switch event.Event {
+	case "completed", "failed", "cancelled":
+		if event.Result == nil {
+			return fmt.Errorf("evento %s sem resultado", event.Event)
+		}
+		if err := ss.storeVideoMetadata(*event.Result); err != nil {
+			return err
+		}
+
+		err := ss.Videos.Update(ctx, event.VideoID, func(video *VideoData) (*VideoData, error) {
+			if video == nil {
+				return nil, nil
+			}
+			if event.Object != "" {
+				video.OriginalObject = event.Object
+			}
+			if event.ContentHash != "" {
+				video.ContentHash = event.ContentHash
+			}
+			applyOriginalInfo(video, event)
+			if event.UserEmail != "" {
+				video.UserEmail, video.UserName = event.UserEmail, event.UserName
+			}
+			video.LastEventSeq = event.Sequence
+			if event.Event == "cancelled" {
+				video.Status = "cancelled"
+				if version := video.version(max(event.Result.Version, 1)); version != nil {
+					version.Status = "cancelled"
+				}
+			}
+			if event.Event == "completed" {
+				video.Progress = 100
+			}
+			trackBatchMember(video, event)
+			return video, nil
+		})
+		if err != nil {
+			return err
+		}
+		if err := ss.registerBatch(event, userID); err != nil {
+			return err
+		}
+		return ss.checkBatch(batchID)
+	}
+
+	// Progresso é o evento mais frequente: gravar só status e progresso
+	if event.Event == "progress" && video != nil {
+		_, err := ss.Videos.UpdateStatus(ctx, event.VideoID, "processing", event.Progress, event.Sequence)
+		return err
+	}
+
+	if video == nil {
+		title := event.Filename
+		if title == "" {
+			title = "Video sem nome"
+		}
+		video = &VideoData{
+			VideoID:    event.VideoID,
+			Title:      title,
+			UploadedAt: event.Timestamp,
+			UserID:     userID,
+		}
+		applyJobEvent(video, event)
+		err := ss.Videos.Create(ctx, video)
+		if err == nil {
+			return ss.registerBatch(event, userID)
+		}
+		if !errors.Is(err, errVideoExists) {
+			return err
+		}
+		// Registrado por outra réplica: aplicar o evento sobre o registro
+	}
+
+	err = ss.Videos.Update(ctx, event.VideoID, func(video *VideoData) (*VideoData, error) {
+		// Removido ou já atualizado por outra réplica depois da leitura
+		if video == nil || event.Sequence <= video.LastEventSeq {
+			return nil, nil
+		}
+		applyJobEvent(video, event)
+		return video, nil
+	})
+	if err != nil {
+		return err
+	}
+	return ss.registerBatch(event, userID)
+}
+
+// Aplicar um evento não terminal (uploaded, queued, started, progress)
+func applyJobEvent(video *VideoData, event JobEvent) {
+	switch event.Event {
+	case "uploaded", "queued":
+		video.Status = "queued"
+		video.Progress = 0
+	case "started":
+		video.Status = "processing"
+		video.Progress = 0
+		video.ErrorCode, video.ErrorMessage, video.Retryable = "", "", false
+	case "progress":
+		video.Status = "processing"
+		video.Progress = event.Progress
+	}
+	if event.Object != "" {
+		video.OriginalObject = event.Object
+	}
+	if event.ContentHash != "" {
+		video.ContentHash = event.ContentHash
+	}
+	applyOriginalInfo(video, event)
+	video.Attempts = event.Attempt
+	video.LastEventSeq = event.Sequence
+	trackBatchMember(video, event)
+}
+
+// Tamanho e duração do original; eventos de versões antigas não os trazem
+func applyOriginalInfo(video *VideoData, event JobEvent) {
+	if event.Size > 0 {
+		video.Size = event.Size
+	}
+	if event.Duration > 0 {
+		video.Duration = event.Duration
+	}
+}
@@ -0,0 +1,212 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/minio/minio-go/v7"
+)
+
+// Largura máxima aceita para o frame sob demanda
+const maxFrameWidth = 3840
+
+// Formatos de saída do frame sob demanda
+var frameFormats = map[string]struct {
+	Codec       string
+	ContentType string
+	Ext         string
+}{
+	"jpeg": {"mjpeg", "image/jpeg", "jpg"},
+	"png":  {"png", "image/png", "png"},
+}
+
+// Timestamp além do fim do vídeo: o ffmpeg termina sem gerar frame
+var errFrameOutOfRange = errors.New("timestamp além do fim do vídeo")
+
+// Limite de ffmpeg simultâneos para não saturar o serviço (FRAME_MAX_CONCURRENCY)
+var frameSlots = make(chan struct{}, frameConcurrency())
+
+func frameConcurrency() int {
+	n, err := strconv.Atoi(getEnv("FRAME_MAX_CONCURRENCY", "4"))
+	if err != nil || n < 1 {
+		return 4
+	}
+	return n
+}
+
+// Aceitar segundos ("12.5") ou relógio ("00:12.5", "01:02:03.5")
+func parseFrameTimestamp(value string) (float64, error) {
+	if value == "" {
+		return 0, fmt.Errorf("parâmetro t obrigatório")
+	}
+
+	var seconds float64
+	parts := strings.Split(value, ":")
+	if len(parts) > 3 {
+		return 0, fmt.Errorf("timestamp inválido: %s", value)
+	}
+	for i, part := range parts {
+		n, err := strconv.ParseFloat(part, 64)
+		if err != nil || n < 0 || (i > 0 && n >= 60) {
+			return 0, fmt.Errorf("timestamp inválido: %s", value)
+		}
+		seconds = seconds*60 + n
+	}
+	return seconds, nil
+}
+
+// Frame do vídeo original em um instante; o resultado fica em cache no MinIO
+// (frames-cache/<video>/...) para que pedidos repetidos não rodem o ffmpeg
+func (ss *StorageService) GetFrameHandler(w http.ResponseWriter, r *http.Request) {
+	videoID := mux.Vars(r)["id"]
+
+	// Usuário verificado pelo middleware de autenticação
+	userID, err := requestUserID(r)
+	if err != nil {
+		http.Error(w, "Token de autenticação inválido", http.StatusUnauthorized)
+		return
+	}
+
+	// Verificar se o vídeo pertence ao usuário
+	video := ss.ownedVideo(w, r, videoID, userID)
+	if video == nil {
+		return
+	}
+	originalObject := video.OriginalObject
+
+	if video.OriginalExpiredAt != nil {
+		http.Error(w, "Vídeo original expirou", http.StatusGone)
+		return
+	}
+	if originalObject == "" {
+		http.Error(w, "Vídeo original não disponível", http.StatusNotFound)
+		return
+	}
+
+	query := r.URL.Query()
+	at, err := parseFrameTimestamp(query.Get("t"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	formatName := strings.ToLower(query.Get("format"))
+	if formatName == "" || formatName == "jpg" {
+		formatName = "jpeg"
+	}
+	format, ok := frameFormats[formatName]
+	if !ok {
+		http.Error(w, "Formato não suportado. Use: jpeg, png", http.StatusBadRequest)
+		return
+	}
+
+	width := 0
+	if value := query.Get("width"); value != "" {
+		width, err = strconv.Atoi(value)
+		if err != nil || width < 1 || width > maxFrameWidth {
+			http.Error(w, fmt.Sprintf("width deve estar entre 1 e %d", maxFrameWidth), http.StatusBadRequest)
+			return
+		}
+	}
+
+	cacheObject := fmt.Sprintf("frames-cache/%s/%d_%d.%s", videoID, int64(at*1000), width, format.Ext)
+	if ss.serveCachedFrame(w, cacheObject, format.ContentType) {
+		return
+	}
+
+	frame, err := ss.grabFrame(r.Context(), originalObject, at, width, format.Codec)
+	if err != nil {
+		if errors.Is(err, errFrameOutOfRange) {
+			http.Error(w, "Timestamp além do fim do vídeo", http.StatusUnprocessableEntity)
+			return
+		}
+		log.Printf("Erro ao extrair frame de %s em %.3fs: %v", videoID, at, err)
+		http.Error(w, "Erro ao extrair frame", http.StatusInternalServerError)
+		return
+	}
+
+	_, err = ss.MinioClient.PutObject(context.Background(), "video-processed", cacheObject, bytes.NewReader(frame), int64(len(frame)), minio.PutObjectOptions{
+		ContentType: format.ContentType,
+	})
+	if err != nil {
+		log.Printf("Erro ao gravar frame em cache (%s): %v", cacheObject, err)
+	}
+
+	w.Header().Set("Content-Type", format.ContentType)
+	w.Header().Set("Content-Length", strconv.Itoa(len(frame)))
+	w.Header().Set("Cache-Control", "private, max-age=86400")
+	w.Header().Set("X-Frame-Cache", "MISS")
+	w.Write(frame)
+}
+
+func (ss *StorageService) serveCachedFrame(w http.ResponseWriter, objectName, contentType string) bool {
+	object, err := ss.MinioClient.GetObject(context.Background(), "video-processed", objectName, minio.GetObjectOptions{})
+	if err != nil {
+		return false
+	}
+	defer object.Close()
+
+	info, err := object.Stat()
+	if err != nil {
+		return false
+	}
+
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Content-Length", strconv.FormatInt(info.Size, 10))
+	w.Header().Set("Cache-Control", "private, max-age=86400")
+	w.Header().Set("X-Frame-Cache", "HIT")
+	if _, err := io.Copy(w, object); err != nil {
+		log.Printf("Erro ao copiar frame em cache: %v", err)
+	}
+	return true
+}
+
+// Decodificar um único frame lendo o original direto do MinIO: o ffmpeg busca
+// o instante com requisições Range na URL pré-assinada, sem baixar o vídeo
+func (ss *StorageService) grabFrame(ctx context.Context, originalObject string, at float64, width int, codec string) ([]byte, error) {
+	url, err := ss.MinioClient.PresignedGetObject(ctx, "video-uploads", originalObject, 15*time.Minute, nil)
+	if err != nil {
+		return nil, fmt.Errorf("erro ao gerar URL do original: %v", err)
+	}
+
+	select {
+	case frameSlots <- struct{}{}:
+		defer func() { <-frameSlots }()
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+
+	args := []string{"-hide_banner", "-loglevel", "error", "-ss", fmt.Sprintf("%.3f", at), "-i", url.String(), "-frames:v", "1"}
+	if width > 0 {
+		args = append(args, "-vf", fmt.Sprintf("scale=%d:-2", width))
+	}
+	if codec == "mjpeg" {
+		args = append(args, "-q:v", "2")
+	}
+	args = append(args, "-f", "image2pipe", "-c:v", codec, "pipe:1")
+
+	var stdout, stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, "ffmpeg", args...)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("erro no ffmpeg: %v: %s", err, strings.TrimSpace(stderr.String()))
+	}
+	if stdout.Len() == 0 {
+		return nil, errFrameOutOfRange
+	}
+	return stdout.Bytes(), nil
+}
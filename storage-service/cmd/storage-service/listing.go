@@ -0,0 +1,166 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Tamanho padrão e máximo de uma página de GET /videos
+const (
+	defaultPageSize = 20
+	maxPageSize     = 100
+)
+
+// Parâmetros de GET /videos já validados
+type videoListQuery struct {
+	Filter VideoFilter
+	After  *VideoCursor
+	Limit  int
+}
+
+// Cursor entregue ao cliente: a posição e a ordenação em que foi gerado, para
+// recusar cursores usados com outra ordenação
+type listCursor struct {
+	SortBy    string `json:"sort"`
+	Ascending bool   `json:"asc,omitempty"`
+	VideoCursor
+}
+
+func encodeListCursor(filter VideoFilter, cursor *VideoCursor) string {
+	if cursor == nil {
+		return ""
+	}
+	body, _ := json.Marshal(listCursor{SortBy: filter.SortBy, Ascending: filter.Ascending, VideoCursor: *cursor})
+	return base64.RawURLEncoding.EncodeToString(body)
+}
+
+func decodeListCursor(value string, filter VideoFilter) (*VideoCursor, error) {
+	body, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil {
+		return nil, errors.New("cursor inválido")
+	}
+	var cursor listCursor
+	if err := json.Unmarshal(body, &cursor); err != nil || cursor.VideoID == "" {
+		return nil, errors.New("cursor inválido")
+	}
+	if cursor.SortBy != filter.SortBy || cursor.Ascending != filter.Ascending {
+		return nil, errors.New("cursor gerado com outra ordenação; refaça a busca a partir da primeira página")
+	}
+	return &cursor.VideoCursor, nil
+}
+
+// Interpretar a query string de GET /videos:
+//
+//	limit, cursor                       paginação
+//	status                              queued, processing, completed, ...
+//	uploaded_from, uploaded_to          RFC 3339 ou AAAA-MM-DD (uploaded_to inclui o dia)
+//	min_duration, max_duration          segundos
+//	min_size, max_size                  bytes
+//	q, search=substring|fulltext        busca no título
+//	sort=uploaded_at|status|duration|size, order=asc|desc
+func parseVideoListQuery(query url.Values) (*videoListQuery, error) {
+	list := &videoListQuery{Limit: defaultPageSize}
+	filter := &list.Filter
+
+	if value := query.Get("limit"); value != "" {
+		limit, err := strconv.Atoi(value)
+		if err != nil || limit < 1 || limit > maxPageSize {
+			return nil, fmt.Errorf("limit deve estar entre 1 e %d", maxPageSize)
+		}
+		list.Limit = limit
+	}
+
+	filter.Status = query.Get("status")
+
+	filter.SortBy = query.Get("sort")
+	if !validSortBy(filter.SortBy) {
+		return nil, errors.New("sort inválido. Use: uploaded_at, status, duration, size")
+	}
+	if filter.SortBy == "" {
+		filter.SortBy = SortByUploadedAt
+	}
+	switch strings.ToLower(query.Get("order")) {
+	case "", "desc":
+	case "asc":
+		filter.Ascending = true
+	default:
+		return nil, errors.New("order inválido. Use: asc, desc")
+	}
+
+	var err error
+	if filter.UploadedFrom, err = parseListDate(query.Get("uploaded_from"), false); err != nil {
+		return nil, fmt.Errorf("uploaded_from: %v", err)
+	}
+	if filter.UploadedTo, err = parseListDate(query.Get("uploaded_to"), true); err != nil {
+		return nil, fmt.Errorf("uploaded_to: %v", err)
+	}
+	if !filter.UploadedFrom.IsZero() && !filter.UploadedTo.IsZero() && !filter.UploadedFrom.Before(filter.UploadedTo) {
+		return nil, errors.New("uploaded_from deve ser anterior a uploaded_to")
+	}
+
+	for name, target := range map[string]*float64{"min_duration": &filter.MinDuration, "max_duration": &filter.MaxDuration} {
+		if value := query.Get(name); value != "" {
+			duration, err := strconv.ParseFloat(value, 64)
+			if err != nil || duration < 0 {
+				return nil, fmt.Errorf("%s deve ser um número de segundos não negativo", name)
+			}
+			*target = duration
+		}
+	}
+	for name, target := range map[string]*int64{"min_size": &filter.MinSize, "max_size": &filter.MaxSize} {
+		if value := query.Get(name); value != "" {
+			size, err := strconv.ParseInt(value, 10, 64)
+			if err != nil || size < 0 {
+				return nil, fmt.Errorf("%s deve ser um número de bytes não negativo", name)
+			}
+			*target = size
+		}
+	}
+	if filter.MaxDuration > 0 && filter.MinDuration > filter.MaxDuration {
+		return nil, errors.New("min_duration maior que max_duration")
+	}
+	if filter.MaxSize > 0 && filter.MinSize > filter.MaxSize {
+		return nil, errors.New("min_size maior que max_size")
+	}
+
+	filter.Search = strings.TrimSpace(query.Get("q"))
+	switch query.Get("search") {
+	case "", "substring":
+	case "fulltext":
+		filter.FullText = true
+	default:
+		return nil, errors.New("search inválido. Use: substring, fulltext")
+	}
+
+	if value := query.Get("cursor"); value != "" {
+		if list.After, err = decodeListCursor(value, *filter); err != nil {
+			return nil, err
+		}
+	}
+	return list, nil
+}
+
+// Data em RFC 3339 ou só o dia (UTC); com endOfDay, o dia inteiro fica
+// incluído no intervalo
+func parseListDate(value string, endOfDay bool) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	day, err := time.Parse("2006-01-02", value)
+	if err != nil {
+		return time.Time{}, errors.New("data inválida. Use RFC 3339 ou AAAA-MM-DD")
+	}
+	if endOfDay {
+		day = day.AddDate(0, 0, 1)
+	}
+	return day, nil
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseVideoListQuery(t *testing.T) {
+	t.Run("padrões", func(t *testing.T) {
+		list, err := parseVideoListQuery(url.Values{})
+		require.NoError(t, err)
+		assert.Equal(t, defaultPageSize, list.Limit)
+		assert.Equal(t, VideoFilter{SortBy: SortByUploadedAt}, list.Filter)
+		assert.Nil(t, list.After)
+	})
+
+	t.Run("filtros e ordenação", func(t *testing.T) {
+		list, err := parseVideoListQuery(url.Values{
+			"limit":         {"50"},
+			"status":        {"completed"},
+			"uploaded_from": {"2024-03-01"},
+			"uploaded_to":   {"2024-03-10"},
+			"min_duration":  {"1.5"},
+			"max_duration":  {"60"},
+			"min_size":      {"1024"},
+			"q":             {"  praia 2024 "},
+			"search":        {"fulltext"},
+			"sort":          {"size"},
+			"order":         {"asc"},
+		})
+		require.NoError(t, err)
+		assert.Equal(t, 50, list.Limit)
+		assert.Equal(t, VideoFilter{
+			Status:       "completed",
+			SortBy:       SortBySize,
+			Ascending:    true,
+			UploadedFrom: time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC),
+			// O dia de uploaded_to fica incluído
+			UploadedTo:  time.Date(2024, 3, 11, 0, 0, 0, 0, time.UTC),
+			MinDuration: 1.5,
+			MaxDuration: 60,
+			MinSize:     1024,
+			Search:      "praia 2024",
+			FullText:    true,
+		}, list.Filter)
+	})
+
+	invalid := map[string]url.Values{
+		"limit zero":             {"limit": {"0"}},
+		"limit acima do máximo":  {"limit": {"101"}},
+		"sort desconhecido":      {"sort": {"title"}},
+		"order desconhecida":     {"order": {"up"}},
+		"data inválida":          {"uploaded_from": {"ontem"}},
+		"intervalo invertido":    {"uploaded_from": {"2024-03-10"}, "uploaded_to": {"2024-03-01"}},
+		"duração negativa":       {"min_duration": {"-1"}},
+		"tamanho não numérico":   {"max_size": {"1MB"}},
+		"mínimo acima do máximo": {"min_size": {"10"}, "max_size": {"5"}},
+		"modo de busca inválido": {"search": {"regex"}},
+		"cursor corrompido":      {"cursor": {"???"}},
+	}
+	for name, query := range invalid {
+		t.Run(name, func(t *testing.T) {
+			_, err := parseVideoListQuery(query)
+			assert.Error(t, err)
+		})
+	}
+}
+
+func TestListCursor(t *testing.T) {
+	filter := VideoFilter{SortBy: SortByDuration}
+	cursor := &VideoCursor{VideoID: "video_1", UploadedAt: baseTime.Add(time.Nanosecond), Duration: 12.25}
+	encoded := encodeListCursor(filter, cursor)
+
+	list, err := parseVideoListQuery(url.Values{"sort": {"duration"}, "cursor": {encoded}})
+	require.NoError(t, err)
+	assert.Equal(t, cursor.VideoID, list.After.VideoID)
+	assert.Equal(t, cursor.Duration, list.After.Duration)
+	assert.True(t, cursor.UploadedAt.Equal(list.After.UploadedAt))
+
+	// O cursor só vale para a ordenação em que foi gerado
+	_, err = parseVideoListQuery(url.Values{"sort": {"duration"}, "order": {"asc"}, "cursor": {encoded}})
+	assert.Error(t, err)
+	_, err = parseVideoListQuery(url.Values{"cursor": {encoded}})
+	assert.Error(t, err)
+
+	assert.Empty(t, encodeListCursor(filter, nil))
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"database/sql"
+	"embed"
+	"fmt"
+	"log"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Migrações versionadas (NNNN_descricao.sql), aplicadas em ordem na
+// inicialização e registradas em schema_migrations
+//
+//go:embed migrations/*.sql
+var migrationFiles embed.FS
+
+// Chave do advisory lock que impede duas réplicas de migrarem ao mesmo tempo
+const migrationLockKey = 7310041
+
+type migration struct {
+	Version int
+	Name    string
+	SQL     string
+}
+
+func loadMigrations() ([]migration, error) {
+	entries, err := migrationFiles.ReadDir("migrations")
+	if err != nil {
+		return nil, err
+	}
+
+	var migrations []migration
+	for _, entry := range entries {
+		prefix, _, found := strings.Cut(entry.Name(), "_")
+		version, err := strconv.Atoi(prefix)
+		if !found || err != nil {
+			return nil, fmt.Errorf("nome de migração inválido: %s", entry.Name())
+		}
+		data, err := migrationFiles.ReadFile(path.Join("migrations", entry.Name()))
+		if err != nil {
+			return nil, err
+		}
+		migrations = append(migrations, migration{Version: version, Name: entry.Name(), SQL: string(data)})
+	}
+
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].Version < migrations[j].Version })
+	for i := 1; i < len(migrations); i++ {
+		if migrations[i].Version == migrations[i-1].Version {
+			return nil, fmt.Errorf("migrações com a mesma versão: %s e %s", migrations[i-1].Name, migrations[i].Name)
+		}
+	}
+	return migrations, nil
+}
+
+// Aplicar as migrações pendentes, cada uma em sua própria transação
+func runMigrations(db *sql.DB) error {
+	migrations, err := loadMigrations()
+	if err != nil {
+		return fmt.Errorf("erro ao carregar migrações: %v", err)
+	}
+
+	// O advisory lock é da sessão: usar sempre a mesma conexão
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	if _, err := conn.ExecContext(ctx, "SELECT pg_advisory_lock($1)", migrationLockKey); err != nil {
+		return fmt.Errorf("erro ao obter lock de migração: %v", err)
+	}
+	defer conn.ExecContext(ctx, "SELECT pg_advisory_unlock($1)", migrationLockKey)
+
+	_, err = conn.ExecContext(ctx, `
+		CREATE TABLE IF NOT EXISTS schema_migrations (
+			version INTEGER PRIMARY KEY,
+			name VARCHAR(255) NOT NULL,
+			applied_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+		)
+	`)
+	if err != nil {
+		return fmt.Errorf("erro ao criar tabela de migrações: %v", err)
+	}
+
+	applied := make(map[int]bool)
+	rows, err := conn.QueryContext(ctx, "SELECT version FROM schema_migrations")
+	if err != nil {
+		return err
+	}
+	for rows.Next() {
+		var version int
+		if err := rows.Scan(&version); err != nil {
+			rows.Close()
+			return err
+		}
+		applied[version] = true
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for _, m := range migrations {
+		if applied[m.Version] {
+			continue
+		}
+
+		tx, err := conn.BeginTx(ctx, nil)
+		if err != nil {
+			return err
+		}
+		if _, err := tx.ExecContext(ctx, m.SQL); err != nil {
+			tx.Rollback()
+			return fmt.Errorf("erro na migração %s: %v", m.Name, err)
+		}
+		if _, err := tx.ExecContext(ctx, "INSERT INTO schema_migrations (version, name) VALUES ($1, $2)", m.Version, m.Name); err != nil {
+			tx.Rollback()
+			return fmt.Errorf("erro ao registrar migração %s: %v", m.Name, err)
+		}
+		if err := tx.Commit(); err != nil {
+			return fmt.Errorf("erro ao aplicar migração %s: %v", m.Name, err)
+		}
+		log.Printf("Migração aplicada: %s", m.Name)
+	}
+	return nil
+}
@@ -0,0 +1,58 @@
+-- Vídeos enviados, um registro por upload. Os usuários ficam no banco do
+-- auth-service, então user_id não tem chave estrangeira; o id é o video_id
+-- gerado no upload
+
+-- Bancos inicializados pelo antigo scripts/create_database.sql têm uma
+-- processing_jobs com ids UUID, que o CREATE TABLE IF NOT EXISTS manteria em
+-- silêncio. Os ids não têm conversão (video_id é texto, user_id é inteiro do
+-- auth-service), então a migração para com uma mensagem clara
+DO $$
+BEGIN
+    IF EXISTS (
+        SELECT 1 FROM information_schema.columns
+        WHERE table_schema = current_schema()
+          AND table_name = 'processing_jobs'
+          AND column_name IN ('id', 'user_id')
+          AND data_type = 'uuid'
+    ) THEN
+        RAISE EXCEPTION 'processing_jobs usa o esquema legado de scripts/create_database.sql (ids UUID); renomeie ou remova a tabela antes de iniciar o storage-service';
+    END IF;
+END $$;
+
+CREATE TABLE IF NOT EXISTS processing_jobs (
+    id VARCHAR(64) PRIMARY KEY,
+    user_id INTEGER NOT NULL,
+    original_filename VARCHAR(255) NOT NULL,
+    file_path VARCHAR(500) NOT NULL DEFAULT '',
+    file_size BIGINT NOT NULL DEFAULT 0,
+    mime_type VARCHAR(50) NOT NULL DEFAULT '',
+    -- Status: queued, processing, completed, error, cancelled
+    status VARCHAR(20) NOT NULL DEFAULT 'queued',
+    progress INTEGER NOT NULL DEFAULT 0,
+    frames_extracted INTEGER NOT NULL DEFAULT 0,
+    total_frames INTEGER,
+    error_message TEXT NOT NULL DEFAULT '',
+    result_zip_path VARCHAR(500) NOT NULL DEFAULT '',
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    started_at TIMESTAMP WITH TIME ZONE,
+    completed_at TIMESTAMP WITH TIME ZONE,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_jobs_user_id ON processing_jobs(user_id);
+CREATE INDEX IF NOT EXISTS idx_jobs_status ON processing_jobs(status);
+CREATE INDEX IF NOT EXISTS idx_jobs_created_at ON processing_jobs(created_at);
+CREATE INDEX IF NOT EXISTS idx_jobs_user_status ON processing_jobs(user_id, status);
+
+CREATE OR REPLACE FUNCTION update_updated_at_column()
+RETURNS TRIGGER AS $$
+BEGIN
+    NEW.updated_at = CURRENT_TIMESTAMP;
+    RETURN NEW;
+END;
+$$ language 'plpgsql';
+
+DROP TRIGGER IF EXISTS update_jobs_updated_at ON processing_jobs;
+CREATE TRIGGER update_jobs_updated_at
+    BEFORE UPDATE ON processing_jobs
+    FOR EACH ROW EXECUTE FUNCTION update_updated_at_column();
@@ -0,0 +1,37 @@
+-- Resultados do processamento que não existiam no esquema original: código de
+-- erro, sequência de eventos, legendas, shots, rendições e versão atual
+ALTER TABLE processing_jobs
+    ADD COLUMN result_zip_size BIGINT NOT NULL DEFAULT 0,
+    ADD COLUMN content_hash VARCHAR(64) NOT NULL DEFAULT '',
+    ADD COLUMN error_code VARCHAR(50) NOT NULL DEFAULT '',
+    ADD COLUMN retryable BOOLEAN NOT NULL DEFAULT false,
+    ADD COLUMN attempts INTEGER NOT NULL DEFAULT 0,
+    ADD COLUMN last_event_seq BIGINT NOT NULL DEFAULT 0,
+    ADD COLUMN subtitle_languages TEXT[] NOT NULL DEFAULT '{}',
+    ADD COLUMN chapter_count INTEGER NOT NULL DEFAULT 0,
+    ADD COLUMN shot_count INTEGER NOT NULL DEFAULT 0,
+    ADD COLUMN shots_object VARCHAR(500) NOT NULL DEFAULT '',
+    ADD COLUMN shots_csv_object VARCHAR(500) NOT NULL DEFAULT '',
+    ADD COLUMN renditions TEXT[] NOT NULL DEFAULT '{}',
+    ADD COLUMN hls_master_object VARCHAR(500) NOT NULL DEFAULT '',
+    ADD COLUMN current_version INTEGER NOT NULL DEFAULT 0;
+
+-- Uma linha por execução (upload original e reprocessamentos)
+CREATE TABLE IF NOT EXISTS processing_job_versions (
+    job_id VARCHAR(64) NOT NULL REFERENCES processing_jobs(id) ON DELETE CASCADE,
+    version INTEGER NOT NULL,
+    status VARCHAR(20) NOT NULL,
+    options JSONB,
+    requested_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    processed_at TIMESTAMP WITH TIME ZONE,
+    frame_count INTEGER NOT NULL DEFAULT 0,
+    zip_size BIGINT NOT NULL DEFAULT 0,
+    shot_count INTEGER NOT NULL DEFAULT 0,
+    error_code VARCHAR(50) NOT NULL DEFAULT '',
+    error_message TEXT NOT NULL DEFAULT '',
+    pruned BOOLEAN NOT NULL DEFAULT false,
+    zip_object_name VARCHAR(500) NOT NULL DEFAULT '',
+    shots_object VARCHAR(500) NOT NULL DEFAULT '',
+    shots_csv_object VARCHAR(500) NOT NULL DEFAULT '',
+    PRIMARY KEY (job_id, version)
+);
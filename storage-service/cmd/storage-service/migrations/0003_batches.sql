@@ -0,0 +1,20 @@
+-- Lotes de upload; os vídeos de cada lote são os jobs com o mesmo batch_id
+CREATE TABLE IF NOT EXISTS processing_batches (
+    id VARCHAR(64) PRIMARY KEY,
+    user_id INTEGER NOT NULL,
+    -- Status: processing, finalizing, completed, partial, failed
+    status VARCHAR(20) NOT NULL DEFAULT 'processing',
+    size INTEGER NOT NULL,
+    completed INTEGER NOT NULL DEFAULT 0,
+    failed INTEGER NOT NULL DEFAULT 0,
+    zip_size BIGINT NOT NULL DEFAULT 0,
+    zip_object_name VARCHAR(500) NOT NULL DEFAULT '',
+    error_code VARCHAR(50) NOT NULL DEFAULT '',
+    last_event_seq BIGINT NOT NULL DEFAULT 0,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    completed_at TIMESTAMP WITH TIME ZONE
+);
+
+ALTER TABLE processing_jobs ADD COLUMN batch_id VARCHAR(64);
+
+CREATE INDEX IF NOT EXISTS idx_jobs_batch_id ON processing_jobs(batch_id);
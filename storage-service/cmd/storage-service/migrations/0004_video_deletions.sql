@@ -0,0 +1,19 @@
+-- Exclusões de vídeos: o registro em processing_jobs sai na hora e os objetos
+-- no MinIO são removidos em segundo plano. A linha permanece depois de
+-- concluída para que eventos atrasados não recriem o vídeo
+CREATE TABLE IF NOT EXISTS video_deletions (
+    video_id VARCHAR(64) PRIMARY KEY,
+    user_id INTEGER NOT NULL,
+    -- Status: pending, completed
+    status VARCHAR(20) NOT NULL DEFAULT 'pending',
+    -- Objetos e prefixos a remover: [{"bucket": ..., "object": ...} | {"bucket": ..., "prefix": ...}]
+    targets JSONB NOT NULL DEFAULT '[]',
+    attempts INTEGER NOT NULL DEFAULT 0,
+    last_error TEXT NOT NULL DEFAULT '',
+    requested_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    -- Próxima tentativa; também funciona como lease enquanto uma réplica remove
+    next_attempt_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    completed_at TIMESTAMP WITH TIME ZONE
+);
+
+CREATE INDEX IF NOT EXISTS idx_video_deletions_pending ON video_deletions(next_attempt_at) WHERE status = 'pending';
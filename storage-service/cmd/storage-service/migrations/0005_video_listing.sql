@@ -0,0 +1,17 @@
+-- Listagem paginada dos vídeos: duração do original (file_size já existia),
+-- busca por trecho do título (trigramas) e por palavras (full-text) e índices
+-- para as ordenações por usuário
+ALTER TABLE processing_jobs ADD COLUMN duration_seconds DOUBLE PRECISION NOT NULL DEFAULT 0;
+
+CREATE EXTENSION IF NOT EXISTS pg_trgm;
+
+CREATE INDEX IF NOT EXISTS idx_jobs_title_trgm ON processing_jobs USING GIN (original_filename gin_trgm_ops);
+
+-- Mesma expressão usada nas consultas (titleSearchVector): pontuação do nome
+-- do arquivo vira espaço, então "ferias_2024.mp4" tem as palavras ferias, 2024 e mp4
+CREATE INDEX IF NOT EXISTS idx_jobs_title_fts ON processing_jobs
+    USING GIN (to_tsvector('simple', regexp_replace(original_filename, '[^[:alnum:]]+', ' ', 'g')));
+
+CREATE INDEX IF NOT EXISTS idx_jobs_user_created ON processing_jobs(user_id, created_at, id);
+CREATE INDEX IF NOT EXISTS idx_jobs_user_size ON processing_jobs(user_id, file_size, id);
+CREATE INDEX IF NOT EXISTS idx_jobs_user_duration ON processing_jobs(user_id, duration_seconds, id);
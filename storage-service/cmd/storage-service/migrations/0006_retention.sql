@@ -0,0 +1,16 @@
+-- Retenção dos artefatos: os prazos contam do último processamento concluído
+-- (processed_at); o janitor registra a expiração do original e dos frames
+-- (status expired) e o aviso enviado antes dela, para o qual guarda o contato
+-- do dono recebido nos eventos finais
+ALTER TABLE processing_jobs
+    ADD COLUMN processed_at TIMESTAMP WITH TIME ZONE,
+    ADD COLUMN original_expired_at TIMESTAMP WITH TIME ZONE,
+    ADD COLUMN expired_at TIMESTAMP WITH TIME ZONE,
+    ADD COLUMN expiry_warned_at TIMESTAMP WITH TIME ZONE,
+    ADD COLUMN user_email VARCHAR(255) NOT NULL DEFAULT '',
+    ADD COLUMN user_name VARCHAR(255) NOT NULL DEFAULT '';
+
+-- Vídeos concluídos antes desta migração contam da conclusão
+UPDATE processing_jobs SET processed_at = COALESCE(completed_at, created_at) WHERE status = 'completed';
+
+CREATE INDEX IF NOT EXISTS idx_jobs_processed_at ON processing_jobs(processed_at) WHERE processed_at IS NOT NULL;
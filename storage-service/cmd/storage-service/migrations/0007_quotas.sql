@@ -0,0 +1,37 @@
+-- Cotas por usuário. O consumo do mês vem de usage_records: um registro por
+-- upload (videos = 1) e por job de frames ou transcodificação concluído
+-- (segundos de vídeo processados). Não há chave estrangeira para
+-- processing_jobs: excluir o vídeo não devolve o consumo do mês
+CREATE TABLE IF NOT EXISTS usage_records (
+    video_id VARCHAR(64) NOT NULL,
+    -- Tipo: upload, frames, transcode
+    kind VARCHAR(20) NOT NULL,
+    version INTEGER NOT NULL DEFAULT 0,
+    user_id INTEGER NOT NULL,
+    recorded_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    videos INTEGER NOT NULL DEFAULT 0,
+    processing_seconds DOUBLE PRECISION NOT NULL DEFAULT 0,
+    PRIMARY KEY (video_id, kind, version)
+);
+
+CREATE INDEX IF NOT EXISTS idx_usage_user_recorded ON usage_records(user_id, recorded_at);
+
+-- Exceções aos limites padrão (variáveis QUOTA_*); NULL usa o padrão e 0 é ilimitado
+CREATE TABLE IF NOT EXISTS user_quotas (
+    user_id INTEGER PRIMARY KEY,
+    max_storage_bytes BIGINT,
+    max_videos_per_month INTEGER,
+    max_processing_minutes DOUBLE PRECISION,
+    updated_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Consumo dos vídeos enviados antes desta migração
+INSERT INTO usage_records (video_id, kind, version, user_id, recorded_at, videos)
+SELECT id, 'upload', 0, user_id, COALESCE(created_at, CURRENT_TIMESTAMP), 1 FROM processing_jobs
+ON CONFLICT DO NOTHING;
+
+INSERT INTO usage_records (video_id, kind, version, user_id, recorded_at, processing_seconds)
+SELECT v.job_id, 'frames', v.version, j.user_id, COALESCE(v.processed_at, j.completed_at, j.created_at, CURRENT_TIMESTAMP), j.duration_seconds
+FROM processing_job_versions v JOIN processing_jobs j ON j.id = v.job_id
+WHERE v.status = 'completed'
+ON CONFLICT DO NOTHING;
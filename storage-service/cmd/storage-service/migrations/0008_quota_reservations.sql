@@ -0,0 +1,15 @@
+-- Reservas de cota feitas na checagem do upload, antes dos eventos que
+-- registram o consumo em usage_records. Cada evento zera a sua parte (uploaded:
+-- vídeo e bytes; frames e transcode: segundos, concluídos ou não) e a linha
+-- vazia é removida; reservas de uploads abandonados deixam de contar ao vencer
+CREATE TABLE IF NOT EXISTS quota_reservations (
+    video_id VARCHAR(64) PRIMARY KEY,
+    user_id INTEGER NOT NULL,
+    videos INTEGER NOT NULL DEFAULT 0,
+    bytes BIGINT NOT NULL DEFAULT 0,
+    frames_seconds DOUBLE PRECISION NOT NULL DEFAULT 0,
+    transcode_seconds DOUBLE PRECISION NOT NULL DEFAULT 0,
+    expires_at TIMESTAMP WITH TIME ZONE NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_quota_reservations_user ON quota_reservations(user_id, expires_at);
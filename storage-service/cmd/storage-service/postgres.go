@@ -0,0 +1,921 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// VideoRepository no PostgreSQL: vídeos em processing_jobs, histórico em
+// processing_job_versions e lotes em processing_batches. Update/UpdateBatch
+// serializam as escritas de um mesmo vídeo ou lote entre réplicas com um
+// advisory lock da transação
+type sqlVideoRepository struct {
+	db *sql.DB
+}
+
+func newSQLVideoRepository(db *sql.DB) *sqlVideoRepository {
+	return &sqlVideoRepository{db: db}
+}
+
+// queryer é atendido por *sql.DB e *sql.Tx
+type queryer interface {
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+}
+
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+const videoColumns = `id, user_id, original_filename, status, progress, created_at,
+	frames_extracted, result_zip_size, result_zip_path, file_path, content_hash,
+	subtitle_languages, chapter_count, shot_count, shots_object, shots_csv_object,
+	renditions, hls_master_object, error_code, error_message, retryable, attempts,
+	last_event_seq, current_version, COALESCE(batch_id, ''), file_size, duration_seconds,
+	processed_at, original_expired_at, expired_at, expiry_warned_at, user_email, user_name`
+
+func scanVideo(row rowScanner) (*VideoData, error) {
+	var video VideoData
+	var processedAt, originalExpiredAt, expiredAt, expiryWarnedAt sql.NullTime
+	err := row.Scan(
+		&video.VideoID, &video.UserID, &video.Title, &video.Status, &video.Progress, &video.UploadedAt,
+		&video.FrameCount, &video.ZipSize, &video.ZipObjectName, &video.OriginalObject, &video.ContentHash,
+		pq.Array(&video.SubtitleLanguages), &video.ChapterCount, &video.ShotCount, &video.ShotsObject, &video.ShotsCSVObject,
+		pq.Array(&video.Renditions), &video.HLSMasterObject, &video.ErrorCode, &video.ErrorMessage, &video.Retryable, &video.Attempts,
+		&video.LastEventSeq, &video.CurrentVersion, &video.BatchID, &video.Size, &video.Duration,
+		&processedAt, &originalExpiredAt, &expiredAt, &expiryWarnedAt, &video.UserEmail, &video.UserName,
+	)
+	if err != nil {
+		return nil, err
+	}
+	video.ProcessedAt = nullTime(processedAt)
+	video.OriginalExpiredAt = nullTime(originalExpiredAt)
+	video.ExpiredAt = nullTime(expiredAt)
+	video.ExpiryWarnedAt = nullTime(expiryWarnedAt)
+	return &video, nil
+}
+
+func nullTime(t sql.NullTime) *time.Time {
+	if !t.Valid {
+		return nil
+	}
+	return &t.Time
+}
+
+func (r *sqlVideoRepository) Get(ctx context.Context, videoID string) (*VideoData, error) {
+	return getVideo(ctx, r.db, videoID)
+}
+
+func getVideo(ctx context.Context, q queryer, videoID string) (*VideoData, error) {
+	video, err := scanVideo(q.QueryRowContext(ctx, "SELECT "+videoColumns+" FROM processing_jobs WHERE id = $1", videoID))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, errVideoNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("erro ao buscar vídeo %s: %v", videoID, err)
+	}
+
+	video.Versions, err = loadVersions(ctx, q, videoID)
+	if err != nil {
+		return nil, err
+	}
+	return video, nil
+}
+
+func (r *sqlVideoRepository) Create(ctx context.Context, video *VideoData) error {
+	return r.withLock(ctx, "video:"+video.VideoID, func(tx *sql.Tx) error {
+		var exists bool
+		if err := tx.QueryRowContext(ctx, "SELECT EXISTS (SELECT 1 FROM processing_jobs WHERE id = $1)", video.VideoID).Scan(&exists); err != nil {
+			return fmt.Errorf("erro ao verificar vídeo %s: %v", video.VideoID, err)
+		}
+		if exists {
+			return errVideoExists
+		}
+		deleted, err := isDeleted(ctx, tx, video.VideoID)
+		if err != nil {
+			return err
+		}
+		if deleted {
+			return errVideoDeleted
+		}
+		return saveVideo(ctx, tx, video)
+	})
+}
+
+func (r *sqlVideoRepository) UpdateStatus(ctx context.Context, videoID, status string, progress int, sequence int64) (bool, error) {
+	result, err := r.db.ExecContext(ctx, `
+		UPDATE processing_jobs SET status = $2, progress = $3, last_event_seq = $4
+		WHERE id = $1 AND last_event_seq < $4`, videoID, status, progress, sequence)
+	if err != nil {
+		return false, fmt.Errorf("erro ao atualizar status do vídeo %s: %v", videoID, err)
+	}
+	if n, _ := result.RowsAffected(); n > 0 {
+		return true, nil
+	}
+
+	var exists bool
+	if err := r.db.QueryRowContext(ctx, "SELECT EXISTS (SELECT 1 FROM processing_jobs WHERE id = $1)", videoID).Scan(&exists); err != nil {
+		return false, fmt.Errorf("erro ao verificar vídeo %s: %v", videoID, err)
+	}
+	if !exists {
+		return false, errVideoNotFound
+	}
+	return false, nil
+}
+
+// Palavras do título para a busca full-text; a mesma expressão do índice
+// idx_jobs_title_fts, para que ele seja usado
+const titleSearchVector = `to_tsvector('simple', regexp_replace(original_filename, '[^[:alnum:]]+', ' ', 'g'))`
+
+// Colunas de cada VideoFilter.SortBy
+var sortColumns = map[string]string{
+	SortByUploadedAt: "created_at",
+	SortByStatus:     "status",
+	SortByDuration:   "duration_seconds",
+	SortBySize:       "file_size",
+}
+
+// Condições do filtro, com os argumentos numerados a partir de $1
+type videoQuery struct {
+	conditions []string
+	args       []interface{}
+}
+
+func (q *videoQuery) add(condition string, values ...interface{}) {
+	placeholders := make([]interface{}, len(values))
+	for i, value := range values {
+		q.args = append(q.args, value)
+		placeholders[i] = fmt.Sprintf("$%d", len(q.args))
+	}
+	q.conditions = append(q.conditions, fmt.Sprintf(condition, placeholders...))
+}
+
+func (q *videoQuery) where() string {
+	if len(q.conditions) == 0 {
+		return ""
+	}
+	return " WHERE " + strings.Join(q.conditions, " AND ")
+}
+
+func filterQuery(filter VideoFilter) *videoQuery {
+	q := &videoQuery{}
+	if filter.UserID != 0 {
+		q.add("user_id = %s", filter.UserID)
+	}
+	if filter.BatchID != "" {
+		q.add("batch_id = %s", filter.BatchID)
+	}
+	if filter.Status != "" {
+		q.add("status = %s", filter.Status)
+	}
+	if !filter.UploadedFrom.IsZero() {
+		q.add("created_at >= %s", filter.UploadedFrom)
+	}
+	if !filter.UploadedTo.IsZero() {
+		q.add("created_at < %s", filter.UploadedTo)
+	}
+	if filter.MinDuration > 0 {
+		q.add("duration_seconds >= %s", filter.MinDuration)
+	}
+	if filter.MaxDuration > 0 {
+		q.add("duration_seconds <= %s", filter.MaxDuration)
+	}
+	if filter.MinSize > 0 {
+		q.add("file_size >= %s", filter.MinSize)
+	}
+	if filter.MaxSize > 0 {
+		q.add("file_size <= %s", filter.MaxSize)
+	}
+	if !filter.ProcessedBefore.IsZero() {
+		q.add("processed_at < %s", filter.ProcessedBefore)
+	}
+	if filter.Retained {
+		// Mesma regra de VideoData.retainsArtifacts
+		q.add("(file_path <> '' OR status <> 'expired' OR cardinality(renditions) > 0 OR hls_master_object <> '')")
+	}
+	if filter.Search != "" {
+		if filter.FullText {
+			q.add(titleSearchVector+" @@ plainto_tsquery('simple', regexp_replace(%s, '[^[:alnum:]]+', ' ', 'g'))", filter.Search)
+		} else {
+			q.add(`original_filename ILIKE %s`, "%"+escapeLike(filter.Search)+"%")
+		}
+	}
+	return q
+}
+
+// Escapar os curingas do LIKE para buscar o texto literal
+func escapeLike(value string) string {
+	return strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(value)
+}
+
+func orderBy(filter VideoFilter) string {
+	column := sortColumns[filter.SortBy]
+	if column == "" {
+		column = "created_at"
+	}
+	if filter.Ascending {
+		return fmt.Sprintf(" ORDER BY %s, id", column)
+	}
+	return fmt.Sprintf(" ORDER BY %s DESC, id DESC", column)
+}
+
+func (r *sqlVideoRepository) List(ctx context.Context, filter VideoFilter) ([]*VideoData, error) {
+	q := filterQuery(filter)
+	return r.queryVideos(ctx, "SELECT "+videoColumns+" FROM processing_jobs"+q.where()+orderBy(filter), q.args...)
+}
+
+func (r *sqlVideoRepository) ListPage(ctx context.Context, filter VideoFilter, after *VideoCursor, limit int) (*VideoPage, error) {
+	q := filterQuery(filter)
+	page := &VideoPage{}
+	if err := r.db.QueryRowContext(ctx, "SELECT COUNT(*) FROM processing_jobs"+q.where(), q.args...).Scan(&page.Total); err != nil {
+		return nil, fmt.Errorf("erro ao contar vídeos: %v", err)
+	}
+
+	// Keyset: os vídeos depois do cursor na ordem (campo, id)
+	if after != nil {
+		column := sortColumns[filter.SortBy]
+		var value interface{}
+		switch filter.SortBy {
+		case SortByStatus:
+			value = after.Status
+		case SortByDuration:
+			value = after.Duration
+		case SortBySize:
+			value = after.Size
+		default:
+			column, value = "created_at", after.UploadedAt
+		}
+		operator := "<"
+		if filter.Ascending {
+			operator = ">"
+		}
+		q.add("("+column+", id) "+operator+" (%s, %s)", value, after.VideoID)
+	}
+
+	query := "SELECT " + videoColumns + " FROM processing_jobs" + q.where() + orderBy(filter)
+	if limit > 0 {
+		// Um a mais para saber se há próxima página
+		q.args = append(q.args, limit+1)
+		query += fmt.Sprintf(" LIMIT $%d", len(q.args))
+	}
+	videos, err := r.queryVideos(ctx, query, q.args...)
+	if err != nil {
+		return nil, err
+	}
+	if limit > 0 && len(videos) > limit {
+		videos = videos[:limit]
+		page.Next = cursorOf(videos[limit-1])
+	}
+	page.Videos = videos
+	return page, nil
+}
+
+func (r *sqlVideoRepository) queryVideos(ctx context.Context, query string, args ...interface{}) ([]*VideoData, error) {
+	rows, err := r.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("erro ao listar vídeos: %v", err)
+	}
+	defer rows.Close()
+
+	var videos []*VideoData
+	for rows.Next() {
+		video, err := scanVideo(rows)
+		if err != nil {
+			return nil, fmt.Errorf("erro ao ler vídeo: %v", err)
+		}
+		videos = append(videos, video)
+	}
+	return videos, rows.Err()
+}
+
+func (r *sqlVideoRepository) Stats(ctx context.Context, userID int) (*VideoStats, error) {
+	stats := &VideoStats{FailuresByCode: make(map[string]int)}
+	err := r.db.QueryRowContext(ctx, `
+		SELECT COUNT(*),
+			COUNT(*) FILTER (WHERE status = 'completed'),
+			COUNT(*) FILTER (WHERE status IN ('processing', 'queued')),
+			COUNT(*) FILTER (WHERE status IN ('failed', 'error')),
+			COALESCE(SUM(result_zip_size) FILTER (WHERE status = 'completed'), 0),
+			COALESCE(SUM(frames_extracted) FILTER (WHERE status = 'completed'), 0)
+		FROM processing_jobs WHERE user_id = $1`, userID,
+	).Scan(&stats.TotalVideos, &stats.Completed, &stats.Processing, &stats.Failed, &stats.TotalSize, &stats.TotalFrames)
+	if err != nil {
+		return nil, fmt.Errorf("erro ao calcular estatísticas: %v", err)
+	}
+
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT error_code, COUNT(*) FROM processing_jobs
+		WHERE user_id = $1 AND status IN ('failed', 'error') AND error_code <> ''
+		GROUP BY error_code`, userID)
+	if err != nil {
+		return nil, fmt.Errorf("erro ao agrupar falhas: %v", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var code string
+		var count int
+		if err := rows.Scan(&code, &count); err != nil {
+			return nil, err
+		}
+		stats.FailuresByCode[code] = count
+	}
+	return stats, rows.Err()
+}
+
+// Consumo registrado uma vez por (video_id, kind, version); a tabela não
+// referencia processing_jobs, então excluir o vídeo não devolve a cota
+func (r *sqlVideoRepository) RecordUsage(ctx context.Context, record *UsageRecord) error {
+	_, err := r.db.ExecContext(ctx, `
+		INSERT INTO usage_records (video_id, kind, version, user_id, recorded_at, videos, processing_seconds)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		ON CONFLICT (video_id, kind, version) DO NOTHING`,
+		record.VideoID, record.Kind, record.Version, record.UserID, record.RecordedAt, record.Videos, record.ProcessingSeconds)
+	if err != nil {
+		return fmt.Errorf("erro ao registrar consumo do vídeo %s: %v", record.VideoID, err)
+	}
+	return nil
+}
+
+func (r *sqlVideoRepository) Usage(ctx context.Context, userID int, since time.Time) (*UserUsage, error) {
+	return userUsage(ctx, r.db, userID, since, nil)
+}
+
+// Checagem e gravação das reservas na mesma transação, sob o lock do usuário:
+// checagens simultâneas do mesmo usuário enxergam as reservas umas das outras
+func (r *sqlVideoRepository) ReserveQuota(ctx context.Context, userID int, since time.Time, reservations []*QuotaReservation, allow func(usage *UserUsage) bool) (*UserUsage, error) {
+	var usage *UserUsage
+	err := r.withLock(ctx, fmt.Sprintf("quota:%d", userID), func(tx *sql.Tx) error {
+		if _, err := tx.ExecContext(ctx, `DELETE FROM quota_reservations WHERE user_id = $1 AND expires_at <= NOW()`, userID); err != nil {
+			return fmt.Errorf("erro ao remover reservas vencidas do usuário %d: %v", userID, err)
+		}
+		exclude := make([]string, 0, len(reservations))
+		for _, reservation := range reservations {
+			exclude = append(exclude, reservation.VideoID)
+		}
+		var err error
+		usage, err = userUsage(ctx, tx, userID, since, exclude)
+		if err != nil || !allow(usage) {
+			return err
+		}
+		for _, reservation := range reservations {
+			_, err := tx.ExecContext(ctx, `
+				INSERT INTO quota_reservations (video_id, user_id, videos, bytes, frames_seconds, transcode_seconds, expires_at)
+				VALUES ($1, $2, $3, $4, $5, $6, $7)
+				ON CONFLICT (video_id) DO UPDATE SET
+					user_id = EXCLUDED.user_id, videos = EXCLUDED.videos, bytes = EXCLUDED.bytes,
+					frames_seconds = EXCLUDED.frames_seconds, transcode_seconds = EXCLUDED.transcode_seconds,
+					expires_at = EXCLUDED.expires_at`,
+				reservation.VideoID, reservation.UserID, reservation.Videos, reservation.Bytes,
+				reservation.FramesSeconds, reservation.TranscodeSeconds, reservation.ExpiresAt)
+			if err != nil {
+				return fmt.Errorf("erro ao reservar cota do vídeo %s: %v", reservation.VideoID, err)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return usage, nil
+}
+
+func (r *sqlVideoRepository) UpdateReservation(ctx context.Context, videoID string, fn func(reservation *QuotaReservation) *QuotaReservation) error {
+	return r.withLock(ctx, "reservation:"+videoID, func(tx *sql.Tx) error {
+		reservation := &QuotaReservation{VideoID: videoID}
+		err := tx.QueryRowContext(ctx, `
+			SELECT user_id, videos, bytes, frames_seconds, transcode_seconds, expires_at
+			FROM quota_reservations WHERE video_id = $1 FOR UPDATE`, videoID,
+		).Scan(&reservation.UserID, &reservation.Videos, &reservation.Bytes,
+			&reservation.FramesSeconds, &reservation.TranscodeSeconds, &reservation.ExpiresAt)
+		if err == sql.ErrNoRows {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("erro ao buscar reserva do vídeo %s: %v", videoID, err)
+		}
+
+		updated := fn(reservation)
+		if updated == nil {
+			_, err = tx.ExecContext(ctx, `DELETE FROM quota_reservations WHERE video_id = $1`, videoID)
+		} else {
+			_, err = tx.ExecContext(ctx, `
+				UPDATE quota_reservations SET videos = $2, bytes = $3, frames_seconds = $4, transcode_seconds = $5, expires_at = $6
+				WHERE video_id = $1`,
+				videoID, updated.Videos, updated.Bytes, updated.FramesSeconds, updated.TranscodeSeconds, updated.ExpiresAt)
+		}
+		if err != nil {
+			return fmt.Errorf("erro ao atualizar reserva do vídeo %s: %v", videoID, err)
+		}
+		return nil
+	})
+}
+
+// Mesma conta de VideoData.storedBytes: original ainda presente e ZIPs das
+// versões concluídas e não podadas, ou o ZIP atual sem histórico de versões.
+// Soma as reservas vigentes, fora as dos vídeos em exclude
+func userUsage(ctx context.Context, q queryer, userID int, since time.Time, exclude []string) (*UserUsage, error) {
+	usage := &UserUsage{}
+	err := q.QueryRowContext(ctx, `
+		SELECT COALESCE(SUM(
+			CASE WHEN j.file_path <> '' THEN j.file_size ELSE 0 END +
+			CASE WHEN EXISTS (SELECT 1 FROM processing_job_versions v WHERE v.job_id = j.id)
+				THEN (SELECT COALESCE(SUM(v.zip_size), 0) FROM processing_job_versions v
+					WHERE v.job_id = j.id AND v.status = 'completed' AND NOT v.pruned AND v.zip_object_name <> '')
+				WHEN j.result_zip_path <> '' THEN j.result_zip_size
+				ELSE 0
+			END
+		), 0)::BIGINT
+		FROM processing_jobs j WHERE j.user_id = $1`, userID,
+	).Scan(&usage.StoredBytes)
+	if err != nil {
+		return nil, fmt.Errorf("erro ao calcular armazenamento do usuário %d: %v", userID, err)
+	}
+
+	err = q.QueryRowContext(ctx, `
+		SELECT COALESCE(SUM(videos), 0), COALESCE(SUM(processing_seconds), 0)
+		FROM usage_records WHERE user_id = $1 AND recorded_at >= $2`, userID, since,
+	).Scan(&usage.Videos, &usage.ProcessingSeconds)
+	if err != nil {
+		return nil, fmt.Errorf("erro ao calcular consumo do usuário %d: %v", userID, err)
+	}
+
+	reserved := &QuotaReservation{}
+	err = q.QueryRowContext(ctx, `
+		SELECT COALESCE(SUM(videos), 0), COALESCE(SUM(bytes), 0)::BIGINT,
+			COALESCE(SUM(frames_seconds), 0), COALESCE(SUM(transcode_seconds), 0)
+		FROM quota_reservations
+		WHERE user_id = $1 AND expires_at > NOW() AND NOT (video_id = ANY($2))`, userID, pq.Array(nonNil(exclude)),
+	).Scan(&reserved.Videos, &reserved.Bytes, &reserved.FramesSeconds, &reserved.TranscodeSeconds)
+	if err != nil {
+		return nil, fmt.Errorf("erro ao calcular reservas do usuário %d: %v", userID, err)
+	}
+	usage.addReservation(reserved)
+	return usage, nil
+}
+
+func (r *sqlVideoRepository) GetQuota(ctx context.Context, userID int) (*QuotaOverride, error) {
+	var storage sql.NullInt64
+	var videos sql.NullInt32
+	var minutes sql.NullFloat64
+	err := r.db.QueryRowContext(ctx, `
+		SELECT max_storage_bytes, max_videos_per_month, max_processing_minutes
+		FROM user_quotas WHERE user_id = $1`, userID,
+	).Scan(&storage, &videos, &minutes)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("erro ao ler cotas do usuário %d: %v", userID, err)
+	}
+
+	override := &QuotaOverride{}
+	if storage.Valid {
+		override.MaxStorageBytes = &storage.Int64
+	}
+	if videos.Valid {
+		value := int(videos.Int32)
+		override.MaxVideosPerMonth = &value
+	}
+	if minutes.Valid {
+		override.MaxProcessingMinutes = &minutes.Float64
+	}
+	return override, nil
+}
+
+func (r *sqlVideoRepository) SetQuota(ctx context.Context, userID int, override *QuotaOverride) error {
+	if override == nil {
+		if _, err := r.db.ExecContext(ctx, "DELETE FROM user_quotas WHERE user_id = $1", userID); err != nil {
+			return fmt.Errorf("erro ao remover cotas do usuário %d: %v", userID, err)
+		}
+		return nil
+	}
+
+	_, err := r.db.ExecContext(ctx, `
+		INSERT INTO user_quotas (user_id, max_storage_bytes, max_videos_per_month, max_processing_minutes, updated_at)
+		VALUES ($1, $2, $3, $4, now())
+		ON CONFLICT (user_id) DO UPDATE SET
+			max_storage_bytes = EXCLUDED.max_storage_bytes,
+			max_videos_per_month = EXCLUDED.max_videos_per_month,
+			max_processing_minutes = EXCLUDED.max_processing_minutes,
+			updated_at = EXCLUDED.updated_at`,
+		userID, override.MaxStorageBytes, override.MaxVideosPerMonth, override.MaxProcessingMinutes)
+	if err != nil {
+		return fmt.Errorf("erro ao gravar cotas do usuário %d: %v", userID, err)
+	}
+	return nil
+}
+
+func (r *sqlVideoRepository) Delete(ctx context.Context, videoID string) error {
+	result, err := r.db.ExecContext(ctx, "DELETE FROM processing_jobs WHERE id = $1", videoID)
+	if err != nil {
+		return fmt.Errorf("erro ao remover vídeo %s: %v", videoID, err)
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return errVideoNotFound
+	}
+	return nil
+}
+
+// Ler, alterar e gravar o vídeo na mesma transação. fn recebe nil quando o
+// vídeo ainda não existe e devolve o vídeo a gravar, ou nil para não gravar
+// nada; um erro de fn desfaz a transação e é repassado
+func (r *sqlVideoRepository) Update(ctx context.Context, videoID string, fn func(video *VideoData) (*VideoData, error)) error {
+	return r.withLock(ctx, "video:"+videoID, func(tx *sql.Tx) error {
+		video, err := getVideo(ctx, tx, videoID)
+		if errors.Is(err, errVideoNotFound) {
+			deleted, err := isDeleted(ctx, tx, videoID)
+			if err != nil {
+				return err
+			}
+			if deleted {
+				return errVideoDeleted
+			}
+		} else if err != nil {
+			return err
+		}
+
+		video, err = fn(video)
+		if err != nil || video == nil {
+			return err
+		}
+		return saveVideo(ctx, tx, video)
+	})
+}
+
+// Transação com advisory lock pela chave, liberado no commit ou rollback
+func (r *sqlVideoRepository) withLock(ctx context.Context, key string, fn func(tx *sql.Tx) error) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("erro ao iniciar transação: %v", err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, "SELECT pg_advisory_xact_lock(hashtext($1))", key); err != nil {
+		return fmt.Errorf("erro ao travar %s: %v", key, err)
+	}
+	if err := fn(tx); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func saveVideo(ctx context.Context, tx *sql.Tx, video *VideoData) error {
+	var batchID, completedAt interface{}
+	if video.BatchID != "" {
+		batchID = video.BatchID
+	}
+	if isTerminalStatus(video.Status) {
+		completedAt = time.Now()
+	}
+
+	_, err := tx.ExecContext(ctx, `
+		INSERT INTO processing_jobs (
+			id, user_id, original_filename, status, progress, created_at,
+			frames_extracted, result_zip_size, result_zip_path, file_path, content_hash,
+			subtitle_languages, chapter_count, shot_count, shots_object, shots_csv_object,
+			renditions, hls_master_object, error_code, error_message, retryable, attempts,
+			last_event_seq, current_version, batch_id, completed_at, file_size, duration_seconds,
+			processed_at, original_expired_at, expired_at, expiry_warned_at, user_email, user_name
+		) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16,
+			$17, $18, $19, $20, $21, $22, $23, $24, $25, $26, $27, $28, $29, $30, $31, $32, $33, $34)
+		ON CONFLICT (id) DO UPDATE SET
+			user_id = EXCLUDED.user_id,
+			original_filename = EXCLUDED.original_filename,
+			status = EXCLUDED.status,
+			progress = EXCLUDED.progress,
+			created_at = EXCLUDED.created_at,
+			frames_extracted = EXCLUDED.frames_extracted,
+			result_zip_size = EXCLUDED.result_zip_size,
+			result_zip_path = EXCLUDED.result_zip_path,
+			file_path = EXCLUDED.file_path,
+			content_hash = EXCLUDED.content_hash,
+			subtitle_languages = EXCLUDED.subtitle_languages,
+			chapter_count = EXCLUDED.chapter_count,
+			shot_count = EXCLUDED.shot_count,
+			shots_object = EXCLUDED.shots_object,
+			shots_csv_object = EXCLUDED.shots_csv_object,
+			renditions = EXCLUDED.renditions,
+			hls_master_object = EXCLUDED.hls_master_object,
+			error_code = EXCLUDED.error_code,
+			error_message = EXCLUDED.error_message,
+			retryable = EXCLUDED.retryable,
+			attempts = EXCLUDED.attempts,
+			last_event_seq = EXCLUDED.last_event_seq,
+			current_version = EXCLUDED.current_version,
+			batch_id = EXCLUDED.batch_id,
+			file_size = EXCLUDED.file_size,
+			duration_seconds = EXCLUDED.duration_seconds,
+			processed_at = EXCLUDED.processed_at,
+			original_expired_at = EXCLUDED.original_expired_at,
+			expired_at = EXCLUDED.expired_at,
+			expiry_warned_at = EXCLUDED.expiry_warned_at,
+			user_email = EXCLUDED.user_email,
+			user_name = EXCLUDED.user_name,
+			completed_at = CASE
+				WHEN processing_jobs.status = EXCLUDED.status THEN processing_jobs.completed_at
+				ELSE EXCLUDED.completed_at
+			END`,
+		video.VideoID, video.UserID, video.Title, video.Status, video.Progress, video.UploadedAt,
+		video.FrameCount, video.ZipSize, video.ZipObjectName, video.OriginalObject, video.ContentHash,
+		pq.Array(nonNil(video.SubtitleLanguages)), video.ChapterCount, video.ShotCount, video.ShotsObject, video.ShotsCSVObject,
+		pq.Array(nonNil(video.Renditions)), video.HLSMasterObject, video.ErrorCode, video.ErrorMessage, video.Retryable, video.Attempts,
+		video.LastEventSeq, video.CurrentVersion, batchID, completedAt, video.Size, video.Duration,
+		video.ProcessedAt, video.OriginalExpiredAt, video.ExpiredAt, video.ExpiryWarnedAt, video.UserEmail, video.UserName,
+	)
+	if err != nil {
+		return fmt.Errorf("erro ao gravar vídeo %s: %v", video.VideoID, err)
+	}
+	return saveVersions(ctx, tx, video.VideoID, video.Versions)
+}
+
+// Arrays nulos violariam o NOT NULL das colunas TEXT[]
+func nonNil(values []string) []string {
+	if values == nil {
+		return []string{}
+	}
+	return values
+}
+
+func loadVersions(ctx context.Context, q queryer, videoID string) ([]VideoVersion, error) {
+	rows, err := q.QueryContext(ctx, `
+		SELECT version, status, options, requested_at, processed_at, frame_count, zip_size,
+			shot_count, error_code, error_message, pruned, zip_object_name, shots_object, shots_csv_object
+		FROM processing_job_versions WHERE job_id = $1 ORDER BY version`, videoID)
+	if err != nil {
+		return nil, fmt.Errorf("erro ao buscar versões do vídeo %s: %v", videoID, err)
+	}
+	defer rows.Close()
+
+	var versions []VideoVersion
+	for rows.Next() {
+		var version VideoVersion
+		var options []byte
+		var processedAt sql.NullTime
+		err := rows.Scan(&version.Version, &version.Status, &options, &version.RequestedAt, &processedAt,
+			&version.FrameCount, &version.ZipSize, &version.ShotCount, &version.ErrorCode, &version.ErrorMessage,
+			&version.Pruned, &version.ZipObjectName, &version.ShotsObject, &version.ShotsCSVObject)
+		if err != nil {
+			return nil, fmt.Errorf("erro ao ler versão do vídeo %s: %v", videoID, err)
+		}
+		if len(options) > 0 {
+			version.Options = json.RawMessage(options)
+		}
+		if processedAt.Valid {
+			version.ProcessedAt = &processedAt.Time
+		}
+		versions = append(versions, version)
+	}
+	return versions, rows.Err()
+}
+
+// Regravar o histórico de versões do vídeo
+func saveVersions(ctx context.Context, tx *sql.Tx, videoID string, versions []VideoVersion) error {
+	if _, err := tx.ExecContext(ctx, "DELETE FROM processing_job_versions WHERE job_id = $1", videoID); err != nil {
+		return fmt.Errorf("erro ao regravar versões do vídeo %s: %v", videoID, err)
+	}
+
+	for _, version := range versions {
+		var options interface{}
+		if len(version.Options) > 0 {
+			options = []byte(version.Options)
+		}
+		var processedAt interface{}
+		if version.ProcessedAt != nil {
+			processedAt = *version.ProcessedAt
+		}
+
+		_, err := tx.ExecContext(ctx, `
+			INSERT INTO processing_job_versions (
+				job_id, version, status, options, requested_at, processed_at, frame_count, zip_size,
+				shot_count, error_code, error_message, pruned, zip_object_name, shots_object, shots_csv_object
+			) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15)`,
+			videoID, version.Version, version.Status, options, version.RequestedAt, processedAt, version.FrameCount, version.ZipSize,
+			version.ShotCount, version.ErrorCode, version.ErrorMessage, version.Pruned, version.ZipObjectName, version.ShotsObject, version.ShotsCSVObject,
+		)
+		if err != nil {
+			return fmt.Errorf("erro ao gravar versão %d do vídeo %s: %v", version.Version, videoID, err)
+		}
+	}
+	return nil
+}
+
+const batchColumns = `id, user_id, status, size, completed, failed, zip_size, zip_object_name,
+	error_code, last_event_seq, created_at, completed_at`
+
+func (r *sqlVideoRepository) GetBatch(ctx context.Context, batchID string) (*BatchData, error) {
+	return getBatch(ctx, r.db, batchID)
+}
+
+func getBatch(ctx context.Context, q queryer, batchID string) (*BatchData, error) {
+	var batch BatchData
+	var completedAt sql.NullTime
+	err := q.QueryRowContext(ctx, "SELECT "+batchColumns+" FROM processing_batches WHERE id = $1", batchID).Scan(
+		&batch.BatchID, &batch.UserID, &batch.Status, &batch.Size, &batch.Completed, &batch.Failed, &batch.ZipSize,
+		&batch.ZipObjectName, &batch.ErrorCode, &batch.LastEventSeq, &batch.CreatedAt, &completedAt,
+	)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, errBatchNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("erro ao buscar lote %s: %v", batchID, err)
+	}
+	if completedAt.Valid {
+		batch.CompletedAt = &completedAt.Time
+	}
+
+	rows, err := q.QueryContext(ctx, "SELECT id FROM processing_jobs WHERE batch_id = $1 ORDER BY created_at, id", batchID)
+	if err != nil {
+		return nil, fmt.Errorf("erro ao buscar vídeos do lote %s: %v", batchID, err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var videoID string
+		if err := rows.Scan(&videoID); err != nil {
+			return nil, err
+		}
+		batch.VideoIDs = append(batch.VideoIDs, videoID)
+	}
+	return &batch, rows.Err()
+}
+
+// Registrar o lote se ainda não existir
+func (r *sqlVideoRepository) CreateBatch(ctx context.Context, batch *BatchData) error {
+	_, err := r.db.ExecContext(ctx, `
+		INSERT INTO processing_batches (id, user_id, status, size, created_at)
+		VALUES ($1, $2, $3, $4, $5)
+		ON CONFLICT (id) DO NOTHING`,
+		batch.BatchID, batch.UserID, batch.Status, batch.Size, batch.CreatedAt)
+	if err != nil {
+		return fmt.Errorf("erro ao registrar lote %s: %v", batch.BatchID, err)
+	}
+	return nil
+}
+
+// Mesmo contrato de Update, para lotes já registrados: fn devolve o lote a
+// gravar ou nil para não alterar nada
+func (r *sqlVideoRepository) UpdateBatch(ctx context.Context, batchID string, fn func(batch *BatchData) (*BatchData, error)) error {
+	return r.withLock(ctx, "batch:"+batchID, func(tx *sql.Tx) error {
+		batch, err := getBatch(ctx, tx, batchID)
+		if err != nil {
+			return err
+		}
+
+		batch, err = fn(batch)
+		if err != nil || batch == nil {
+			return err
+		}
+
+		var completedAt interface{}
+		if batch.CompletedAt != nil {
+			completedAt = *batch.CompletedAt
+		}
+		_, err = tx.ExecContext(ctx, `
+			UPDATE processing_batches SET status = $2, size = $3, completed = $4, failed = $5, zip_size = $6,
+				zip_object_name = $7, error_code = $8, last_event_seq = $9, completed_at = $10
+			WHERE id = $1`,
+			batch.BatchID, batch.Status, batch.Size, batch.Completed, batch.Failed, batch.ZipSize,
+			batch.ZipObjectName, batch.ErrorCode, batch.LastEventSeq, completedAt)
+		if err != nil {
+			return fmt.Errorf("erro ao gravar lote %s: %v", batchID, err)
+		}
+		return nil
+	})
+}
+
+// O vídeo tem exclusão registrada (pendente ou concluída)
+func isDeleted(ctx context.Context, q queryer, videoID string) (bool, error) {
+	var deleted bool
+	err := q.QueryRowContext(ctx, "SELECT EXISTS (SELECT 1 FROM video_deletions WHERE video_id = $1)", videoID).Scan(&deleted)
+	if err != nil {
+		return false, fmt.Errorf("erro ao verificar exclusão do vídeo %s: %v", videoID, err)
+	}
+	return deleted, nil
+}
+
+// Remover o vídeo (versões saem em cascata) e registrar a exclusão pendente
+// na mesma transação
+func (r *sqlVideoRepository) ScheduleDeletion(ctx context.Context, deletion *VideoDeletion) error {
+	targets, err := json.Marshal(deletion.Targets)
+	if err != nil {
+		return fmt.Errorf("erro ao serializar objetos da exclusão: %v", err)
+	}
+
+	return r.withLock(ctx, "video:"+deletion.VideoID, func(tx *sql.Tx) error {
+		result, err := tx.ExecContext(ctx, "DELETE FROM processing_jobs WHERE id = $1", deletion.VideoID)
+		if err != nil {
+			return fmt.Errorf("erro ao remover vídeo %s: %v", deletion.VideoID, err)
+		}
+		if n, _ := result.RowsAffected(); n == 0 {
+			return errVideoNotFound
+		}
+
+		_, err = tx.ExecContext(ctx, `
+			INSERT INTO video_deletions (video_id, user_id, status, targets, requested_at, next_attempt_at)
+			VALUES ($1, $2, $3, $4, $5, $6)
+			ON CONFLICT (video_id) DO UPDATE SET
+				status = EXCLUDED.status,
+				targets = EXCLUDED.targets,
+				requested_at = EXCLUDED.requested_at,
+				next_attempt_at = EXCLUDED.next_attempt_at,
+				completed_at = NULL`,
+			deletion.VideoID, deletion.UserID, deletion.Status, targets, deletion.RequestedAt, deletion.NextAttemptAt)
+		if err != nil {
+			return fmt.Errorf("erro ao registrar exclusão do vídeo %s: %v", deletion.VideoID, err)
+		}
+		return nil
+	})
+}
+
+// SKIP LOCKED deixa cada réplica reservar uma exclusão diferente
+func (r *sqlVideoRepository) ClaimDeletion(ctx context.Context, lease time.Duration) (*VideoDeletion, error) {
+	var deletion VideoDeletion
+	var targets []byte
+	var completedAt sql.NullTime
+	err := r.db.QueryRowContext(ctx, `
+		UPDATE video_deletions SET attempts = attempts + 1, next_attempt_at = now() + make_interval(secs => $1)
+		WHERE video_id = (
+			SELECT video_id FROM video_deletions
+			WHERE status = 'pending' AND next_attempt_at <= now()
+			ORDER BY requested_at, video_id
+			LIMIT 1
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING video_id, user_id, status, targets, attempts, last_error, requested_at, next_attempt_at, completed_at`,
+		lease.Seconds(),
+	).Scan(&deletion.VideoID, &deletion.UserID, &deletion.Status, &targets, &deletion.Attempts, &deletion.LastError,
+		&deletion.RequestedAt, &deletion.NextAttemptAt, &completedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("erro ao reservar exclusão pendente: %v", err)
+	}
+	if err := json.Unmarshal(targets, &deletion.Targets); err != nil {
+		return nil, fmt.Errorf("objetos da exclusão do vídeo %s inválidos: %v", deletion.VideoID, err)
+	}
+	if completedAt.Valid {
+		deletion.CompletedAt = &completedAt.Time
+	}
+	return &deletion, nil
+}
+
+func (r *sqlVideoRepository) CompleteDeletion(ctx context.Context, videoID string) error {
+	return r.updateDeletion(ctx, videoID,
+		"UPDATE video_deletions SET status = 'completed', last_error = '', completed_at = now() WHERE video_id = $1")
+}
+
+func (r *sqlVideoRepository) FailDeletion(ctx context.Context, videoID, lastError string, retryAt time.Time) error {
+	return r.updateDeletion(ctx, videoID,
+		"UPDATE video_deletions SET last_error = $2, next_attempt_at = $3 WHERE video_id = $1", lastError, retryAt)
+}
+
+func (r *sqlVideoRepository) ReopenDeletion(ctx context.Context, videoID string) error {
+	return r.updateDeletion(ctx, videoID,
+		"UPDATE video_deletions SET status = 'pending', next_attempt_at = now(), completed_at = NULL WHERE video_id = $1")
+}
+
+func (r *sqlVideoRepository) updateDeletion(ctx context.Context, videoID, query string, args ...interface{}) error {
+	result, err := r.db.ExecContext(ctx, query, append([]interface{}{videoID}, args...)...)
+	if err != nil {
+		return fmt.Errorf("erro ao atualizar exclusão do vídeo %s: %v", videoID, err)
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return errVideoNotFound
+	}
+	return nil
+}
+
+// Abrir a conexão com o PostgreSQL e aplicar as migrações pendentes
+func openDatabase() (*sql.DB, error) {
+	dbInfo := fmt.Sprintf("host=%s port=%s user=%s password=%s dbname=%s sslmode=%s",
+		getEnv("DB_HOST", "postgres"),
+		getEnv("DB_PORT", "5432"),
+		getEnv("DB_USER", "postgres"),
+		getEnv("DB_PASSWORD", "postgres"),
+		getEnv("DB_NAME", "fiapx_storage"),
+		getEnv("DB_SSLMODE", "disable"))
+
+	db, err := sql.Open("postgres", dbInfo)
+	if err != nil {
+		return nil, fmt.Errorf("erro ao conectar ao banco de dados: %v", err)
+	}
+	db.SetMaxOpenConns(20)
+	db.SetConnMaxIdleTime(5 * time.Minute)
+
+	if err := db.Ping(); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("erro ao conectar ao banco de dados: %v", err)
+	}
+	if err := runMigrations(db); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return db, nil
+}
@@ -0,0 +1,595 @@
+package main
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// Headers dos tokens das rotas internas (outros serviços) e de administração
+const (
+	serviceTokenHeader = "X-Service-Token"
+	adminTokenHeader   = "X-Admin-Token"
+)
+
+// Tipos de registro de consumo
+const (
+	UsageUpload    = "upload"
+	UsageFrames    = "frames"
+	UsageTranscode = "transcode"
+)
+
+// Consumo de um vídeo: o upload conta um vídeo no mês e cada job de frames ou
+// transcodificação concluído soma a duração do original. O registro é único
+// por (VideoID, Kind, Version), então eventos repetidos não contam duas vezes
+// e o consumo permanece depois que o vídeo é excluído
+type UsageRecord struct {
+	UserID            int
+	VideoID           string
+	Kind              string
+	Version           int
+	RecordedAt        time.Time
+	Videos            int
+	ProcessingSeconds float64
+}
+
+// Cota reservada na verificação de um upload, até os eventos do vídeo
+// registrarem o consumo: o evento uploaded libera o vídeo e os bytes (que
+// passam a contar pelo registro de upload e pelo original) e cada job de
+// frames ou transcodificação encerrado libera os seus segundos. Reservas
+// vencidas deixam de contar (upload que falhou sem avisar)
+type QuotaReservation struct {
+	VideoID          string
+	UserID           int
+	Videos           int
+	Bytes            int64
+	FramesSeconds    float64
+	TranscodeSeconds float64
+	ExpiresAt        time.Time
+}
+
+func (r *QuotaReservation) empty() bool {
+	return r.Videos <= 0 && r.Bytes <= 0 && r.FramesSeconds <= 0 && r.TranscodeSeconds <= 0
+}
+
+// Somar a reserva ao consumo
+func (u *UserUsage) addReservation(r *QuotaReservation) {
+	u.StoredBytes += r.Bytes
+	u.Videos += r.Videos
+	u.ProcessingSeconds += r.FramesSeconds + r.TranscodeSeconds
+}
+
+// Prazo padrão das reservas: cobre a fila e os jobs de frames e transcodificação
+const defaultReservationTTL = 2 * time.Hour
+
+// Validade das reservas de QUOTA_RESERVATION_TTL (duração do Go, ex.: 90m)
+func reservationTTLFromEnv() time.Duration {
+	if value, err := time.ParseDuration(getEnv("QUOTA_RESERVATION_TTL", "")); err == nil && value > 0 {
+		return value
+	}
+	return defaultReservationTTL
+}
+
+// Consumo de um usuário: bytes guardados agora (originais e ZIPs ainda no
+// MinIO), vídeos e segundos de processamento do período e as reservas ainda
+// válidas dos uploads em andamento
+type UserUsage struct {
+	StoredBytes       int64
+	Videos            int
+	ProcessingSeconds float64
+}
+
+// Bytes que o vídeo ocupa no MinIO: o original enquanto não expira e os ZIPs
+// de frames das versões concluídas e não podadas (ou o ZIP atual dos vídeos
+// sem histórico de versões). Rendições não têm tamanho registrado
+func (v *VideoData) storedBytes() int64 {
+	var total int64
+	if v.OriginalObject != "" {
+		total += v.Size
+	}
+	if len(v.Versions) == 0 {
+		if v.ZipObjectName != "" {
+			total += v.ZipSize
+		}
+		return total
+	}
+	for _, version := range v.Versions {
+		if version.Status == "completed" && !version.Pruned && version.ZipObjectName != "" {
+			total += version.ZipSize
+		}
+	}
+	return total
+}
+
+// Limites por usuário; 0 é ilimitado. Vídeos e minutos de processamento são
+// por mês do calendário (UTC)
+type QuotaLimits struct {
+	MaxStorageBytes      int64   `json:"max_storage_bytes"`
+	MaxVideosPerMonth    int     `json:"max_videos_per_month"`
+	MaxProcessingMinutes float64 `json:"max_processing_minutes"`
+}
+
+// Exceção de um usuário aos limites padrão; campos nulos usam o padrão
+type QuotaOverride struct {
+	MaxStorageBytes      *int64   `json:"max_storage_bytes"`
+	MaxVideosPerMonth    *int     `json:"max_videos_per_month"`
+	MaxProcessingMinutes *float64 `json:"max_processing_minutes"`
+}
+
+func (l QuotaLimits) with(override *QuotaOverride) QuotaLimits {
+	if override == nil {
+		return l
+	}
+	if override.MaxStorageBytes != nil {
+		l.MaxStorageBytes = *override.MaxStorageBytes
+	}
+	if override.MaxVideosPerMonth != nil {
+		l.MaxVideosPerMonth = *override.MaxVideosPerMonth
+	}
+	if override.MaxProcessingMinutes != nil {
+		l.MaxProcessingMinutes = *override.MaxProcessingMinutes
+	}
+	return l
+}
+
+func (o *QuotaOverride) clone() *QuotaOverride {
+	if o == nil {
+		return nil
+	}
+	clone := *o
+	if o.MaxStorageBytes != nil {
+		value := *o.MaxStorageBytes
+		clone.MaxStorageBytes = &value
+	}
+	if o.MaxVideosPerMonth != nil {
+		value := *o.MaxVideosPerMonth
+		clone.MaxVideosPerMonth = &value
+	}
+	if o.MaxProcessingMinutes != nil {
+		value := *o.MaxProcessingMinutes
+		clone.MaxProcessingMinutes = &value
+	}
+	return &clone
+}
+
+func (o *QuotaOverride) validate() error {
+	if o.MaxStorageBytes != nil && *o.MaxStorageBytes < 0 ||
+		o.MaxVideosPerMonth != nil && *o.MaxVideosPerMonth < 0 ||
+		o.MaxProcessingMinutes != nil && *o.MaxProcessingMinutes < 0 {
+		return fmt.Errorf("limites não podem ser negativos (use 0 para ilimitado)")
+	}
+	return nil
+}
+
+// Limites padrão de QUOTA_STORAGE (bytes, aceita KB, MB, GB e TB),
+// QUOTA_VIDEOS_PER_MONTH e QUOTA_PROCESSING_MINUTES; vazios são ilimitados
+func quotaLimitsFromEnv() (QuotaLimits, error) {
+	var limits QuotaLimits
+	var err error
+	if limits.MaxStorageBytes, err = parseBytes(getEnv("QUOTA_STORAGE", "0")); err != nil {
+		return limits, fmt.Errorf("QUOTA_STORAGE inválido: %v", err)
+	}
+	if limits.MaxVideosPerMonth, err = strconv.Atoi(getEnv("QUOTA_VIDEOS_PER_MONTH", "0")); err != nil || limits.MaxVideosPerMonth < 0 {
+		return limits, fmt.Errorf("QUOTA_VIDEOS_PER_MONTH inválido: %q", getEnv("QUOTA_VIDEOS_PER_MONTH", "0"))
+	}
+	if limits.MaxProcessingMinutes, err = strconv.ParseFloat(getEnv("QUOTA_PROCESSING_MINUTES", "0"), 64); err != nil || limits.MaxProcessingMinutes < 0 {
+		return limits, fmt.Errorf("QUOTA_PROCESSING_MINUTES inválido: %q", getEnv("QUOTA_PROCESSING_MINUTES", "0"))
+	}
+	return limits, nil
+}
+
+var byteUnits = []struct {
+	suffix string
+	size   int64
+}{
+	{"TB", 1 << 40},
+	{"GB", 1 << 30},
+	{"MB", 1 << 20},
+	{"KB", 1 << 10},
+	{"B", 1},
+}
+
+func parseBytes(value string) (int64, error) {
+	value = strings.ToUpper(strings.TrimSpace(value))
+	unit := int64(1)
+	for _, candidate := range byteUnits {
+		if number, found := strings.CutSuffix(value, candidate.suffix); found {
+			value, unit = strings.TrimSpace(number), candidate.size
+			break
+		}
+	}
+	n, err := strconv.ParseFloat(value, 64)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("tamanho inválido %q", value)
+	}
+	return int64(n * float64(unit)), nil
+}
+
+// Início do mês (UTC) em que now está e do mês seguinte
+func usagePeriod(now time.Time) (time.Time, time.Time) {
+	now = now.UTC()
+	start := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC)
+	return start, start.AddDate(0, 1, 0)
+}
+
+// Consumo que um upload vai somar. Com Reserve, os totais vêm dos vídeos
+// listados e a cota de cada um fica reservada se o upload couber
+type QuotaRequest struct {
+	Videos            int             `json:"videos"`
+	Bytes             int64           `json:"bytes"`
+	ProcessingSeconds float64         `json:"processing_seconds"`
+	Reserve           []ReservedVideo `json:"reserve,omitempty"`
+}
+
+// Vídeo de um upload com a cota a reservar
+type ReservedVideo struct {
+	VideoID          string  `json:"video_id"`
+	Bytes            int64   `json:"bytes"`
+	FramesSeconds    float64 `json:"frames_seconds"`
+	TranscodeSeconds float64 `json:"transcode_seconds"`
+}
+
+// Reservas do pedido, que passa a usar os totais dos vídeos listados
+func (q *QuotaRequest) reservations(userID int, expiresAt time.Time) ([]*QuotaReservation, error) {
+	if len(q.Reserve) == 0 {
+		return nil, nil
+	}
+	*q = QuotaRequest{Videos: len(q.Reserve), Reserve: q.Reserve}
+	reservations := make([]*QuotaReservation, 0, len(q.Reserve))
+	for _, video := range q.Reserve {
+		if video.VideoID == "" || video.Bytes < 0 || video.FramesSeconds < 0 || video.TranscodeSeconds < 0 {
+			return nil, fmt.Errorf("reserva inválida para o vídeo %q", video.VideoID)
+		}
+		q.Bytes += video.Bytes
+		q.ProcessingSeconds += video.FramesSeconds + video.TranscodeSeconds
+		reservations = append(reservations, &QuotaReservation{
+			VideoID:          video.VideoID,
+			UserID:           userID,
+			Videos:           1,
+			Bytes:            video.Bytes,
+			FramesSeconds:    video.FramesSeconds,
+			TranscodeSeconds: video.TranscodeSeconds,
+			ExpiresAt:        expiresAt,
+		})
+	}
+	return reservations, nil
+}
+
+// Limite que o pedido ultrapassaria
+type QuotaViolation struct {
+	Quota     string  `json:"quota"` // storage_bytes, videos_per_month, processing_minutes
+	Message   string  `json:"message"`
+	Limit     float64 `json:"limit"`
+	Used      float64 `json:"used"`
+	Requested float64 `json:"requested"`
+	// Quando o consumo do mês recomeça (cotas mensais)
+	ResetsAt *time.Time `json:"resets_at,omitempty"`
+}
+
+// Primeiro limite que o pedido ultrapassaria; nil se cabe em todos
+func (l QuotaLimits) check(usage UserUsage, request QuotaRequest, resetsAt time.Time) *QuotaViolation {
+	if l.MaxStorageBytes > 0 && request.Bytes > 0 && usage.StoredBytes+request.Bytes > l.MaxStorageBytes {
+		return &QuotaViolation{
+			Quota:     "storage_bytes",
+			Message:   fmt.Sprintf("Cota de armazenamento excedida: %s em uso de %s", formatBytes(usage.StoredBytes), formatBytes(l.MaxStorageBytes)),
+			Limit:     float64(l.MaxStorageBytes),
+			Used:      float64(usage.StoredBytes),
+			Requested: float64(request.Bytes),
+		}
+	}
+	if l.MaxVideosPerMonth > 0 && request.Videos > 0 && usage.Videos+request.Videos > l.MaxVideosPerMonth {
+		return &QuotaViolation{
+			Quota:     "videos_per_month",
+			Message:   fmt.Sprintf("Cota mensal de vídeos excedida: %d de %d enviados neste mês", usage.Videos, l.MaxVideosPerMonth),
+			Limit:     float64(l.MaxVideosPerMonth),
+			Used:      float64(usage.Videos),
+			Requested: float64(request.Videos),
+			ResetsAt:  &resetsAt,
+		}
+	}
+	used, requested := usage.ProcessingSeconds/60, request.ProcessingSeconds/60
+	if l.MaxProcessingMinutes > 0 && requested > 0 && used+requested > l.MaxProcessingMinutes {
+		return &QuotaViolation{
+			Quota:     "processing_minutes",
+			Message:   fmt.Sprintf("Cota mensal de processamento excedida: %.1f de %.0f minutos usados neste mês", used, l.MaxProcessingMinutes),
+			Limit:     l.MaxProcessingMinutes,
+			Used:      used,
+			Requested: requested,
+			ResetsAt:  &resetsAt,
+		}
+	}
+	return nil
+}
+
+func formatBytes(n int64) string {
+	for _, unit := range byteUnits {
+		if n >= unit.size && unit.size > 1 {
+			return fmt.Sprintf("%.1f %s", float64(n)/float64(unit.size), unit.suffix)
+		}
+	}
+	return fmt.Sprintf("%d B", n)
+}
+
+// Cotas de um usuário com o consumo do mês corrente
+type quotaStatus struct {
+	Limits   QuotaLimits
+	Override *QuotaOverride
+	Usage    *UserUsage
+	Start    time.Time
+	ResetsAt time.Time
+}
+
+func (ss *StorageService) quotaStatus(r *http.Request, userID int) (*quotaStatus, error) {
+	override, err := ss.Videos.GetQuota(r.Context(), userID)
+	if err != nil {
+		return nil, err
+	}
+	start, resetsAt := usagePeriod(time.Now())
+	usage, err := ss.Videos.Usage(r.Context(), userID, start)
+	if err != nil {
+		return nil, err
+	}
+	return &quotaStatus{
+		Limits:   ss.Quotas.with(override),
+		Override: override,
+		Usage:    usage,
+		Start:    start,
+		ResetsAt: resetsAt,
+	}, nil
+}
+
+// Limites e consumo no formato das respostas JSON
+func (s *quotaStatus) response() map[string]interface{} {
+	return map[string]interface{}{
+		"quota": s.Limits,
+		"usage": map[string]interface{}{
+			"storage_bytes":      s.Usage.StoredBytes,
+			"videos_this_month":  s.Usage.Videos,
+			"processing_minutes": s.Usage.ProcessingSeconds / 60,
+		},
+		"period_start": s.Start.Format(time.RFC3339),
+		"resets_at":    s.ResetsAt.Format(time.RFC3339),
+	}
+}
+
+// Autenticar chamadas pelo token em header, comparado ao da variável env.
+// Sem token configurado as rotas ficam desabilitadas
+func requireToken(header, env string) mux.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			expected := getEnv(env, "")
+			if expected == "" {
+				http.Error(w, "Rotas desabilitadas: "+env+" não configurado", http.StatusServiceUnavailable)
+				return
+			}
+			if subtle.ConstantTimeCompare([]byte(r.Header.Get(header)), []byte(expected)) != 1 {
+				http.Error(w, "Token inválido", http.StatusUnauthorized)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+func quotaUserID(w http.ResponseWriter, r *http.Request) (int, bool) {
+	userID, err := strconv.Atoi(mux.Vars(r)["user_id"])
+	if err != nil || userID <= 0 {
+		http.Error(w, "ID de usuário inválido", http.StatusBadRequest)
+		return 0, false
+	}
+	return userID, true
+}
+
+// Verificar se um upload cabe nas cotas do usuário (chamado pelo
+// upload-service antes de gravar o original). A verificação e a reserva dos
+// vídeos do pedido são atômicas por usuário, então uploads simultâneos não
+// passam todos pelo mesmo espaço livre
+func (ss *StorageService) CheckQuotaHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := quotaUserID(w, r)
+	if !ok {
+		return
+	}
+	var request QuotaRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		http.Error(w, fmt.Sprintf("JSON inválido: %v", err), http.StatusBadRequest)
+		return
+	}
+	ttl := ss.ReservationTTL
+	if ttl <= 0 {
+		ttl = defaultReservationTTL
+	}
+	reservations, err := request.reservations(userID, time.Now().Add(ttl))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	override, err := ss.Videos.GetQuota(r.Context(), userID)
+	if err != nil {
+		log.Printf("Erro ao consultar cotas do usuário %d: %v", userID, err)
+		http.Error(w, "Erro interno do servidor", http.StatusInternalServerError)
+		return
+	}
+	status := &quotaStatus{Limits: ss.Quotas.with(override), Override: override}
+	status.Start, status.ResetsAt = usagePeriod(time.Now())
+	var violation *QuotaViolation
+	status.Usage, err = ss.Videos.ReserveQuota(r.Context(), userID, status.Start, reservations, func(usage *UserUsage) bool {
+		violation = status.Limits.check(*usage, request, status.ResetsAt)
+		return violation == nil
+	})
+	if err != nil {
+		log.Printf("Erro ao reservar cotas do usuário %d: %v", userID, err)
+		http.Error(w, "Erro interno do servidor", http.StatusInternalServerError)
+		return
+	}
+	if violation != nil {
+		log.Printf("Upload do usuário %d recusado: %s", userID, violation.Message)
+	}
+
+	response := status.response()
+	response["allowed"] = violation == nil
+	response["exceeded"] = violation
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// Liberar a reserva de um vídeo cujo upload falhou antes de publicar o
+// evento uploaded
+func (ss *StorageService) ReleaseReservationHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := quotaUserID(w, r)
+	if !ok {
+		return
+	}
+	videoID := mux.Vars(r)["video_id"]
+	err := ss.Videos.UpdateReservation(r.Context(), videoID, func(reservation *QuotaReservation) *QuotaReservation {
+		if reservation.UserID != userID {
+			return reservation
+		}
+		return nil
+	})
+	if err != nil {
+		log.Printf("Erro ao liberar a reserva do vídeo %s: %v", videoID, err)
+		http.Error(w, "Erro interno do servidor", http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// Cotas, exceção e consumo de um usuário
+func (ss *StorageService) GetQuotaHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := quotaUserID(w, r)
+	if !ok {
+		return
+	}
+	ss.writeQuota(w, r, userID)
+}
+
+// Trocar a exceção do usuário; campos nulos ou ausentes voltam ao padrão
+func (ss *StorageService) PutQuotaHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := quotaUserID(w, r)
+	if !ok {
+		return
+	}
+	var override QuotaOverride
+	if err := json.NewDecoder(r.Body).Decode(&override); err != nil {
+		http.Error(w, fmt.Sprintf("JSON inválido: %v", err), http.StatusBadRequest)
+		return
+	}
+	if err := override.validate(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	stored := &override
+	if override == (QuotaOverride{}) {
+		stored = nil
+	}
+	if err := ss.Videos.SetQuota(r.Context(), userID, stored); err != nil {
+		log.Printf("Erro ao gravar cotas do usuário %d: %v", userID, err)
+		http.Error(w, "Erro interno do servidor", http.StatusInternalServerError)
+		return
+	}
+	log.Printf("Cotas do usuário %d alteradas: %s", userID, ss.Quotas.with(stored).describe())
+	ss.writeQuota(w, r, userID)
+}
+
+// Remover a exceção: o usuário volta aos limites padrão
+func (ss *StorageService) DeleteQuotaHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := quotaUserID(w, r)
+	if !ok {
+		return
+	}
+	if err := ss.Videos.SetQuota(r.Context(), userID, nil); err != nil {
+		log.Printf("Erro ao remover cotas do usuário %d: %v", userID, err)
+		http.Error(w, "Erro interno do servidor", http.StatusInternalServerError)
+		return
+	}
+	log.Printf("Cotas do usuário %d voltaram ao padrão", userID)
+	ss.writeQuota(w, r, userID)
+}
+
+func (ss *StorageService) writeQuota(w http.ResponseWriter, r *http.Request, userID int) {
+	status, err := ss.quotaStatus(r, userID)
+	if err != nil {
+		log.Printf("Erro ao consultar cotas do usuário %d: %v", userID, err)
+		http.Error(w, "Erro interno do servidor", http.StatusInternalServerError)
+		return
+	}
+	response := status.response()
+	response["user_id"] = userID
+	response["default_quota"] = ss.Quotas
+	response["override"] = status.Override
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+func (l QuotaLimits) describe() string {
+	return fmt.Sprintf("armazenamento %d bytes, %d vídeos/mês, %.0f minutos/mês", l.MaxStorageBytes, l.MaxVideosPerMonth, l.MaxProcessingMinutes)
+}
+
+// Registrar o consumo de um evento: upload de vídeo novo ou job de frames ou
+// transcodificação concluído; depois libera a parte da reserva que o evento
+// encerra. Pode ser chamado para eventos repetidos
+func (ss *StorageService) recordEventUsage(event JobEvent, video *VideoData) error {
+	record := &UsageRecord{VideoID: event.VideoID, RecordedAt: event.Timestamp}
+	switch {
+	case event.Event == "uploaded" && event.JobType == "frames":
+		record.Kind, record.Videos = UsageUpload, 1
+	case (event.Event == "failed" || event.Event == "cancelled") && (event.JobType == "frames" || event.JobType == "transcode"):
+		// Job encerrado sem consumo: só a reserva é liberada
+		return ss.releaseReservation(event)
+	case event.Event == "completed" && (event.JobType == "frames" || event.JobType == "transcode"):
+		record.Kind = UsageFrames
+		if event.JobType == "transcode" {
+			record.Kind = UsageTranscode
+		}
+		if event.Result != nil {
+			record.Version = max(event.Result.Version, 1)
+		}
+		// Reprocessamentos não trazem a duração no evento
+		record.ProcessingSeconds = event.Duration
+		if record.ProcessingSeconds == 0 && video != nil {
+			record.ProcessingSeconds = video.Duration
+		}
+	default:
+		return nil
+	}
+
+	record.UserID, _ = strconv.Atoi(event.UserID)
+	if record.UserID == 0 && video != nil {
+		record.UserID = video.UserID
+	}
+	if record.RecordedAt.IsZero() {
+		record.RecordedAt = time.Now()
+	}
+	if err := ss.Videos.RecordUsage(ctx, record); err != nil {
+		return err
+	}
+	return ss.releaseReservation(event)
+}
+
+// Zerar a parte da reserva do vídeo que o evento encerra; zerar de novo num
+// evento repetido não muda nada
+func (ss *StorageService) releaseReservation(event JobEvent) error {
+	return ss.Videos.UpdateReservation(ctx, event.VideoID, func(reservation *QuotaReservation) *QuotaReservation {
+		switch {
+		case event.Event == "uploaded":
+			reservation.Videos, reservation.Bytes = 0, 0
+		case event.JobType == "transcode":
+			reservation.TranscodeSeconds = 0
+		default:
+			reservation.FramesSeconds = 0
+		}
+		if reservation.empty() {
+			return nil
+		}
+		return reservation
+	})
+}
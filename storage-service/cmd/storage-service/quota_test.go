@@ -0,0 +1,288 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseBytes(t *testing.T) {
+	cases := map[string]int64{
+		"0":      0,
+		"1024":   1024,
+		"10GB":   10 << 30,
+		"1.5 gb": 3 << 29,
+		"500MB":  500 << 20,
+		"2TB":    2 << 40,
+		"64KB":   64 << 10,
+		"12B":    12,
+	}
+	for value, want := range cases {
+		got, err := parseBytes(value)
+		require.NoError(t, err, value)
+		assert.Equal(t, want, got, value)
+	}
+	for _, value := range []string{"", "-1GB", "dez GB", "10PB"} {
+		_, err := parseBytes(value)
+		assert.Error(t, err, value)
+	}
+}
+
+func TestQuotaLimitsFromEnv(t *testing.T) {
+	t.Setenv("QUOTA_STORAGE", "10GB")
+	t.Setenv("QUOTA_VIDEOS_PER_MONTH", "50")
+	t.Setenv("QUOTA_PROCESSING_MINUTES", "")
+	limits, err := quotaLimitsFromEnv()
+	require.NoError(t, err)
+	assert.Equal(t, QuotaLimits{MaxStorageBytes: 10 << 30, MaxVideosPerMonth: 50}, limits)
+
+	minutes := 30.0
+	videos := 0
+	assert.Equal(t, QuotaLimits{MaxStorageBytes: 10 << 30, MaxProcessingMinutes: 30},
+		limits.with(&QuotaOverride{MaxVideosPerMonth: &videos, MaxProcessingMinutes: &minutes}))
+	assert.Equal(t, limits, limits.with(nil))
+
+	for env, value := range map[string]string{"QUOTA_STORAGE": "muito", "QUOTA_VIDEOS_PER_MONTH": "-1", "QUOTA_PROCESSING_MINUTES": "x"} {
+		t.Run(env, func(t *testing.T) {
+			t.Setenv(env, value)
+			_, err := quotaLimitsFromEnv()
+			assert.Error(t, err)
+		})
+	}
+}
+
+func TestUsagePeriod(t *testing.T) {
+	start, resetsAt := usagePeriod(time.Date(2024, 12, 31, 23, 30, 0, 0, time.FixedZone("BRT", -3*3600)))
+	assert.Equal(t, time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC), start, "já é janeiro em UTC")
+	assert.Equal(t, time.Date(2025, 2, 1, 0, 0, 0, 0, time.UTC), resetsAt)
+}
+
+func TestQuotaCheck(t *testing.T) {
+	limits := QuotaLimits{MaxStorageBytes: 1000, MaxVideosPerMonth: 3, MaxProcessingMinutes: 10}
+	usage := UserUsage{StoredBytes: 900, Videos: 2, ProcessingSeconds: 300}
+	resetsAt := baseTime
+
+	assert.Nil(t, limits.check(usage, QuotaRequest{Videos: 1, Bytes: 100, ProcessingSeconds: 300}, resetsAt), "exatamente no limite")
+
+	violation := limits.check(usage, QuotaRequest{Videos: 1, Bytes: 101}, resetsAt)
+	require.NotNil(t, violation)
+	assert.Equal(t, "storage_bytes", violation.Quota)
+	assert.Equal(t, 1000.0, violation.Limit)
+	assert.Equal(t, 900.0, violation.Used)
+	assert.Nil(t, violation.ResetsAt, "armazenamento não recomeça no mês seguinte")
+
+	violation = limits.check(usage, QuotaRequest{Videos: 2}, resetsAt)
+	require.NotNil(t, violation)
+	assert.Equal(t, "videos_per_month", violation.Quota)
+	assert.Equal(t, &resetsAt, violation.ResetsAt)
+
+	violation = limits.check(usage, QuotaRequest{Videos: 1, ProcessingSeconds: 301}, resetsAt)
+	require.NotNil(t, violation)
+	assert.Equal(t, "processing_minutes", violation.Quota)
+	assert.Equal(t, 5.0, violation.Used)
+	assert.Contains(t, violation.Message, "processamento")
+
+	// Já acima do limite (cota reduzida pelo admin), mas o pedido não soma nada
+	assert.Nil(t, limits.check(UserUsage{StoredBytes: 5000}, QuotaRequest{}, resetsAt))
+	assert.Nil(t, QuotaLimits{}.check(UserUsage{StoredBytes: 1 << 50, Videos: 1000}, QuotaRequest{Videos: 1, Bytes: 1 << 40}, resetsAt), "0 é ilimitado")
+}
+
+func TestRecordEventUsage(t *testing.T) {
+	ss := &StorageService{Videos: newMemoryVideoRepository()}
+	video := newTestVideo("video_1", 7, time.Now())
+	video.Duration = 120
+	require.NoError(t, ss.Videos.Create(context.Background(), video))
+
+	now := time.Now()
+	events := []JobEvent{
+		{Event: "uploaded", VideoID: "video_1", JobType: "frames", UserID: "7", Timestamp: now},
+		{Event: "uploaded", VideoID: "video_1", JobType: "frames", UserID: "7", Timestamp: now},
+		{Event: "progress", VideoID: "video_1", JobType: "frames", UserID: "7", Timestamp: now},
+		// Reprocessamento sem duração no evento usa a do vídeo
+		{Event: "completed", VideoID: "video_1", JobType: "frames", UserID: "7", Timestamp: now, Result: &ProcessingResult{Version: 2}},
+		{Event: "completed", VideoID: "video_1", JobType: "transcode", UserID: "7", Timestamp: now, Duration: 60, Result: &ProcessingResult{}},
+		{Event: "failed", VideoID: "video_1", JobType: "frames", UserID: "7", Timestamp: now, Result: &ProcessingResult{Version: 3}},
+	}
+	for _, event := range events {
+		require.NoError(t, ss.recordEventUsage(event, video))
+	}
+
+	usage, err := ss.Videos.Usage(context.Background(), 7, now.Add(-time.Minute))
+	require.NoError(t, err)
+	assert.Equal(t, 1, usage.Videos)
+	assert.Equal(t, 180.0, usage.ProcessingSeconds)
+}
+
+func TestRecordEventReleasesReservation(t *testing.T) {
+	ss := &StorageService{Videos: newMemoryVideoRepository()}
+	since := time.Now().Add(-time.Minute)
+	_, err := ss.Videos.ReserveQuota(context.Background(), 7, since, []*QuotaReservation{
+		{VideoID: "video_1", UserID: 7, Videos: 1, Bytes: 100, FramesSeconds: 60, TranscodeSeconds: 60, ExpiresAt: time.Now().Add(time.Hour)},
+	}, func(usage *UserUsage) bool { return true })
+	require.NoError(t, err)
+	usage := func() *UserUsage {
+		usage, err := ss.Videos.Usage(context.Background(), 7, since)
+		require.NoError(t, err)
+		return usage
+	}
+
+	// O evento uploaded troca a reserva do vídeo pelo registro de consumo
+	uploaded := JobEvent{Event: "uploaded", VideoID: "video_1", JobType: "frames", UserID: "7", Timestamp: time.Now()}
+	require.NoError(t, ss.recordEventUsage(uploaded, nil))
+	require.NoError(t, ss.recordEventUsage(uploaded, nil))
+	assert.Equal(t, &UserUsage{Videos: 1, ProcessingSeconds: 120}, usage())
+
+	// Transcodificação que falhou só libera os segundos reservados
+	require.NoError(t, ss.handleVideoEvent(JobEvent{Event: "failed", VideoID: "video_1", JobType: "transcode", UserID: "7", Timestamp: time.Now()}))
+	assert.Equal(t, &UserUsage{Videos: 1, ProcessingSeconds: 60}, usage())
+
+	require.NoError(t, ss.recordEventUsage(JobEvent{Event: "completed", VideoID: "video_1", JobType: "frames", UserID: "7", Timestamp: time.Now(), Duration: 60, Result: &ProcessingResult{}}, nil))
+	assert.Equal(t, &UserUsage{Videos: 1, ProcessingSeconds: 60}, usage())
+	reservation := false
+	require.NoError(t, ss.Videos.UpdateReservation(context.Background(), "video_1", func(r *QuotaReservation) *QuotaReservation {
+		reservation = true
+		return r
+	}))
+	assert.False(t, reservation, "reserva vazia é removida")
+}
+
+func newQuotaRouter(ss *StorageService) *mux.Router {
+	r := mux.NewRouter()
+	internal := r.PathPrefix("/internal").Subrouter()
+	internal.Use(requireToken(serviceTokenHeader, "INTERNAL_SERVICE_TOKEN"))
+	internal.HandleFunc("/quotas/{user_id}/check", ss.CheckQuotaHandler).Methods("POST")
+	internal.HandleFunc("/quotas/{user_id}/reservations/{video_id}", ss.ReleaseReservationHandler).Methods("DELETE")
+	admin := r.PathPrefix("/admin").Subrouter()
+	admin.Use(requireToken(adminTokenHeader, "ADMIN_API_TOKEN"))
+	admin.HandleFunc("/quotas/{user_id}", ss.GetQuotaHandler).Methods("GET")
+	admin.HandleFunc("/quotas/{user_id}", ss.PutQuotaHandler).Methods("PUT")
+	admin.HandleFunc("/quotas/{user_id}", ss.DeleteQuotaHandler).Methods("DELETE")
+	return r
+}
+
+func serveQuota(r http.Handler, method, path, header, token, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	if token != "" {
+		req.Header.Set(header, token)
+	}
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestQuotaHandlers(t *testing.T) {
+	ss := &StorageService{
+		Videos: newMemoryVideoRepository(),
+		Quotas: QuotaLimits{MaxStorageBytes: 1000, MaxVideosPerMonth: 1},
+	}
+	router := newQuotaRouter(ss)
+
+	t.Run("rotas desabilitadas sem token configurado", func(t *testing.T) {
+		t.Setenv("INTERNAL_SERVICE_TOKEN", "")
+		rec := serveQuota(router, "POST", "/internal/quotas/7/check", serviceTokenHeader, "qualquer", `{}`)
+		assert.Equal(t, http.StatusServiceUnavailable, rec.Code)
+	})
+
+	t.Setenv("INTERNAL_SERVICE_TOKEN", "servico")
+	t.Setenv("ADMIN_API_TOKEN", "admin")
+
+	t.Run("token errado", func(t *testing.T) {
+		assert.Equal(t, http.StatusUnauthorized, serveQuota(router, "POST", "/internal/quotas/7/check", serviceTokenHeader, "admin", `{}`).Code)
+		assert.Equal(t, http.StatusUnauthorized, serveQuota(router, "GET", "/admin/quotas/7", adminTokenHeader, "servico", "").Code)
+		assert.Equal(t, http.StatusUnauthorized, serveQuota(router, "GET", "/admin/quotas/7", adminTokenHeader, "", "").Code)
+	})
+
+	t.Run("check recusa o que passa do limite", func(t *testing.T) {
+		require.NoError(t, ss.Videos.RecordUsage(context.Background(), &UsageRecord{
+			UserID: 7, VideoID: "video_1", Kind: UsageUpload, RecordedAt: time.Now(), Videos: 1,
+		}))
+
+		rec := serveQuota(router, "POST", "/internal/quotas/7/check", serviceTokenHeader, "servico", `{"videos": 1, "bytes": 10}`)
+		require.Equal(t, http.StatusOK, rec.Code)
+		var response struct {
+			Allowed  bool            `json:"allowed"`
+			Exceeded *QuotaViolation `json:"exceeded"`
+		}
+		require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &response))
+		assert.False(t, response.Allowed)
+		require.NotNil(t, response.Exceeded)
+		assert.Equal(t, "videos_per_month", response.Exceeded.Quota)
+		require.NotNil(t, response.Exceeded.ResetsAt)
+
+		rec = serveQuota(router, "POST", "/internal/quotas/8/check", serviceTokenHeader, "servico", `{"videos": 1, "bytes": 10}`)
+		require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &response))
+		assert.True(t, response.Allowed)
+		assert.Nil(t, response.Exceeded)
+
+		assert.Equal(t, http.StatusBadRequest, serveQuota(router, "POST", "/internal/quotas/abc/check", serviceTokenHeader, "servico", `{}`).Code)
+		assert.Equal(t, http.StatusBadRequest, serveQuota(router, "POST", "/internal/quotas/7/check", serviceTokenHeader, "servico", `{`).Code)
+	})
+
+	t.Run("check reserva a cota até o evento ou a liberação", func(t *testing.T) {
+		reserve := func(videoID string) bool {
+			body := `{"reserve": [{"video_id": "` + videoID + `", "bytes": 400, "frames_seconds": 30}]}`
+			rec := serveQuota(router, "POST", "/internal/quotas/9/check", serviceTokenHeader, "servico", body)
+			require.Equal(t, http.StatusOK, rec.Code)
+			var response struct {
+				Allowed bool `json:"allowed"`
+			}
+			require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &response))
+			return response.Allowed
+		}
+
+		// Checagens seguidas enxergam a reserva anterior: só cabe um vídeo no mês
+		assert.True(t, reserve("video_a"))
+		assert.False(t, reserve("video_b"))
+		// Repetir a checagem do mesmo vídeo não conta em dobro
+		assert.True(t, reserve("video_a"))
+
+		// Só o dono libera a reserva
+		assert.Equal(t, http.StatusNoContent, serveQuota(router, "DELETE", "/internal/quotas/8/reservations/video_a", serviceTokenHeader, "servico", "").Code)
+		assert.False(t, reserve("video_b"))
+		assert.Equal(t, http.StatusNoContent, serveQuota(router, "DELETE", "/internal/quotas/9/reservations/video_a", serviceTokenHeader, "servico", "").Code)
+		assert.True(t, reserve("video_b"))
+
+		rec := serveQuota(router, "POST", "/internal/quotas/9/check", serviceTokenHeader, "servico", `{"reserve": [{"video_id": ""}]}`)
+		assert.Equal(t, http.StatusBadRequest, rec.Code)
+	})
+
+	t.Run("admin ajusta e remove a exceção", func(t *testing.T) {
+		rec := serveQuota(router, "PUT", "/admin/quotas/7", adminTokenHeader, "admin", `{"max_videos_per_month": 5}`)
+		require.Equal(t, http.StatusOK, rec.Code)
+		var response struct {
+			Quota    QuotaLimits    `json:"quota"`
+			Override *QuotaOverride `json:"override"`
+			Usage    map[string]float64
+		}
+		require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &response))
+		assert.Equal(t, QuotaLimits{MaxStorageBytes: 1000, MaxVideosPerMonth: 5}, response.Quota)
+		assert.Equal(t, 1.0, response.Usage["videos_this_month"])
+
+		rec = serveQuota(router, "POST", "/internal/quotas/7/check", serviceTokenHeader, "servico", `{"videos": 1}`)
+		assert.Contains(t, rec.Body.String(), `"allowed":true`)
+
+		assert.Equal(t, http.StatusBadRequest, serveQuota(router, "PUT", "/admin/quotas/7", adminTokenHeader, "admin", `{"max_storage_bytes": -1}`).Code)
+
+		rec = serveQuota(router, "DELETE", "/admin/quotas/7", adminTokenHeader, "admin", "")
+		require.Equal(t, http.StatusOK, rec.Code)
+		response.Override = nil
+		require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &response))
+		assert.Nil(t, response.Override)
+		assert.Equal(t, ss.Quotas, response.Quota)
+
+		// Corpo vazio também volta ao padrão
+		serveQuota(router, "PUT", "/admin/quotas/7", adminTokenHeader, "admin", `{"max_videos_per_month": 5}`)
+		serveQuota(router, "PUT", "/admin/quotas/7", adminTokenHeader, "admin", `{}`)
+		override, err := ss.Videos.GetQuota(context.Background(), 7)
+		require.NoError(t, err)
+		assert.Nil(t, override)
+	})
+}
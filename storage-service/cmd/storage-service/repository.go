@@ -0,0 +1,673 @@
+package main
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+)
+
+var (
+	errVideoNotFound = errors.New("vídeo não encontrado")
+	errVideoExists   = errors.New("vídeo já registrado")
+	errBatchNotFound = errors.New("lote não encontrado")
+	// O vídeo foi excluído e o ID não pode ser registrado de novo
+	errVideoDeleted = errors.New("vídeo excluído")
+)
+
+// Persistência dos vídeos e lotes usada pelos handlers e pelo worker de
+// eventos. Os vídeos devolvidos são cópias: alterá-los não muda o repositório
+// até passarem por Create ou Update
+type VideoRepository interface {
+	// Registrar um vídeo novo; errVideoExists se o ID já existir e
+	// errVideoDeleted se o vídeo foi excluído
+	Create(ctx context.Context, video *VideoData) error
+	Get(ctx context.Context, videoID string) (*VideoData, error)
+	// Ler, alterar e gravar o vídeo de forma atômica. fn recebe nil quando o
+	// vídeo ainda não existe e devolve o vídeo a gravar, ou nil para não gravar
+	// nada; um erro de fn cancela a alteração e é repassado. Vídeos excluídos
+	// retornam errVideoDeleted sem chamar fn
+	Update(ctx context.Context, videoID string, fn func(video *VideoData) (*VideoData, error)) error
+	// Gravar status e progresso se a sequência for mais nova que a última
+	// aplicada; retorna false quando o evento já era conhecido
+	UpdateStatus(ctx context.Context, videoID, status string, progress int, sequence int64) (bool, error)
+	// Vídeos que atendem ao filtro, sem o histórico de versões
+	List(ctx context.Context, filter VideoFilter) ([]*VideoData, error)
+	// Até limit vídeos do filtro depois do cursor (nil começa do início), com
+	// o total do filtro e o cursor da página seguinte
+	ListPage(ctx context.Context, filter VideoFilter, after *VideoCursor, limit int) (*VideoPage, error)
+	Delete(ctx context.Context, videoID string) error
+	Stats(ctx context.Context, userID int) (*VideoStats, error)
+
+	// Lotes; os vídeos de cada lote são os que têm o mesmo BatchID
+	CreateBatch(ctx context.Context, batch *BatchData) error
+	GetBatch(ctx context.Context, batchID string) (*BatchData, error)
+	UpdateBatch(ctx context.Context, batchID string, fn func(batch *BatchData) (*BatchData, error)) error
+
+	// Exclusões: remover o vídeo e registrar a limpeza pendente na mesma
+	// operação; errVideoNotFound se o vídeo não existir
+	ScheduleDeletion(ctx context.Context, deletion *VideoDeletion) error
+	// Reservar a exclusão pendente mais antiga já vencida, somando uma
+	// tentativa e adiando a próxima pelo lease; nil quando não há nenhuma
+	ClaimDeletion(ctx context.Context, lease time.Duration) (*VideoDeletion, error)
+	CompleteDeletion(ctx context.Context, videoID string) error
+	FailDeletion(ctx context.Context, videoID, lastError string, retryAt time.Time) error
+	// Voltar a exclusão para pendente, para remover saídas gravadas depois
+	ReopenDeletion(ctx context.Context, videoID string) error
+
+	// Registrar consumo; um registro com o mesmo vídeo, tipo e versão é ignorado
+	RecordUsage(ctx context.Context, record *UsageRecord) error
+	// Bytes guardados hoje pelo usuário e vídeos e segundos de processamento
+	// registrados desde since
+	Usage(ctx context.Context, userID int, since time.Time) (*UserUsage, error)
+	// Sob um lock por usuário, somar ao consumo as reservas vigentes (fora as
+	// dos próprios vídeos reservados) e, se allow aprovar, gravar as reservas.
+	// Devolve o consumo avaliado
+	ReserveQuota(ctx context.Context, userID int, since time.Time, reservations []*QuotaReservation, allow func(usage *UserUsage) bool) (*UserUsage, error)
+	// Alterar a reserva do vídeo com fn, que recebe uma cópia; nil remove. fn
+	// não é chamada quando não há reserva
+	UpdateReservation(ctx context.Context, videoID string, fn func(reservation *QuotaReservation) *QuotaReservation) error
+	// Exceção do usuário aos limites padrão; nil quando não há
+	GetQuota(ctx context.Context, userID int) (*QuotaOverride, error)
+	// Gravar a exceção do usuário; nil remove
+	SetQuota(ctx context.Context, userID int, override *QuotaOverride) error
+}
+
+// Filtro de List e ListPage; campos vazios não filtram. A ordem é por SortBy
+// (data de upload se vazio), do maior para o menor salvo Ascending, e
+// desempata pelo ID
+type VideoFilter struct {
+	UserID    int
+	BatchID   string
+	Status    string
+	SortBy    string // uploaded_at, status, duration, size
+	Ascending bool
+	// Upload em [UploadedFrom, UploadedTo)
+	UploadedFrom time.Time
+	UploadedTo   time.Time
+	// Limites inclusivos de duração (segundos) e tamanho (bytes) do original
+	MinDuration float64
+	MaxDuration float64
+	MinSize     int64
+	MaxSize     int64
+	// Busca no título: trecho sem diferenciar maiúsculas ou, com FullText,
+	// todas as palavras da busca entre as palavras do título
+	Search   string
+	FullText bool
+	// Candidatos da retenção: último processamento concluído antes de
+	// ProcessedBefore e, com Retained, ainda com artefatos no MinIO
+	ProcessedBefore time.Time
+	Retained        bool
+}
+
+// Campos de ordenação aceitos em VideoFilter.SortBy
+const (
+	SortByUploadedAt = "uploaded_at"
+	SortByStatus     = "status"
+	SortByDuration   = "duration"
+	SortBySize       = "size"
+)
+
+func validSortBy(sortBy string) bool {
+	switch sortBy {
+	case "", SortByUploadedAt, SortByStatus, SortByDuration, SortBySize:
+		return true
+	}
+	return false
+}
+
+// Posição do último vídeo de uma página: os campos de ordenação e o ID que
+// desempata. Só o campo de VideoFilter.SortBy é usado
+type VideoCursor struct {
+	VideoID    string    `json:"id"`
+	UploadedAt time.Time `json:"uploaded_at,omitempty"`
+	Status     string    `json:"status,omitempty"`
+	Duration   float64   `json:"duration,omitempty"`
+	Size       int64     `json:"size,omitempty"`
+}
+
+func cursorOf(video *VideoData) *VideoCursor {
+	return &VideoCursor{
+		VideoID:    video.VideoID,
+		UploadedAt: video.UploadedAt,
+		Status:     video.Status,
+		Duration:   video.Duration,
+		Size:       video.Size,
+	}
+}
+
+// Página de ListPage; Next é nil na última página
+type VideoPage struct {
+	Videos []*VideoData
+	Total  int
+	Next   *VideoCursor
+}
+
+// Totais de um usuário para o StatsHandler
+type VideoStats struct {
+	TotalVideos    int
+	Completed      int
+	Processing     int
+	Failed         int
+	TotalSize      int64
+	TotalFrames    int
+	FailuresByCode map[string]int
+}
+
+// Repositório em memória, usado nos testes dos handlers e como referência
+// do contrato
+type memoryVideoRepository struct {
+	mu        sync.RWMutex
+	videos    map[string]*VideoData
+	batches   map[string]*BatchData
+	deletions map[string]*VideoDeletion
+	usage     map[string]*UsageRecord
+	quotas    map[int]*QuotaOverride
+
+	reservations map[string]*QuotaReservation
+}
+
+func newMemoryVideoRepository() *memoryVideoRepository {
+	return &memoryVideoRepository{
+		videos:    make(map[string]*VideoData),
+		batches:   make(map[string]*BatchData),
+		deletions: make(map[string]*VideoDeletion),
+		usage:     make(map[string]*UsageRecord),
+		quotas:    make(map[int]*QuotaOverride),
+
+		reservations: make(map[string]*QuotaReservation),
+	}
+}
+
+func (m *memoryVideoRepository) Create(ctx context.Context, video *VideoData) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, exists := m.videos[video.VideoID]; exists {
+		return errVideoExists
+	}
+	if _, deleted := m.deletions[video.VideoID]; deleted {
+		return errVideoDeleted
+	}
+	m.videos[video.VideoID] = cloneVideo(video)
+	return nil
+}
+
+func (m *memoryVideoRepository) Get(ctx context.Context, videoID string) (*VideoData, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	video, exists := m.videos[videoID]
+	if !exists {
+		return nil, errVideoNotFound
+	}
+	return cloneVideo(video), nil
+}
+
+func (m *memoryVideoRepository) Update(ctx context.Context, videoID string, fn func(video *VideoData) (*VideoData, error)) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var current *VideoData
+	if video, exists := m.videos[videoID]; exists {
+		current = cloneVideo(video)
+	} else if _, deleted := m.deletions[videoID]; deleted {
+		return errVideoDeleted
+	}
+	updated, err := fn(current)
+	if err != nil || updated == nil {
+		return err
+	}
+	m.videos[videoID] = cloneVideo(updated)
+	return nil
+}
+
+func (m *memoryVideoRepository) UpdateStatus(ctx context.Context, videoID, status string, progress int, sequence int64) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	video, exists := m.videos[videoID]
+	if !exists {
+		return false, errVideoNotFound
+	}
+	if sequence <= video.LastEventSeq {
+		return false, nil
+	}
+	video.Status = status
+	video.Progress = progress
+	video.LastEventSeq = sequence
+	return true, nil
+}
+
+func (m *memoryVideoRepository) List(ctx context.Context, filter VideoFilter) ([]*VideoData, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	return m.list(filter), nil
+}
+
+func (m *memoryVideoRepository) ListPage(ctx context.Context, filter VideoFilter, after *VideoCursor, limit int) (*VideoPage, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	videos := m.list(filter)
+	page := &VideoPage{Total: len(videos)}
+	if after != nil {
+		start := sort.Search(len(videos), func(i int) bool {
+			return compareVideos(cursorOf(videos[i]), after, filter.SortBy, filter.Ascending) > 0
+		})
+		videos = videos[start:]
+	}
+	if limit > 0 && len(videos) > limit {
+		videos = videos[:limit]
+		page.Next = cursorOf(videos[limit-1])
+	}
+	page.Videos = videos
+	return page, nil
+}
+
+// Cópias dos vídeos do filtro, ordenadas; deve ser chamado com mu travado
+func (m *memoryVideoRepository) list(filter VideoFilter) []*VideoData {
+	var videos []*VideoData
+	for _, video := range m.videos {
+		if !matchesFilter(video, filter) {
+			continue
+		}
+		listed := cloneVideo(video)
+		listed.Versions = nil
+		videos = append(videos, listed)
+	}
+	sortVideos(videos, filter.SortBy, filter.Ascending)
+	return videos
+}
+
+func matchesFilter(video *VideoData, filter VideoFilter) bool {
+	switch {
+	case filter.UserID != 0 && video.UserID != filter.UserID,
+		filter.BatchID != "" && video.BatchID != filter.BatchID,
+		filter.Status != "" && video.Status != filter.Status,
+		!filter.UploadedFrom.IsZero() && video.UploadedAt.Before(filter.UploadedFrom),
+		!filter.UploadedTo.IsZero() && !video.UploadedAt.Before(filter.UploadedTo),
+		filter.MinDuration > 0 && video.Duration < filter.MinDuration,
+		filter.MaxDuration > 0 && video.Duration > filter.MaxDuration,
+		filter.MinSize > 0 && video.Size < filter.MinSize,
+		filter.MaxSize > 0 && video.Size > filter.MaxSize,
+		!filter.ProcessedBefore.IsZero() && (video.ProcessedAt == nil || !video.ProcessedAt.Before(filter.ProcessedBefore)),
+		filter.Retained && !video.retainsArtifacts():
+		return false
+	}
+	if filter.Search == "" {
+		return true
+	}
+	if !filter.FullText {
+		return strings.Contains(strings.ToLower(video.Title), strings.ToLower(filter.Search))
+	}
+
+	words := make(map[string]bool)
+	for _, word := range titleWords(video.Title) {
+		words[word] = true
+	}
+	terms := titleWords(filter.Search)
+	for _, term := range terms {
+		if !words[term] {
+			return false
+		}
+	}
+	return len(terms) > 0
+}
+
+// Palavras do título como no índice full-text do PostgreSQL: tudo que não é
+// letra ou dígito separa palavras, sem diferenciar maiúsculas
+func titleWords(title string) []string {
+	return strings.FieldsFunc(strings.ToLower(title), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
+
+// Mesma ordem do ORDER BY <campo>, id do repositório SQL
+func sortVideos(videos []*VideoData, sortBy string, ascending bool) {
+	sort.Slice(videos, func(i, j int) bool {
+		return compareVideos(cursorOf(videos[i]), cursorOf(videos[j]), sortBy, ascending) < 0
+	})
+}
+
+// Comparar duas posições na ordem da listagem: pelo campo de ordenação e
+// depois pelo ID, invertendo tudo na ordem decrescente
+func compareVideos(a, b *VideoCursor, sortBy string, ascending bool) int {
+	var result int
+	switch sortBy {
+	case SortByStatus:
+		result = strings.Compare(a.Status, b.Status)
+	case SortByDuration:
+		result = cmp.Compare(a.Duration, b.Duration)
+	case SortBySize:
+		result = cmp.Compare(a.Size, b.Size)
+	default:
+		result = a.UploadedAt.Compare(b.UploadedAt)
+	}
+	if result == 0 {
+		result = strings.Compare(a.VideoID, b.VideoID)
+	}
+	if !ascending {
+		result = -result
+	}
+	return result
+}
+
+func (m *memoryVideoRepository) Delete(ctx context.Context, videoID string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, exists := m.videos[videoID]; !exists {
+		return errVideoNotFound
+	}
+	delete(m.videos, videoID)
+	return nil
+}
+
+func (m *memoryVideoRepository) Stats(ctx context.Context, userID int) (*VideoStats, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	stats := &VideoStats{FailuresByCode: make(map[string]int)}
+	for _, video := range m.videos {
+		if video.UserID != userID {
+			continue
+		}
+		stats.TotalVideos++
+		switch video.Status {
+		case "completed":
+			stats.Completed++
+			stats.TotalSize += video.ZipSize
+			stats.TotalFrames += video.FrameCount
+		case "processing", "queued":
+			stats.Processing++
+		case "failed", "error":
+			stats.Failed++
+			if video.ErrorCode != "" {
+				stats.FailuresByCode[video.ErrorCode]++
+			}
+		}
+	}
+	return stats, nil
+}
+
+func (m *memoryVideoRepository) RecordUsage(ctx context.Context, record *UsageRecord) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	key := fmt.Sprintf("%s/%s/%d", record.VideoID, record.Kind, record.Version)
+	if _, exists := m.usage[key]; !exists {
+		stored := *record
+		m.usage[key] = &stored
+	}
+	return nil
+}
+
+func (m *memoryVideoRepository) Usage(ctx context.Context, userID int, since time.Time) (*UserUsage, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	return m.usageLocked(userID, since, nil), nil
+}
+
+func (m *memoryVideoRepository) ReserveQuota(ctx context.Context, userID int, since time.Time, reservations []*QuotaReservation, allow func(usage *UserUsage) bool) (*UserUsage, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	exclude := make(map[string]bool, len(reservations))
+	for _, reservation := range reservations {
+		exclude[reservation.VideoID] = true
+	}
+	usage := m.usageLocked(userID, since, exclude)
+	if allow(usage) {
+		for _, reservation := range reservations {
+			stored := *reservation
+			m.reservations[reservation.VideoID] = &stored
+		}
+	}
+	return usage, nil
+}
+
+func (m *memoryVideoRepository) UpdateReservation(ctx context.Context, videoID string, fn func(reservation *QuotaReservation) *QuotaReservation) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	current, exists := m.reservations[videoID]
+	if !exists {
+		return nil
+	}
+	copied := *current
+	updated := fn(&copied)
+	if updated == nil {
+		delete(m.reservations, videoID)
+		return nil
+	}
+	stored := *updated
+	m.reservations[videoID] = &stored
+	return nil
+}
+
+// Consumo do usuário com as reservas vigentes, fora as dos vídeos em exclude
+func (m *memoryVideoRepository) usageLocked(userID int, since time.Time, exclude map[string]bool) *UserUsage {
+	usage := &UserUsage{}
+	now := time.Now()
+	for _, reservation := range m.reservations {
+		if reservation.UserID == userID && reservation.ExpiresAt.After(now) && !exclude[reservation.VideoID] {
+			usage.addReservation(reservation)
+		}
+	}
+	for _, video := range m.videos {
+		if video.UserID == userID {
+			usage.StoredBytes += video.storedBytes()
+		}
+	}
+	for _, record := range m.usage {
+		if record.UserID == userID && !record.RecordedAt.Before(since) {
+			usage.Videos += record.Videos
+			usage.ProcessingSeconds += record.ProcessingSeconds
+		}
+	}
+	return usage
+}
+
+func (m *memoryVideoRepository) GetQuota(ctx context.Context, userID int) (*QuotaOverride, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	return m.quotas[userID].clone(), nil
+}
+
+func (m *memoryVideoRepository) SetQuota(ctx context.Context, userID int, override *QuotaOverride) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if override == nil {
+		delete(m.quotas, userID)
+		return nil
+	}
+	m.quotas[userID] = override.clone()
+	return nil
+}
+
+func (m *memoryVideoRepository) CreateBatch(ctx context.Context, batch *BatchData) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, exists := m.batches[batch.BatchID]; !exists {
+		created := *batch
+		created.VideoIDs = nil
+		m.batches[batch.BatchID] = &created
+	}
+	return nil
+}
+
+func (m *memoryVideoRepository) GetBatch(ctx context.Context, batchID string) (*BatchData, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.batch(batchID)
+}
+
+func (m *memoryVideoRepository) UpdateBatch(ctx context.Context, batchID string, fn func(batch *BatchData) (*BatchData, error)) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	batch, err := m.batch(batchID)
+	if err != nil {
+		return err
+	}
+	updated, err := fn(batch)
+	if err != nil || updated == nil {
+		return err
+	}
+	stored := *updated
+	stored.VideoIDs = nil
+	if updated.CompletedAt != nil {
+		completedAt := *updated.CompletedAt
+		stored.CompletedAt = &completedAt
+	}
+	m.batches[batchID] = &stored
+	return nil
+}
+
+// Cópia do lote com os vídeos associados; deve ser chamado com mu travado
+func (m *memoryVideoRepository) batch(batchID string) (*BatchData, error) {
+	stored, exists := m.batches[batchID]
+	if !exists {
+		return nil, errBatchNotFound
+	}
+	batch := *stored
+	if stored.CompletedAt != nil {
+		completedAt := *stored.CompletedAt
+		batch.CompletedAt = &completedAt
+	}
+
+	var members []*VideoData
+	for _, video := range m.videos {
+		if video.BatchID == batchID {
+			members = append(members, video)
+		}
+	}
+	sortVideos(members, SortByUploadedAt, true)
+	for _, video := range members {
+		batch.VideoIDs = append(batch.VideoIDs, video.VideoID)
+	}
+	return &batch, nil
+}
+
+func (m *memoryVideoRepository) ScheduleDeletion(ctx context.Context, deletion *VideoDeletion) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, exists := m.videos[deletion.VideoID]; !exists {
+		return errVideoNotFound
+	}
+	delete(m.videos, deletion.VideoID)
+	m.deletions[deletion.VideoID] = cloneDeletion(deletion)
+	return nil
+}
+
+func (m *memoryVideoRepository) ClaimDeletion(ctx context.Context, lease time.Duration) (*VideoDeletion, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := time.Now()
+	var next *VideoDeletion
+	for _, deletion := range m.deletions {
+		if deletion.Status != "pending" || deletion.NextAttemptAt.After(now) {
+			continue
+		}
+		if next == nil || deletion.RequestedAt.Before(next.RequestedAt) ||
+			(deletion.RequestedAt.Equal(next.RequestedAt) && deletion.VideoID < next.VideoID) {
+			next = deletion
+		}
+	}
+	if next == nil {
+		return nil, nil
+	}
+	next.Attempts++
+	next.NextAttemptAt = now.Add(lease)
+	return cloneDeletion(next), nil
+}
+
+func (m *memoryVideoRepository) CompleteDeletion(ctx context.Context, videoID string) error {
+	return m.updateDeletion(videoID, func(deletion *VideoDeletion) {
+		completedAt := time.Now()
+		deletion.Status = "completed"
+		deletion.LastError = ""
+		deletion.CompletedAt = &completedAt
+	})
+}
+
+func (m *memoryVideoRepository) FailDeletion(ctx context.Context, videoID, lastError string, retryAt time.Time) error {
+	return m.updateDeletion(videoID, func(deletion *VideoDeletion) {
+		deletion.LastError = lastError
+		deletion.NextAttemptAt = retryAt
+	})
+}
+
+func (m *memoryVideoRepository) ReopenDeletion(ctx context.Context, videoID string) error {
+	return m.updateDeletion(videoID, func(deletion *VideoDeletion) {
+		deletion.Status = "pending"
+		deletion.NextAttemptAt = time.Now()
+		deletion.CompletedAt = nil
+	})
+}
+
+func (m *memoryVideoRepository) updateDeletion(videoID string, fn func(deletion *VideoDeletion)) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	deletion, exists := m.deletions[videoID]
+	if !exists {
+		return errVideoNotFound
+	}
+	fn(deletion)
+	return nil
+}
+
+func cloneDeletion(deletion *VideoDeletion) *VideoDeletion {
+	clone := *deletion
+	clone.Targets = append([]DeletionTarget(nil), deletion.Targets...)
+	if deletion.CompletedAt != nil {
+		completedAt := *deletion.CompletedAt
+		clone.CompletedAt = &completedAt
+	}
+	return &clone
+}
+
+// Cópia profunda, para que alterações de quem chamou não vazem para o
+// repositório (e vice-versa)
+func cloneVideo(video *VideoData) *VideoData {
+	clone := *video
+	clone.SubtitleLanguages = append([]string(nil), video.SubtitleLanguages...)
+	clone.Renditions = append([]string(nil), video.Renditions...)
+	clone.ProcessedAt = cloneTime(video.ProcessedAt)
+	clone.OriginalExpiredAt = cloneTime(video.OriginalExpiredAt)
+	clone.ExpiredAt = cloneTime(video.ExpiredAt)
+	clone.ExpiryWarnedAt = cloneTime(video.ExpiryWarnedAt)
+	clone.Versions = nil
+	for _, version := range video.Versions {
+		if version.ProcessedAt != nil {
+			processedAt := *version.ProcessedAt
+			version.ProcessedAt = &processedAt
+		}
+		version.Options = append(json.RawMessage(nil), version.Options...)
+		clone.Versions = append(clone.Versions, version)
+	}
+	return &clone
+}
+
+func cloneTime(t *time.Time) *time.Time {
+	if t == nil {
+		return nil
+	}
+	clone := *t
+	return &clone
+}
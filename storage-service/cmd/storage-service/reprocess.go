@@ -0,0 +1,500 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/minio/minio-go/v7"
+	"github.com/streadway/amqp"
+)
+
+// Fila de jobs consumida pelo processing-service
+const processingQueue = "video_processing"
+
+// Execução de processamento de um vídeo. A versão 1 é o upload original; cada
+// reprocessamento cria a próxima, com saídas próprias (frames_{id}_v2.zip)
+type VideoVersion struct {
+	Version      int             `json:"version"`
+	Status       string          `json:"status"`
+	Options      json.RawMessage `json:"options,omitempty"`
+	RequestedAt  time.Time       `json:"requested_at"`
+	ProcessedAt  *time.Time      `json:"processed_at,omitempty"`
+	FrameCount   int             `json:"frame_count"`
+	ZipSize      int64           `json:"zip_size"`
+	ShotCount    int             `json:"shot_count,omitempty"`
+	ErrorCode    string          `json:"error_code,omitempty"`
+	ErrorMessage string          `json:"error_message,omitempty"`
+	// Versões antigas além de MAX_VIDEO_VERSIONS têm os objetos removidos
+	Pruned bool `json:"pruned,omitempty"`
+
+	ZipObjectName  string `json:"-"`
+	ShotsObject    string `json:"-"`
+	ShotsCSVObject string `json:"-"`
+}
+
+// Mensagem de job no formato do processing-service; pipeline e overlay são
+// repassados como recebidos (já validados)
+type ProcessingMessage struct {
+	VideoID     string          `json:"video_id"`
+	Filename    string          `json:"filename"`
+	Bucket      string          `json:"bucket"`
+	ObjectName  string          `json:"object_name"`
+	UserID      string          `json:"user_id"`
+	Overlay     json.RawMessage `json:"overlay,omitempty"`
+	Pipeline    json.RawMessage `json:"pipeline,omitempty"`
+	Sequence    int64           `json:"sequence,omitempty"`
+	Size        int64           `json:"size,omitempty"`
+	Version     int             `json:"version,omitempty"`
+	ContentHash string          `json:"content_hash,omitempty"`
+	JobType     string          `json:"job_type,omitempty"`
+	BatchID     string          `json:"batch_id,omitempty"`
+	Members     []BatchMember   `json:"members,omitempty"`
+}
+
+// Opções aceitas por POST /videos/{id}/reprocess
+type ReprocessRequest struct {
+	Pipeline json.RawMessage `json:"pipeline,omitempty"`
+	Overlay  *OverlayOptions `json:"overlay,omitempty"`
+}
+
+// Opções de marca d'água/texto (mesmas regras do upload-service)
+type OverlayOptions struct {
+	Type     string  `json:"type"`
+	Text     string  `json:"text,omitempty"`
+	Position string  `json:"position,omitempty"`
+	Opacity  float64 `json:"opacity,omitempty"`
+	Scale    float64 `json:"scale,omitempty"`
+	Margin   int     `json:"margin,omitempty"`
+}
+
+var validOverlayPositions = map[string]bool{
+	"":             true,
+	"top-left":     true,
+	"top-right":    true,
+	"bottom-left":  true,
+	"bottom-right": true,
+	"center":       true,
+}
+
+var pipelineClient = &http.Client{Timeout: 5 * time.Second}
+
+// Número de versões concluídas mantidas por vídeo (MAX_VIDEO_VERSIONS)
+func maxVideoVersions() int {
+	n, err := strconv.Atoi(getEnv("MAX_VIDEO_VERSIONS", "5"))
+	if err != nil || n < 1 {
+		return 5
+	}
+	return n
+}
+
+func (o *OverlayOptions) validate() error {
+	switch o.Type {
+	case "image":
+	case "text":
+		if strings.TrimSpace(o.Text) == "" {
+			return fmt.Errorf("overlay de texto requer o campo text")
+		}
+	default:
+		return fmt.Errorf("tipo de overlay inválido: %q (use image ou text)", o.Type)
+	}
+	if !validOverlayPositions[o.Position] {
+		return fmt.Errorf("posição de overlay inválida: %q", o.Position)
+	}
+	if o.Opacity < 0 || o.Opacity > 1 {
+		return fmt.Errorf("opacidade do overlay deve estar entre 0 e 1")
+	}
+	if o.Scale < 0 || o.Scale > 1 {
+		return fmt.Errorf("escala do overlay deve estar entre 0 e 1")
+	}
+	if o.Margin < 0 {
+		return fmt.Errorf("margem do overlay não pode ser negativa")
+	}
+	return nil
+}
+
+// Validar o pipeline no registro de etapas do processing-service
+func validatePipeline(raw json.RawMessage) (int, error) {
+	url := getEnv("PROCESSING_SERVICE_URL", "http://processing-service:8080") + "/pipelines/validate"
+	resp, err := pipelineClient.Post(url, "application/json", bytes.NewReader(raw))
+	if err != nil {
+		return http.StatusServiceUnavailable, fmt.Errorf("não foi possível validar o pipeline no momento")
+	}
+	defer resp.Body.Close()
+
+	var validation struct {
+		Valid bool   `json:"valid"`
+		Error string `json:"error"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&validation); err != nil {
+		return http.StatusServiceUnavailable, fmt.Errorf("resposta inválida ao validar o pipeline")
+	}
+	if !validation.Valid {
+		return http.StatusBadRequest, fmt.Errorf("pipeline inválido: %s", validation.Error)
+	}
+	return http.StatusOK, nil
+}
+
+// Criar a versão 1 a partir dos campos atuais para vídeos processados antes
+// do histórico de versões
+func (v *VideoData) ensureVersions() {
+	if len(v.Versions) > 0 || v.ZipObjectName == "" {
+		return
+	}
+	processedAt := v.UploadedAt
+	v.Versions = []VideoVersion{{
+		Version:        1,
+		Status:         v.Status,
+		RequestedAt:    v.UploadedAt,
+		ProcessedAt:    &processedAt,
+		FrameCount:     v.FrameCount,
+		ZipSize:        v.ZipSize,
+		ShotCount:      v.ShotCount,
+		ZipObjectName:  v.ZipObjectName,
+		ShotsObject:    v.ShotsObject,
+		ShotsCSVObject: v.ShotsCSVObject,
+	}}
+	v.CurrentVersion = 1
+}
+
+func (v *VideoData) version(n int) *VideoVersion {
+	for i := range v.Versions {
+		if v.Versions[i].Version == n {
+			return &v.Versions[i]
+		}
+	}
+	return nil
+}
+
+// Versão servida por padrão: a mais recente concluída e ainda não removida
+func (v *VideoData) latestCompletedVersion() *VideoVersion {
+	var latest *VideoVersion
+	for i := range v.Versions {
+		version := &v.Versions[i]
+		if version.Status == "completed" && !version.Pruned && (latest == nil || version.Version > latest.Version) {
+			latest = version
+		}
+	}
+	return latest
+}
+
+// Registrar o resultado de um job de frames no histórico de versões e marcar
+// como removidas as versões concluídas além do limite. Retorna os objetos a
+// apagar do MinIO; deve ser chamado dentro de Videos.Update
+func (v *VideoData) recordVersion(result ProcessingResult) []string {
+	number := result.Version
+	if number < 1 {
+		number = 1
+	}
+
+	version := v.version(number)
+	if version == nil {
+		v.Versions = append(v.Versions, VideoVersion{Version: number, RequestedAt: result.ProcessedAt})
+		version = &v.Versions[len(v.Versions)-1]
+	}
+
+	processedAt := result.ProcessedAt
+	version.Status = result.Status
+	version.ProcessedAt = &processedAt
+	version.FrameCount = result.FrameCount
+	version.ZipSize = result.ZipSize
+	version.ZipObjectName = result.ZipObjectName
+	version.ShotCount = v.ShotCount
+	version.ShotsObject = v.ShotsObject
+	version.ShotsCSVObject = v.ShotsCSVObject
+	version.ErrorCode = result.ErrorCode
+	version.ErrorMessage = result.Error
+	if options, ok := result.Metadata["options"]; ok {
+		if data, err := json.Marshal(options); err == nil {
+			version.Options = data
+		}
+	}
+
+	sort.Slice(v.Versions, func(i, j int) bool { return v.Versions[i].Version < v.Versions[j].Version })
+
+	var removed []string
+	kept := 0
+	for i := len(v.Versions) - 1; i >= 0; i-- {
+		old := &v.Versions[i]
+		if old.Status != "completed" || old.Pruned {
+			continue
+		}
+		kept++
+		if kept <= maxVideoVersions() {
+			continue
+		}
+		for _, object := range []string{old.ZipObjectName, old.ShotsObject, old.ShotsCSVObject} {
+			if object != "" {
+				removed = append(removed, object)
+			}
+		}
+		old.Pruned = true
+	}
+
+	latest := v.latestCompletedVersion()
+	if latest == nil {
+		return removed
+	}
+	v.CurrentVersion = latest.Version
+
+	// Uma execução que falhou não apaga as saídas da versão atual
+	if result.Status != "completed" {
+		v.FrameCount = latest.FrameCount
+		v.ZipSize = latest.ZipSize
+		v.ZipObjectName = latest.ZipObjectName
+		v.ShotCount = latest.ShotCount
+		v.ShotsObject = latest.ShotsObject
+		v.ShotsCSVObject = latest.ShotsCSVObject
+	}
+	return removed
+}
+
+// Apagar do MinIO as saídas de versões removidas do histórico
+func (ss *StorageService) removeVersionObjects(videoID string, objects []string) {
+	for _, object := range objects {
+		if err := ss.MinioClient.RemoveObject(context.Background(), "video-processed", object, minio.RemoveObjectOptions{}); err != nil {
+			log.Printf("Erro ao remover %s do vídeo %s: %v", object, videoID, err)
+			continue
+		}
+		log.Printf("Versão antiga removida do vídeo %s: %s", videoID, object)
+	}
+}
+
+// Reprocessar o vídeo original com novas opções, gerando a próxima versão
+func (ss *StorageService) ReprocessHandler(w http.ResponseWriter, r *http.Request) {
+	videoID := mux.Vars(r)["id"]
+
+	// Usuário verificado pelo middleware de autenticação
+	userID, err := requestUserID(r)
+	if err != nil {
+		http.Error(w, "Token de autenticação inválido", http.StatusUnauthorized)
+		return
+	}
+
+	var req ReprocessRequest
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, fmt.Sprintf("JSON inválido: %v", err), http.StatusBadRequest)
+			return
+		}
+	}
+	if req.Overlay != nil {
+		if err := req.Overlay.validate(); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if req.Overlay.Type == "image" {
+			watermark := fmt.Sprintf("watermarks/%d.png", userID)
+			if _, err := ss.MinioClient.StatObject(context.Background(), "user-assets", watermark, minio.StatObjectOptions{}); err != nil {
+				http.Error(w, "Envie a marca d'água em /watermark antes de usar overlay de imagem", http.StatusBadRequest)
+				return
+			}
+		}
+	}
+	if string(req.Pipeline) == "null" {
+		req.Pipeline = nil
+	}
+	if len(req.Pipeline) > 0 {
+		if status, err := validatePipeline(req.Pipeline); err != nil {
+			http.Error(w, err.Error(), status)
+			return
+		}
+	}
+
+	// Verificar se o vídeo pertence ao usuário
+	video := ss.ownedVideo(w, r, videoID, userID)
+	if video == nil {
+		return
+	}
+	originalObject := video.OriginalObject
+	contentHash := video.ContentHash
+
+	if video.OriginalExpiredAt != nil {
+		http.Error(w, "Vídeo original expirou", http.StatusGone)
+		return
+	}
+	if originalObject == "" {
+		http.Error(w, "Vídeo original não disponível", http.StatusNotFound)
+		return
+	}
+	info, err := ss.MinioClient.StatObject(context.Background(), "video-uploads", originalObject, minio.StatObjectOptions{})
+	if err != nil {
+		log.Printf("Original do vídeo %s indisponível (%s): %v", videoID, originalObject, err)
+		http.Error(w, "Vídeo original não disponível", http.StatusNotFound)
+		return
+	}
+
+	overlay, _ := json.Marshal(req.Overlay)
+	message := ProcessingMessage{
+		VideoID:     videoID,
+		Bucket:      "video-uploads",
+		ObjectName:  originalObject,
+		UserID:      strconv.Itoa(userID),
+		Pipeline:    req.Pipeline,
+		Size:        info.Size,
+		ContentHash: contentHash,
+	}
+	if req.Overlay != nil {
+		message.Overlay = overlay
+	}
+
+	// Reservar a próxima versão; o vídeo não pode ter job de frames em andamento
+	errInProgress := errors.New("vídeo em processamento")
+	next := 1
+	var previousStatus string
+	var previousProgress int
+	err = ss.Videos.Update(r.Context(), videoID, func(video *VideoData) (*VideoData, error) {
+		if video == nil {
+			return nil, errVideoNotFound
+		}
+		if video.Status == "queued" || video.Status == "processing" {
+			return nil, errInProgress
+		}
+		video.ensureVersions()
+		for _, version := range video.Versions {
+			if version.Version >= next {
+				next = version.Version + 1
+			}
+		}
+		options, _ := json.Marshal(map[string]json.RawMessage{"pipeline": req.Pipeline, "overlay": message.Overlay})
+		previousStatus, previousProgress = video.Status, video.Progress
+		video.Versions = append(video.Versions, VideoVersion{
+			Version:     next,
+			Status:      "queued",
+			Options:     options,
+			RequestedAt: time.Now(),
+		})
+		video.Status = "queued"
+		video.Progress = 0
+		message.Filename = video.Title
+		message.Version = next
+		message.Sequence = video.LastEventSeq + 1
+		video.LastEventSeq = message.Sequence
+		return video, nil
+	})
+	switch {
+	case errors.Is(err, errVideoNotFound):
+		http.Error(w, "Vídeo não encontrado", http.StatusNotFound)
+		return
+	case errors.Is(err, errInProgress):
+		http.Error(w, "Vídeo já está em processamento", http.StatusConflict)
+		return
+	case err != nil:
+		log.Printf("Erro ao reservar versão do vídeo %s: %v", videoID, err)
+		http.Error(w, "Erro interno do servidor", http.StatusInternalServerError)
+		return
+	}
+
+	if err := ss.enqueueReprocess(message); err != nil {
+		log.Printf("Erro ao enfileirar reprocessamento do vídeo %s: %v", videoID, err)
+
+		rollbackErr := ss.Videos.Update(context.Background(), videoID, func(video *VideoData) (*VideoData, error) {
+			if video == nil {
+				return nil, nil
+			}
+			if last := len(video.Versions) - 1; last >= 0 && video.Versions[last].Version == next {
+				video.Versions = video.Versions[:last]
+			}
+			video.Status, video.Progress = previousStatus, previousProgress
+			return video, nil
+		})
+		if rollbackErr != nil {
+			log.Printf("Erro ao desfazer versão %d do vídeo %s: %v", next, videoID, rollbackErr)
+		}
+
+		http.Error(w, "Erro interno do servidor", http.StatusInternalServerError)
+		return
+	}
+
+	log.Printf("Reprocessamento do vídeo %s enfileirado como versão %d", videoID, next)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"video_id": videoID,
+		"version":  next,
+		"status":   "queued",
+	})
+}
+
+// Publicar um job na fila do processing-service
+func (ss *StorageService) publishJob(message ProcessingMessage) error {
+	body, err := json.Marshal(message)
+	if err != nil {
+		return fmt.Errorf("erro ao serializar mensagem: %v", err)
+	}
+	return ss.RabbitCh.Publish("", processingQueue, false, false, amqp.Publishing{
+		ContentType:  "application/json",
+		DeliveryMode: amqp.Persistent,
+		Body:         body,
+	})
+}
+
+// Publicar o job e o evento queued com a sequência reservada
+func (ss *StorageService) enqueueReprocess(message ProcessingMessage) error {
+	if err := ss.publishJob(message); err != nil {
+		return err
+	}
+
+	now := time.Now()
+	event, err := json.Marshal(JobEvent{
+		Event:       "queued",
+		VideoID:     message.VideoID,
+		JobType:     "frames",
+		UserID:      message.UserID,
+		Sequence:    message.Sequence,
+		Timestamp:   now,
+		Filename:    message.Filename,
+		Object:      message.ObjectName,
+		ContentHash: message.ContentHash,
+	})
+	if err != nil {
+		log.Printf("Erro ao serializar evento queued do vídeo %s: %v", message.VideoID, err)
+		return nil
+	}
+	if err := ss.RabbitCh.Publish(eventsExchange, "video.frames.queued", false, false, amqp.Publishing{
+		ContentType:  "application/json",
+		DeliveryMode: amqp.Persistent,
+		Timestamp:    now,
+		Body:         event,
+	}); err != nil {
+		log.Printf("Erro ao publicar evento queued do vídeo %s: %v", message.VideoID, err)
+	}
+	return nil
+}
+
+// Histórico de execuções do vídeo com as opções usadas em cada uma
+func (ss *StorageService) ListVersionsHandler(w http.ResponseWriter, r *http.Request) {
+	videoID := mux.Vars(r)["id"]
+
+	// Usuário verificado pelo middleware de autenticação
+	userID, err := requestUserID(r)
+	if err != nil {
+		http.Error(w, "Token de autenticação inválido", http.StatusUnauthorized)
+		return
+	}
+
+	video := ss.ownedVideo(w, r, videoID, userID)
+	if video == nil {
+		return
+	}
+	video.ensureVersions()
+	versions := video.Versions
+	current := video.CurrentVersion
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"video_id":        videoID,
+		"current_version": current,
+		"versions":        versions,
+	})
+}
@@ -0,0 +1,403 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/streadway/amqp"
+)
+
+// Vídeos examinados por página em cada passada do janitor
+const retentionPageSize = 100
+
+// Por quanto tempo cada tipo de artefato é mantido depois do último
+// processamento concluído; 0 mantém para sempre. Warning é a antecedência do
+// aviso enviado antes da expiração dos frames (0 desativa o aviso)
+type RetentionPolicy struct {
+	// Original enviado (video-uploads)
+	Original time.Duration
+	// ZIPs de frames, listas de shots e frames em cache; ao expirarem o vídeo
+	// passa para expired
+	Frames time.Duration
+	// Rendições MP4 e HLS
+	Renditions time.Duration
+	Warning    time.Duration
+}
+
+// Política padrão, exceções por usuário e intervalo entre as passadas
+type RetentionConfig struct {
+	Default  RetentionPolicy
+	Users    map[int]RetentionPolicy
+	Interval time.Duration
+}
+
+func (c RetentionConfig) policyFor(userID int) RetentionPolicy {
+	if policy, ok := c.Users[userID]; ok {
+		return policy
+	}
+	return c.Default
+}
+
+// Menor idade, entre todas as políticas, em que algum vídeo pode ter
+// artefatos removidos ou receber o aviso; false quando nada expira
+func (c RetentionConfig) earliest() (time.Duration, bool) {
+	var earliest time.Duration
+	found := false
+	consider := func(policy RetentionPolicy) {
+		// O aviso dos frames sai Warning antes da expiração
+		for _, age := range []struct{ retention, notice time.Duration }{
+			{policy.Original, 0},
+			{policy.Frames, policy.Warning},
+			{policy.Renditions, 0},
+		} {
+			if age.retention <= 0 {
+				continue
+			}
+			if !found || age.retention-age.notice < earliest {
+				earliest, found = age.retention-age.notice, true
+			}
+		}
+	}
+	consider(c.Default)
+	for _, policy := range c.Users {
+		consider(policy)
+	}
+	return max(earliest, 0), found
+}
+
+// Configuração das variáveis RETENTION_*. Durações aceitam dias ("7d"), o
+// formato do Go ("12h") e "0" ou "never" para manter para sempre. Exceções
+// por usuário em RETENTION_USER_OVERRIDES, como JSON com o ID do usuário e os
+// campos a trocar: {"42": {"frames": "90d", "original": "never"}}
+func retentionConfigFromEnv() (RetentionConfig, error) {
+	config := RetentionConfig{Users: make(map[int]RetentionPolicy)}
+	fields := []struct {
+		env, fallback string
+		target        *time.Duration
+	}{
+		{"RETENTION_ORIGINAL", "7d", &config.Default.Original},
+		{"RETENTION_FRAMES", "30d", &config.Default.Frames},
+		{"RETENTION_RENDITIONS", "30d", &config.Default.Renditions},
+		{"RETENTION_WARNING", "3d", &config.Default.Warning},
+		{"RETENTION_INTERVAL", "1h", &config.Interval},
+	}
+	for _, field := range fields {
+		value, err := parseRetention(getEnv(field.env, field.fallback))
+		if err != nil {
+			return config, fmt.Errorf("%s inválido: %v", field.env, err)
+		}
+		*field.target = value
+	}
+	if config.Interval <= 0 {
+		config.Interval = time.Hour
+	}
+
+	raw := getEnv("RETENTION_USER_OVERRIDES", "")
+	if raw == "" {
+		return config, nil
+	}
+	var overrides map[string]struct {
+		Original   *string `json:"original"`
+		Frames     *string `json:"frames"`
+		Renditions *string `json:"renditions"`
+		Warning    *string `json:"warning"`
+	}
+	if err := json.Unmarshal([]byte(raw), &overrides); err != nil {
+		return config, fmt.Errorf("RETENTION_USER_OVERRIDES inválido: %v", err)
+	}
+	for key, override := range overrides {
+		userID, err := strconv.Atoi(key)
+		if err != nil || userID <= 0 {
+			return config, fmt.Errorf("RETENTION_USER_OVERRIDES: usuário inválido %q", key)
+		}
+		policy := config.Default
+		for _, field := range []struct {
+			value  *string
+			target *time.Duration
+		}{
+			{override.Original, &policy.Original},
+			{override.Frames, &policy.Frames},
+			{override.Renditions, &policy.Renditions},
+			{override.Warning, &policy.Warning},
+		} {
+			if field.value == nil {
+				continue
+			}
+			value, err := parseRetention(*field.value)
+			if err != nil {
+				return config, fmt.Errorf("RETENTION_USER_OVERRIDES do usuário %d: %v", userID, err)
+			}
+			*field.target = value
+		}
+		config.Users[userID] = policy
+	}
+	return config, nil
+}
+
+func parseRetention(value string) (time.Duration, error) {
+	value = strings.TrimSpace(strings.ToLower(value))
+	switch value {
+	case "", "0", "never":
+		return 0, nil
+	}
+	if days, found := strings.CutSuffix(value, "d"); found {
+		n, err := strconv.Atoi(days)
+		if err != nil || n < 0 {
+			return 0, fmt.Errorf("duração inválida %q", value)
+		}
+		return time.Duration(n) * 24 * time.Hour, nil
+	}
+	duration, err := time.ParseDuration(value)
+	if err != nil || duration < 0 {
+		return 0, fmt.Errorf("duração inválida %q", value)
+	}
+	return duration, nil
+}
+
+// O que o janitor deve fazer com um vídeo agora
+type retentionPlan struct {
+	Original   bool
+	Frames     bool
+	Renditions bool
+	// Enviar o aviso; os frames expiram em ExpiresAt
+	Warn      bool
+	ExpiresAt time.Time
+}
+
+func (p retentionPlan) empty() bool {
+	return !p.Original && !p.Frames && !p.Renditions && !p.Warn
+}
+
+// Artefatos vencidos do vídeo. Vídeos nunca concluídos ou com job em
+// andamento ficam como estão. Com aviso ativo, os frames só expiram depois
+// de Warning do aviso, mesmo que a retenção já tenha vencido
+func (p RetentionPolicy) plan(video *VideoData, now time.Time) retentionPlan {
+	var plan retentionPlan
+	if video.ProcessedAt == nil || video.Status == "queued" || video.Status == "processing" {
+		return plan
+	}
+	processedAt := *video.ProcessedAt
+	due := func(retention time.Duration) bool {
+		return retention > 0 && !now.Before(processedAt.Add(retention))
+	}
+
+	plan.Original = video.OriginalObject != "" && due(p.Original)
+	plan.Renditions = (len(video.Renditions) > 0 || video.HLSMasterObject != "") && due(p.Renditions)
+
+	if p.Frames <= 0 || video.Status == "expired" {
+		return plan
+	}
+	plan.ExpiresAt = processedAt.Add(p.Frames)
+	if p.Warning > 0 {
+		warnedAt := now
+		if video.ExpiryWarnedAt != nil {
+			warnedAt = *video.ExpiryWarnedAt
+		}
+		if notice := warnedAt.Add(p.Warning); notice.After(plan.ExpiresAt) {
+			plan.ExpiresAt = notice
+		}
+		plan.Warn = video.ExpiryWarnedAt == nil && !now.Before(plan.ExpiresAt.Add(-p.Warning))
+	}
+	plan.Frames = !now.Before(plan.ExpiresAt)
+	return plan
+}
+
+// Janitor da retenção: a cada RETENTION_INTERVAL percorre os vídeos
+// processados há mais tempo que a menor retenção configurada e remove os
+// artefatos vencidos. Várias réplicas podem rodar ao mesmo tempo: remover de
+// novo um objeto não é erro e cada alteração passa por Videos.Update
+func (ss *StorageService) StartRetentionJanitor() {
+	if _, enabled := ss.Retention.earliest(); !enabled {
+		log.Println("Retenção desativada: nenhum artefato expira")
+		return
+	}
+	ticker := time.NewTicker(ss.Retention.Interval)
+	defer ticker.Stop()
+
+	log.Printf("Janitor de retenção iniciado (política padrão %+v, %d exceções por usuário)",
+		ss.Retention.Default, len(ss.Retention.Users))
+	for {
+		ss.enforceRetention(time.Now())
+		<-ticker.C
+	}
+}
+
+func (ss *StorageService) enforceRetention(now time.Time) {
+	earliest, enabled := ss.Retention.earliest()
+	if !enabled {
+		return
+	}
+	filter := VideoFilter{
+		ProcessedBefore: now.Add(-earliest),
+		Retained:        true,
+		Ascending:       true,
+	}
+
+	var after *VideoCursor
+	for {
+		page, err := ss.Videos.ListPage(ctx, filter, after, retentionPageSize)
+		if err != nil {
+			log.Printf("Erro ao listar vídeos para a retenção: %v", err)
+			return
+		}
+		for _, video := range page.Videos {
+			plan := ss.Retention.policyFor(video.UserID).plan(video, now)
+			if plan.empty() {
+				continue
+			}
+			if err := ss.applyRetention(video, plan, now); err != nil {
+				log.Printf("Erro ao aplicar a retenção ao vídeo %s: %v", video.VideoID, err)
+			}
+		}
+		if page.Next == nil {
+			return
+		}
+		after = page.Next
+	}
+}
+
+// Remover os artefatos vencidos e registrar no vídeo. Os objetos saem antes:
+// se a remoção falhar, o vídeo continua apontando para eles e a próxima
+// passada tenta de novo
+func (ss *StorageService) applyRetention(listed *VideoData, plan retentionPlan, now time.Time) error {
+	// A listagem não traz o histórico de versões, com os ZIPs de cada uma
+	video, err := ss.Videos.Get(ctx, listed.VideoID)
+	if err != nil {
+		return err
+	}
+
+	if plan.Warn {
+		ss.warnExpiry(video, plan.ExpiresAt, now)
+	}
+
+	var targets []DeletionTarget
+	if plan.Original {
+		targets = append(targets, originalTargets(video)...)
+	}
+	if plan.Frames {
+		targets = append(targets, frameTargets(video)...)
+	}
+	if plan.Renditions {
+		targets = append(targets, renditionTargets(video)...)
+	}
+	if len(targets) == 0 {
+		return nil
+	}
+	if err := ss.removeTargets(targets); err != nil {
+		return err
+	}
+
+	return ss.Videos.Update(ctx, video.VideoID, func(current *VideoData) (*VideoData, error) {
+		// Reprocessado enquanto os objetos eram removidos: a próxima passada
+		// avalia a versão nova
+		if current == nil || !sameTime(current.ProcessedAt, video.ProcessedAt) {
+			return nil, nil
+		}
+		if plan.Original {
+			current.OriginalObject = ""
+			current.OriginalExpiredAt = &now
+			log.Printf("Original do vídeo %s expirou e foi removido", video.VideoID)
+		}
+		if plan.Frames {
+			current.expireFrames(now)
+			log.Printf("Frames do vídeo %s expiraram e foram removidos", video.VideoID)
+		}
+		if plan.Renditions {
+			current.Renditions = nil
+			current.HLSMasterObject = ""
+			log.Printf("Rendições do vídeo %s expiraram e foram removidas", video.VideoID)
+		}
+		return current, nil
+	})
+}
+
+// Marcar o vídeo como expirado: ZIPs e shots de todas as versões removidos
+func (v *VideoData) expireFrames(now time.Time) {
+	v.Status = "expired"
+	v.ExpiredAt = &now
+	v.ZipObjectName = ""
+	v.ShotsObject = ""
+	v.ShotsCSVObject = ""
+	for i := range v.Versions {
+		if v.Versions[i].Status == "completed" {
+			v.Versions[i].Pruned = true
+		}
+	}
+}
+
+// Ainda há artefatos do vídeo no MinIO (candidato da retenção)
+func (v *VideoData) retainsArtifacts() bool {
+	return v.OriginalObject != "" || v.Status != "expired" || len(v.Renditions) > 0 || v.HLSMasterObject != ""
+}
+
+func sameTime(a, b *time.Time) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return a.Equal(*b)
+}
+
+// Publicar o aviso de expiração para o notification-service. O aviso é
+// reservado no vídeo antes da publicação, para que réplicas concorrentes não
+// enviem dois e-mails; se a publicação falhar, a reserva é desfeita
+func (ss *StorageService) warnExpiry(video *VideoData, expiresAt, now time.Time) {
+	claimed := false
+	err := ss.Videos.Update(ctx, video.VideoID, func(current *VideoData) (*VideoData, error) {
+		if current == nil || current.ExpiryWarnedAt != nil || !sameTime(current.ProcessedAt, video.ProcessedAt) {
+			return nil, nil
+		}
+		current.ExpiryWarnedAt = &now
+		claimed = true
+		return current, nil
+	})
+	if err != nil || !claimed {
+		if err != nil {
+			log.Printf("Erro ao registrar aviso de expiração do vídeo %s: %v", video.VideoID, err)
+		}
+		return
+	}
+
+	event := JobEvent{
+		Event:     "expiring",
+		VideoID:   video.VideoID,
+		JobType:   "retention",
+		UserID:    strconv.Itoa(video.UserID),
+		Timestamp: now,
+		Filename:  video.Title,
+		UserEmail: video.UserEmail,
+		UserName:  video.UserName,
+		ExpiresAt: &expiresAt,
+	}
+	if err := ss.publishEvent(event); err != nil {
+		log.Printf("Erro ao publicar aviso de expiração do vídeo %s: %v", video.VideoID, err)
+		err := ss.Videos.Update(ctx, video.VideoID, func(current *VideoData) (*VideoData, error) {
+			if current == nil {
+				return nil, nil
+			}
+			current.ExpiryWarnedAt = nil
+			return current, nil
+		})
+		if err != nil {
+			log.Printf("Erro ao desfazer aviso de expiração do vídeo %s: %v", video.VideoID, err)
+		}
+		return
+	}
+	log.Printf("Aviso de expiração do vídeo %s enviado (expira em %s)", video.VideoID, expiresAt.Format(time.RFC3339))
+}
+
+func (ss *StorageService) publishEvent(event JobEvent) error {
+	body, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	return ss.RabbitCh.Publish(eventsExchange, fmt.Sprintf("video.%s.%s", event.JobType, event.Event), false, false, amqp.Publishing{
+		ContentType:  "application/json",
+		DeliveryMode: amqp.Persistent,
+		Timestamp:    event.Timestamp,
+		Body:         body,
+	})
+}
@@ -0,0 +1,220 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const day = 24 * time.Hour
+
+func TestParseRetention(t *testing.T) {
+	cases := map[string]time.Duration{
+		"7d":    7 * day,
+		"12h":   12 * time.Hour,
+		"90m":   90 * time.Minute,
+		"0":     0,
+		"never": 0,
+		"":      0,
+	}
+	for value, want := range cases {
+		got, err := parseRetention(value)
+		require.NoError(t, err, value)
+		assert.Equal(t, want, got, value)
+	}
+	for _, value := range []string{"-1d", "xd", "7 dias", "-2h"} {
+		_, err := parseRetention(value)
+		assert.Error(t, err, value)
+	}
+}
+
+func TestRetentionConfigFromEnv(t *testing.T) {
+	t.Setenv("RETENTION_ORIGINAL", "")
+	t.Setenv("RETENTION_FRAMES", "10d")
+	t.Setenv("RETENTION_USER_OVERRIDES", `{"42": {"frames": "90d", "original": "never"}, "7": {"warning": "0"}}`)
+	config, err := retentionConfigFromEnv()
+	require.NoError(t, err)
+
+	assert.Equal(t, RetentionPolicy{Original: 7 * day, Frames: 10 * day, Renditions: 30 * day, Warning: 3 * day}, config.Default)
+	assert.Equal(t, time.Hour, config.Interval)
+	assert.Equal(t, RetentionPolicy{Original: 0, Frames: 90 * day, Renditions: 30 * day, Warning: 3 * day}, config.policyFor(42))
+	assert.Equal(t, RetentionPolicy{Original: 7 * day, Frames: 10 * day, Renditions: 30 * day}, config.policyFor(7))
+	assert.Equal(t, config.Default, config.policyFor(1))
+
+	earliest, enabled := config.earliest()
+	assert.True(t, enabled)
+	assert.Equal(t, 7*day, earliest, "o aviso dos frames sai aos 7 dias, junto com o original")
+
+	for _, overrides := range []string{`{"abc": {}}`, `{"42": {"frames": "sempre"}}`, `[1]`} {
+		t.Setenv("RETENTION_USER_OVERRIDES", overrides)
+		_, err := retentionConfigFromEnv()
+		assert.Error(t, err, overrides)
+	}
+
+	disabled := RetentionConfig{Default: RetentionPolicy{Warning: day}}
+	_, enabled = disabled.earliest()
+	assert.False(t, enabled)
+}
+
+func TestRetentionPlan(t *testing.T) {
+	policy := RetentionPolicy{Original: 7 * day, Frames: 30 * day, Renditions: 30 * day, Warning: 3 * day}
+	processedAt := baseTime
+	newVideo := func() *VideoData {
+		return &VideoData{
+			VideoID:         "video_1",
+			Status:          "completed",
+			OriginalObject:  "video_1.mp4",
+			ZipObjectName:   "frames_video_1.zip",
+			Renditions:      []string{"720p"},
+			HLSMasterObject: "hls/video_1/master.m3u8",
+			ProcessedAt:     &processedAt,
+		}
+	}
+
+	t.Run("nada vence antes do prazo", func(t *testing.T) {
+		assert.True(t, policy.plan(newVideo(), baseTime.Add(6*day)).empty())
+	})
+
+	t.Run("original vence 7 dias depois do processamento", func(t *testing.T) {
+		plan := policy.plan(newVideo(), baseTime.Add(7*day))
+		assert.True(t, plan.Original)
+		assert.False(t, plan.Frames)
+		assert.False(t, plan.Warn)
+
+		video := newVideo()
+		video.OriginalObject = ""
+		assert.False(t, policy.plan(video, baseTime.Add(8*day)).Original, "original já removido")
+	})
+
+	t.Run("aviso sai antes da expiração dos frames", func(t *testing.T) {
+		video := newVideo()
+		video.OriginalObject = ""
+		plan := policy.plan(video, baseTime.Add(27*day))
+		assert.True(t, plan.Warn)
+		assert.False(t, plan.Frames)
+		assert.Equal(t, baseTime.Add(30*day), plan.ExpiresAt)
+
+		warnedAt := baseTime.Add(27 * day)
+		video.ExpiryWarnedAt = &warnedAt
+		assert.True(t, policy.plan(video, baseTime.Add(29*day)).empty(), "aviso não se repete")
+
+		plan = policy.plan(video, baseTime.Add(30*day))
+		assert.True(t, plan.Frames)
+		assert.True(t, plan.Renditions)
+		assert.False(t, plan.Warn)
+	})
+
+	t.Run("frames vencidos sem aviso esperam a antecedência do aviso", func(t *testing.T) {
+		video := newVideo()
+		now := baseTime.Add(40 * day)
+		plan := policy.plan(video, now)
+		assert.True(t, plan.Warn)
+		assert.False(t, plan.Frames)
+		assert.Equal(t, now.Add(3*day), plan.ExpiresAt)
+
+		video.ExpiryWarnedAt = &now
+		assert.False(t, policy.plan(video, now.Add(2*day)).Frames)
+		assert.True(t, policy.plan(video, now.Add(3*day)).Frames)
+	})
+
+	t.Run("sem aviso os frames vencem no prazo", func(t *testing.T) {
+		noWarning := policy
+		noWarning.Warning = 0
+		plan := noWarning.plan(newVideo(), baseTime.Add(30*day))
+		assert.True(t, plan.Frames)
+		assert.False(t, plan.Warn)
+	})
+
+	t.Run("vídeos em processamento, nunca concluídos ou já expirados", func(t *testing.T) {
+		video := newVideo()
+		video.Status = "processing"
+		assert.True(t, policy.plan(video, baseTime.Add(60*day)).empty(), "reprocessamento em andamento")
+
+		video = newVideo()
+		video.ProcessedAt = nil
+		assert.True(t, policy.plan(video, baseTime.Add(60*day)).empty())
+
+		video = newVideo()
+		video.Status = "expired"
+		video.OriginalObject = ""
+		video.Renditions, video.HLSMasterObject = nil, ""
+		assert.True(t, policy.plan(video, baseTime.Add(60*day)).empty())
+		assert.False(t, video.retainsArtifacts())
+	})
+
+	t.Run("retenção 0 mantém para sempre", func(t *testing.T) {
+		assert.True(t, RetentionPolicy{}.plan(newVideo(), baseTime.Add(3650*day)).empty())
+	})
+}
+
+func TestEnforceRetention(t *testing.T) {
+	store, ss := newFakeObjectStore(t)
+	ss.Videos = newMemoryVideoRepository()
+	ss.Retention = RetentionConfig{
+		Default: RetentionPolicy{Original: 7 * day, Frames: 30 * day},
+		Users:   map[int]RetentionPolicy{8: {Original: 7 * day, Frames: 90 * day}},
+	}
+
+	processedAt := baseTime
+	expired := &VideoData{
+		VideoID:        "video_1",
+		Title:          "ferias.mp4",
+		Status:         "completed",
+		UploadedAt:     baseTime,
+		UserID:         7,
+		OriginalObject: "video_1.mp4",
+		ZipObjectName:  "frames_video_1_v2.zip",
+		Renditions:     []string{"720p"},
+		ProcessedAt:    &processedAt,
+		Versions: []VideoVersion{
+			{Version: 1, Status: "completed", ZipObjectName: "frames_video_1.zip"},
+			{Version: 2, Status: "completed", ZipObjectName: "frames_video_1_v2.zip"},
+		},
+	}
+	kept := cloneVideo(expired)
+	kept.VideoID, kept.UserID = "video_2", 8
+	kept.OriginalObject, kept.ZipObjectName = "video_2.mp4", "frames_video_2.zip"
+	kept.Versions = nil
+	recent := cloneVideo(kept)
+	recent.VideoID, recent.UserID = "video_3", 7
+	recent.OriginalObject, recent.ZipObjectName = "video_3.mp4", "frames_video_3.zip"
+	recentAt := baseTime.Add(25 * day)
+	recent.ProcessedAt = &recentAt
+	for _, video := range []*VideoData{expired, kept, recent} {
+		require.NoError(t, ss.Videos.Create(context.Background(), video))
+	}
+
+	now := baseTime.Add(31 * day)
+	ss.enforceRetention(now)
+
+	video, err := ss.Videos.Get(context.Background(), "video_1")
+	require.NoError(t, err)
+	assert.Equal(t, "expired", video.Status)
+	assert.Equal(t, &now, video.ExpiredAt)
+	assert.Equal(t, &now, video.OriginalExpiredAt)
+	assert.Empty(t, video.OriginalObject)
+	assert.Empty(t, video.ZipObjectName)
+	assert.Equal(t, []string{"720p"}, video.Renditions, "rendições sem prazo configurado")
+	for _, version := range video.Versions {
+		assert.True(t, version.Pruned, "versão %d", version.Version)
+	}
+	assert.Contains(t, store.deleted, "video-uploads/video_1.mp4")
+	assert.Contains(t, store.deleted, "video-processed/frames_video_1.zip")
+	assert.Contains(t, store.deleted, "video-processed/frames_video_1_v2.zip")
+
+	// Exceção do usuário 8: só o original vence
+	video, err = ss.Videos.Get(context.Background(), "video_2")
+	require.NoError(t, err)
+	assert.Equal(t, "completed", video.Status)
+	assert.Empty(t, video.OriginalObject)
+	assert.Equal(t, "frames_video_2.zip", video.ZipObjectName)
+	assert.NotContains(t, store.deleted, "video-processed/frames_video_2.zip")
+
+	video, err = ss.Videos.Get(context.Background(), "video_3")
+	require.NoError(t, err)
+	assert.Equal(t, "video_3.mp4", video.OriginalObject, "processado há 6 dias")
+	assert.NotContains(t, store.deleted, "video-uploads/video_3.mp4")
+}
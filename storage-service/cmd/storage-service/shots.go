@@ -0,0 +1,55 @@
+package main
+
+import (
+	"context"
+	"io"
+	"log"
+	"net/http"
+
+	"github.com/gorilla/mux"
+	"github.com/minio/minio-go/v7"
+)
+
+// Lista de shots da detecção de cenas do vídeo; ?format=csv devolve o CSV
+func (ss *StorageService) GetShotsHandler(w http.ResponseWriter, r *http.Request) {
+	videoID := mux.Vars(r)["id"]
+
+	userID, err := requestUserID(r)
+	if err != nil {
+		http.Error(w, "Token de autenticação inválido", http.StatusUnauthorized)
+		return
+	}
+
+	video := ss.ownedVideo(w, r, videoID, userID)
+	if video == nil {
+		return
+	}
+	objectName, contentType := video.ShotsObject, "application/json"
+	if r.URL.Query().Get("format") == "csv" {
+		objectName, contentType = video.ShotsCSVObject, "text/csv; charset=utf-8"
+	}
+
+	if objectName == "" {
+		http.Error(w, "Detecção de cenas não executada para este vídeo", http.StatusNotFound)
+		return
+	}
+
+	object, err := ss.MinioClient.GetObject(context.Background(), "video-processed", objectName, minio.GetObjectOptions{})
+	if err != nil {
+		log.Printf("Erro ao obter shots do MinIO: %v", err)
+		http.Error(w, "Erro ao obter lista de shots", http.StatusInternalServerError)
+		return
+	}
+	defer object.Close()
+
+	if _, err := object.Stat(); err != nil {
+		log.Printf("Erro ao obter informações de %s: %v", objectName, err)
+		http.Error(w, "Erro ao obter lista de shots", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", contentType)
+	if _, err := io.Copy(w, object); err != nil {
+		log.Printf("Erro ao copiar lista de shots: %v", err)
+	}
+}
@@ -0,0 +1,360 @@
+package main
+
+import (
+	"archive/zip"
+	"compress/flate"
+	"container/list"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"log"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/minio/minio-go/v7"
+)
+
+// Leitura antecipada enquanto o central directory é carregado: o
+// archive/zip lê o diretório em pedaços de 4 KB, que virariam um GET cada
+const zipIndexReadAhead = 1 << 20
+
+// Tempo máximo de cada leitura ranged no MinIO
+const zipRangeTimeout = time.Minute
+
+var errZipEntryCorrupted = errors.New("entrada do ZIP corrompida")
+
+// io.ReaderAt sobre um objeto do MinIO: cada leitura é um GET com Range
+// limitado ao trecho pedido, travado no ETag consultado para não misturar
+// versões se o objeto for regravado
+type objectRangeReader struct {
+	client *minio.Client
+	bucket string
+	object string
+	etag   string
+	size   int64
+
+	mu        sync.Mutex
+	readAhead int
+	buf       []byte
+	bufOffset int64
+}
+
+func (r *objectRangeReader) ReadAt(p []byte, off int64) (int, error) {
+	if off >= r.size {
+		return 0, io.EOF
+	}
+	want := min(int64(len(p)), r.size-off)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if off < r.bufOffset || off+want > r.bufOffset+int64(len(r.buf)) {
+		length := max(want, min(int64(r.readAhead), r.size-off))
+		data, err := r.fetch(off, length)
+		if err != nil {
+			return 0, err
+		}
+		if r.readAhead == 0 {
+			return copy(p, data), eofIfShort(len(p), want)
+		}
+		r.buf, r.bufOffset = data, off
+	}
+	n := copy(p, r.buf[off-r.bufOffset:off-r.bufOffset+want])
+	return n, eofIfShort(len(p), want)
+}
+
+func eofIfShort(asked int, got int64) error {
+	if int64(asked) > got {
+		return io.EOF
+	}
+	return nil
+}
+
+func (r *objectRangeReader) fetch(off, length int64) ([]byte, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), zipRangeTimeout)
+	defer cancel()
+
+	body, err := r.openRange(ctx, off, length)
+	if err != nil {
+		return nil, err
+	}
+	defer body.Close()
+
+	data := make([]byte, length)
+	if _, err := io.ReadFull(body, data); err != nil {
+		return nil, fmt.Errorf("erro ao ler %s/%s [%d+%d]: %v", r.bucket, r.object, off, length, err)
+	}
+	return data, nil
+}
+
+// Stream de [off, off+length) do objeto
+func (r *objectRangeReader) openRange(ctx context.Context, off, length int64) (io.ReadCloser, error) {
+	opts := minio.GetObjectOptions{}
+	if err := opts.SetRange(off, off+length-1); err != nil {
+		return nil, err
+	}
+	if err := opts.SetMatchETag(r.etag); err != nil {
+		return nil, err
+	}
+	return r.client.GetObject(ctx, r.bucket, r.object, opts)
+}
+
+// Central directory de um ZIP no MinIO
+type zipIndex struct {
+	key    string
+	etag   string
+	reader *objectRangeReader
+	files  map[string]*zip.File
+	// Entradas na ordem do ZIP
+	ordered []*zip.File
+}
+
+// Índices mais recentes por objeto (bucket/objeto), até ZIP_INDEX_CACHE_SIZE;
+// um ETag diferente do guardado descarta o índice
+type zipIndexCache struct {
+	mu      sync.Mutex
+	max     int
+	order   *list.List // mais recente na frente
+	entries map[string]*list.Element
+}
+
+func newZipIndexCache(size int) *zipIndexCache {
+	if size < 1 {
+		size = 1
+	}
+	return &zipIndexCache{max: size, order: list.New(), entries: make(map[string]*list.Element)}
+}
+
+func (c *zipIndexCache) get(key, etag string) *zipIndex {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	element, ok := c.entries[key]
+	if !ok {
+		return nil
+	}
+	index := element.Value.(*zipIndex)
+	if index.etag != etag {
+		c.order.Remove(element)
+		delete(c.entries, key)
+		return nil
+	}
+	c.order.MoveToFront(element)
+	return index
+}
+
+func (c *zipIndexCache) put(index *zipIndex) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if element, ok := c.entries[index.key]; ok {
+		c.order.Remove(element)
+	}
+	c.entries[index.key] = c.order.PushFront(index)
+	for c.order.Len() > c.max {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.entries, oldest.Value.(*zipIndex).key)
+	}
+}
+
+// Índice do ZIP, do cache ou lido do MinIO com leituras ranged (o fim do
+// arquivo e o central directory)
+func (ss *StorageService) openZipIndex(ctx context.Context, bucket, object string) (*zipIndex, error) {
+	info, err := ss.MinioClient.StatObject(ctx, bucket, object, minio.StatObjectOptions{})
+	if err != nil {
+		return nil, err
+	}
+	key := bucket + "/" + object
+	if index := ss.ZipIndexes.get(key, info.ETag); index != nil {
+		return index, nil
+	}
+
+	reader := &objectRangeReader{
+		client:    ss.MinioClient,
+		bucket:    bucket,
+		object:    object,
+		etag:      info.ETag,
+		size:      info.Size,
+		readAhead: zipIndexReadAhead,
+	}
+	archive, err := zip.NewReader(reader, info.Size)
+	if err != nil {
+		return nil, fmt.Errorf("erro ao ler central directory de %s: %v", key, err)
+	}
+	// Daqui em diante só cabeçalhos locais pequenos: sem leitura antecipada
+	reader.mu.Lock()
+	reader.readAhead, reader.buf = 0, nil
+	reader.mu.Unlock()
+
+	index := &zipIndex{key: key, etag: info.ETag, reader: reader, files: make(map[string]*zip.File)}
+	for _, file := range archive.File {
+		index.files[file.Name] = file
+		index.ordered = append(index.ordered, file)
+	}
+	ss.ZipIndexes.put(index)
+	return index, nil
+}
+
+// Enviar o conteúdo descompactado de uma entrada: um GET ranged só com os
+// dados comprimidos dela, conferidos pelo CRC-32
+func (ss *StorageService) writeZipEntry(ctx context.Context, w io.Writer, index *zipIndex, file *zip.File) error {
+	offset, err := file.DataOffset()
+	if err != nil {
+		return err
+	}
+	if file.CompressedSize64 == 0 {
+		return nil
+	}
+
+	body, err := index.reader.openRange(ctx, offset, int64(file.CompressedSize64))
+	if err != nil {
+		return err
+	}
+	defer body.Close()
+
+	var content io.Reader
+	switch file.Method {
+	case zip.Store:
+		content = body
+	case zip.Deflate:
+		inflater := flate.NewReader(body)
+		defer inflater.Close()
+		content = inflater
+	default:
+		return fmt.Errorf("método de compressão %d não suportado", file.Method)
+	}
+
+	hash := crc32.NewIEEE()
+	n, err := io.Copy(io.MultiWriter(w, hash), io.LimitReader(content, int64(file.UncompressedSize64)))
+	if err != nil {
+		return err
+	}
+	if uint64(n) != file.UncompressedSize64 || hash.Sum32() != file.CRC32 {
+		return errZipEntryCorrupted
+	}
+	return nil
+}
+
+// Entradas de imagem do ZIP (frame_0001.png, ...); legendas, capítulos e
+// manifestos ficam de fora
+func isFrameEntry(name string) bool {
+	if strings.Contains(name, "/") {
+		return false
+	}
+	switch strings.ToLower(path.Ext(name)) {
+	case ".png", ".jpg", ".jpeg":
+		return true
+	}
+	return false
+}
+
+func frameContentType(name string) string {
+	if strings.EqualFold(path.Ext(name), ".png") {
+		return "image/png"
+	}
+	return "image/jpeg"
+}
+
+// Índice do ZIP servido para o vídeo; nil quando a resposta de erro já foi
+// enviada
+func (ss *StorageService) requestZipIndex(w http.ResponseWriter, r *http.Request) *zipIndex {
+	// Usuário verificado pelo middleware de autenticação
+	userID, err := requestUserID(r)
+	if err != nil {
+		http.Error(w, "Token de autenticação inválido", http.StatusUnauthorized)
+		return nil
+	}
+
+	videoID := mux.Vars(r)["id"]
+	video := ss.ownedVideo(w, r, videoID, userID)
+	if video == nil {
+		return nil
+	}
+	zipObjectName := servedZipObject(w, r, video)
+	if zipObjectName == "" {
+		return nil
+	}
+
+	index, err := ss.openZipIndex(r.Context(), "video-processed", zipObjectName)
+	if err != nil {
+		if minio.ToErrorResponse(err).Code == "NoSuchKey" {
+			http.Error(w, "Arquivo não encontrado", http.StatusNotFound)
+			return nil
+		}
+		log.Printf("Erro ao abrir ZIP do vídeo %s: %v", videoID, err)
+		http.Error(w, "Erro ao ler frames", http.StatusInternalServerError)
+		return nil
+	}
+	return index
+}
+
+// Listar os frames do ZIP sem baixá-lo
+func (ss *StorageService) ListFramesHandler(w http.ResponseWriter, r *http.Request) {
+	index := ss.requestZipIndex(w, r)
+	if index == nil {
+		return
+	}
+
+	frames := []map[string]interface{}{}
+	for _, file := range index.ordered {
+		if !isFrameEntry(file.Name) {
+			continue
+		}
+		frames = append(frames, map[string]interface{}{
+			"name":            file.Name,
+			"size":            file.UncompressedSize64,
+			"compressed_size": file.CompressedSize64,
+			"modified":        file.Modified.UTC().Format(time.RFC3339),
+		})
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"video_id": mux.Vars(r)["id"],
+		"frames":   frames,
+		"total":    len(frames),
+	})
+}
+
+// Baixar um frame do ZIP lendo só a entrada pedida
+func (ss *StorageService) GetZipFrameHandler(w http.ResponseWriter, r *http.Request) {
+	index := ss.requestZipIndex(w, r)
+	if index == nil {
+		return
+	}
+
+	name := mux.Vars(r)["name"]
+	file := index.files[name]
+	if file == nil || !isFrameEntry(name) {
+		http.Error(w, "Frame não encontrado", http.StatusNotFound)
+		return
+	}
+
+	// O conteúdo de uma entrada não muda enquanto o ZIP for o mesmo
+	etag := fmt.Sprintf(`"%s-%08x"`, index.etag, file.CRC32)
+	w.Header().Set("ETag", etag)
+	w.Header().Set("Cache-Control", "private, max-age=3600")
+	if r.Header.Get("If-None-Match") == etag {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	w.Header().Set("Content-Type", frameContentType(name))
+	w.Header().Set("Content-Length", strconv.FormatUint(file.UncompressedSize64, 10))
+	if r.Method == http.MethodHead {
+		return
+	}
+	if err := ss.writeZipEntry(r.Context(), w, index, file); err != nil {
+		// Cabeçalhos já enviados: só registrar
+		log.Printf("Erro ao enviar %s de %s: %v", name, index.key, err)
+	}
+}
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"fmt"
+	"math/rand"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// ZIP como o do processing-service: frames PNG comprimidos e extras
+func buildFramesZip(t *testing.T, frames int) ([]byte, map[string][]byte) {
+	t.Helper()
+	random := rand.New(rand.NewSource(1))
+	contents := make(map[string][]byte)
+
+	var archive bytes.Buffer
+	writer := zip.NewWriter(&archive)
+	add := func(name string, method uint16, content []byte) {
+		entry, err := writer.CreateHeader(&zip.FileHeader{Name: name, Method: method})
+		require.NoError(t, err)
+		_, err = entry.Write(content)
+		require.NoError(t, err)
+		contents[name] = content
+	}
+	for i := 1; i <= frames; i++ {
+		content := make([]byte, 8*1024)
+		random.Read(content)
+		add(fmt.Sprintf("frame_%04d.png", i), zip.Deflate, content)
+	}
+	add("subtitles/pt.vtt", zip.Deflate, []byte("WEBVTT\n"))
+	add("chapters.json", zip.Store, []byte(`{"chapters":[]}`))
+	require.NoError(t, writer.Close())
+	return archive.Bytes(), contents
+}
+
+// Bytes pedidos em cada GET ("GET bytes=a-b")
+func rangeLengths(t *testing.T, gets []string) []int64 {
+	var lengths []int64
+	for _, get := range gets {
+		start, end, found := strings.Cut(strings.TrimPrefix(get, "GET bytes="), "-")
+		require.True(t, found, "GET sem Range: %s", get)
+		first, err := strconv.ParseInt(start, 10, 64)
+		require.NoError(t, err)
+		last, err := strconv.ParseInt(end, 10, 64)
+		require.NoError(t, err, "Range aberto: %s", get)
+		lengths = append(lengths, last-first+1)
+	}
+	return lengths
+}
+
+func TestZipIndex(t *testing.T) {
+	const object = "frames_video_1.zip"
+	store, ss := newFakeObjectStore(t)
+	archive, contents := buildFramesZip(t, 200)
+	store.content = archive
+	ss.ZipIndexes = newZipIndexCache(4)
+
+	index, err := ss.openZipIndex(context.Background(), "video-processed", object)
+	require.NoError(t, err)
+	assert.Len(t, index.files, 202)
+	assert.Equal(t, "frame_0001.png", index.ordered[0].Name)
+
+	// Só o fim do arquivo e o central directory foram lidos
+	var read int64
+	for _, length := range rangeLengths(t, store.gets()) {
+		read += length
+	}
+	assert.Less(t, read, int64(len(archive))/10, "índice leu %d de %d bytes", read, len(archive))
+	assert.LessOrEqual(t, len(store.gets()), 3, "central directory lido em poucos GETs: %v", store.gets())
+
+	t.Run("índice vem do cache enquanto o ETag não muda", func(t *testing.T) {
+		before := len(store.gets())
+		cached, err := ss.openZipIndex(context.Background(), "video-processed", object)
+		require.NoError(t, err)
+		assert.Same(t, index, cached)
+		assert.Len(t, store.gets(), before)
+	})
+
+	t.Run("entradas são lidas só com o trecho comprimido delas", func(t *testing.T) {
+		for _, name := range []string{"frame_0150.png", "chapters.json"} {
+			before := len(store.gets())
+			var out bytes.Buffer
+			require.NoError(t, ss.writeZipEntry(context.Background(), &out, index, index.files[name]))
+			assert.Equal(t, contents[name], out.Bytes(), name)
+			for _, length := range rangeLengths(t, store.gets()[before:]) {
+				assert.LessOrEqual(t, length, int64(index.files[name].CompressedSize64)+64, name)
+			}
+		}
+	})
+
+	t.Run("ETag novo descarta o índice", func(t *testing.T) {
+		store.etag = "def456"
+		reloaded, err := ss.openZipIndex(context.Background(), "video-processed", object)
+		require.NoError(t, err)
+		assert.NotSame(t, index, reloaded)
+		assert.Equal(t, "def456", reloaded.etag)
+	})
+}
+
+func TestZipIndexCacheEviction(t *testing.T) {
+	cache := newZipIndexCache(2)
+	cache.put(&zipIndex{key: "a", etag: "1"})
+	cache.put(&zipIndex{key: "b", etag: "1"})
+	require.NotNil(t, cache.get("a", "1"))
+	cache.put(&zipIndex{key: "c", etag: "1"})
+
+	assert.Nil(t, cache.get("b", "1"), "menos usado recentemente sai primeiro")
+	assert.NotNil(t, cache.get("a", "1"))
+	assert.NotNil(t, cache.get("c", "1"))
+	assert.Nil(t, cache.get("a", "2"))
+	assert.Nil(t, cache.get("a", "1"), "ETag diferente remove a entrada")
+}
+
+func TestIsFrameEntry(t *testing.T) {
+	assert.True(t, isFrameEntry("frame_0001.png"))
+	assert.True(t, isFrameEntry("frame_0001.JPG"))
+	assert.False(t, isFrameEntry("chapters.json"))
+	assert.False(t, isFrameEntry("subtitles/pt.vtt"))
+	assert.False(t, isFrameEntry("../frame_0001.png"))
+}
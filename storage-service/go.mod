@@ -5,8 +5,9 @@ go 1.22
 toolchain go1.22.2
 
 require (
-	github.com/golang-jwt/jwt/v5 v5.2.0
+	github.com/fiap/projeto-fiapx/shared v0.0.0
 	github.com/gorilla/mux v1.8.0
+	github.com/lib/pq v1.10.9
 	github.com/minio/minio-go/v7 v7.0.45
 	github.com/prometheus/client_golang v1.22.0
 	github.com/rs/cors v1.10.1
@@ -19,6 +20,7 @@ require (
 	github.com/cespare/xxhash/v2 v2.3.0 // indirect
 	github.com/davecgh/go-spew v1.1.1 // indirect
 	github.com/dustin/go-humanize v1.0.0 // indirect
+	github.com/golang-jwt/jwt/v5 v5.2.0 // indirect
 	github.com/google/uuid v1.3.1 // indirect
 	github.com/json-iterator/go v1.1.12 // indirect
 	github.com/klauspost/compress v1.18.0 // indirect
@@ -43,3 +45,5 @@ require (
 	gopkg.in/ini.v1 v1.66.6 // indirect
 	gopkg.in/yaml.v3 v3.0.1 // indirect
 )
+
+replace github.com/fiap/projeto-fiapx/shared => ../shared
@@ -0,0 +1,237 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"mime/multipart"
+	"net/http"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"github.com/minio/minio-go/v7"
+
+	"github.com/fiap/projeto-fiapx/shared/media"
+)
+
+// Resposta do upload em lote
+type BatchUploadResponse struct {
+	BatchID    string           `json:"batch_id"`
+	Status     string           `json:"status"`
+	Videos     []UploadResponse `json:"videos"`
+	UploadedAt time.Time        `json:"uploaded_at"`
+}
+
+// Vídeo do lote já validado, aguardando envio ao MinIO
+type batchFile struct {
+	videoID  string
+	header   *multipart.FileHeader
+	duration float64
+}
+
+// Quantidade máxima de vídeos por lote (MAX_BATCH_VIDEOS)
+func maxBatchVideos() int {
+	n, err := strconv.Atoi(getEnv("MAX_BATCH_VIDEOS", "20"))
+	if err != nil || n < 1 {
+		return 20
+	}
+	return n
+}
+
+func generateBatchID() string {
+	return fmt.Sprintf("batch_%d", time.Now().UnixNano())
+}
+
+// Upload de vários vídeos (campo "videos" repetido) agrupados em um lote. Cada
+// vídeo é processado como um upload avulso com as mesmas opções; quando todos
+// terminam, o storage-service enfileira o ZIP combinado do lote
+func (us *UploadService) BatchUploadHandler(w http.ResponseWriter, r *http.Request) {
+	userID, err := requestUserID(r)
+	if err != nil {
+		http.Error(w, "Token de autenticação inválido", http.StatusUnauthorized)
+		return
+	}
+
+	if err := r.ParseMultipartForm(100 << 20); err != nil {
+		log.Printf("Erro ao processar formulário do lote: %v", err)
+		http.Error(w, "Erro ao processar formulário", http.StatusBadRequest)
+		return
+	}
+	defer r.MultipartForm.RemoveAll()
+
+	headers := r.MultipartForm.File["videos"]
+	if len(headers) == 0 {
+		http.Error(w, "Envie os vídeos do lote no campo 'videos'", http.StatusBadRequest)
+		return
+	}
+	if len(headers) > maxBatchVideos() {
+		http.Error(w, fmt.Sprintf("Lote excede o limite de %d vídeos", maxBatchVideos()), http.StatusBadRequest)
+		return
+	}
+
+	overlay, err := parseOverlayOptions(r.FormValue("overlay"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	renditions, err := parseRenditions(r.FormValue("renditions"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	pipeline, err := parsePipeline(r.FormValue("pipeline"))
+	if err != nil {
+		status := http.StatusBadRequest
+		if pErr, ok := err.(*pipelineError); ok {
+			status = pErr.Status
+		}
+		http.Error(w, err.Error(), status)
+		return
+	}
+	if overlay != nil && overlay.Type == "image" && !us.hasWatermark(userID) {
+		http.Error(w, "Envie a marca d'água em /watermark antes de usar overlay de imagem", http.StatusBadRequest)
+		return
+	}
+
+	// Validar todos os arquivos antes de enviar qualquer um: o lote só é
+	// criado se todos forem aceitos
+	files := make([]batchFile, 0, len(headers))
+	for _, header := range headers {
+		file, err := header.Open()
+		if err != nil {
+			http.Error(w, "Erro ao processar formulário", http.StatusBadRequest)
+			return
+		}
+		duration, err := validateVideoFile(file, header.Filename)
+		file.Close()
+		if err != nil {
+			if rejection, ok := err.(*media.Rejection); ok {
+				log.Printf("Arquivo do lote rejeitado %s: %v", header.Filename, rejection)
+				rejection.Message = fmt.Sprintf("%s: %s", header.Filename, rejection.Message)
+				writeMediaRejection(w, rejection)
+				return
+			}
+			log.Printf("Erro ao validar arquivo %s: %v", header.Filename, err)
+			writeValidationError(w, err)
+			return
+		}
+		files = append(files, batchFile{videoID: generateVideoID(), header: header, duration: duration})
+	}
+
+	// O lote inteiro precisa caber nas cotas do usuário
+	var request QuotaRequest
+	for _, f := range files {
+		request.Reserve = append(request.Reserve, reservedVideo(f.videoID, f.header.Size, f.duration, renditions))
+	}
+	if err := checkQuota(userID, request); err != nil {
+		log.Printf("Lote do usuário %s recusado pelas cotas: %v", userID, err)
+		writeQuotaError(w, err)
+		return
+	}
+	// Em caso de erro, devolve a cota dos vídeos ainda não enfileirados
+	releaseFrom := func(i int) {
+		for _, f := range files[i:] {
+			releaseQuota(userID, f.videoID)
+		}
+	}
+
+	batchID := generateBatchID()
+	messages := make([]ProcessingMessage, 0, len(files))
+	response := BatchUploadResponse{BatchID: batchID, Status: "uploaded", UploadedAt: time.Now()}
+
+	for _, f := range files {
+		videoID := f.videoID
+		objectName := videoID + filepath.Ext(f.header.Filename)
+		contentHash, err := us.storeOriginal(f.header, objectName)
+		if err != nil {
+			log.Printf("Erro ao enviar %s do lote %s para o MinIO: %v", f.header.Filename, batchID, err)
+			releaseFrom(0)
+			http.Error(w, "Erro interno do servidor", http.StatusInternalServerError)
+			return
+		}
+
+		messages = append(messages, ProcessingMessage{
+			VideoID:     videoID,
+			Filename:    f.header.Filename,
+			Bucket:      "video-uploads",
+			ObjectName:  objectName,
+			UserID:      userID,
+			Overlay:     overlay,
+			Pipeline:    pipeline,
+			Sequence:    1,
+			Size:        f.header.Size,
+			Duration:    f.duration,
+			ContentHash: contentHash,
+			BatchID:     batchID,
+			BatchSize:   len(files),
+		})
+		response.Videos = append(response.Videos, UploadResponse{
+			ID:         videoID,
+			Filename:   f.header.Filename,
+			Size:       f.header.Size,
+			Status:     "uploaded",
+			UploadedAt: time.Now(),
+			Renditions: renditions,
+		})
+	}
+
+	// Enfileirar só depois que todos os originais estão no MinIO
+	for i, message := range messages {
+		if err := us.publishEvent(message, EventUploaded); err != nil {
+			log.Printf("Erro ao publicar evento uploaded do vídeo %s: %v", message.VideoID, err)
+		}
+		if err := us.enqueueJob(message); err != nil {
+			log.Printf("Erro ao enfileirar vídeo %s do lote %s: %v", message.VideoID, batchID, err)
+			releaseFrom(i)
+			http.Error(w, "Erro interno do servidor", http.StatusInternalServerError)
+			return
+		}
+
+		if len(renditions) > 0 {
+			err := us.enqueueJob(ProcessingMessage{
+				VideoID:     message.VideoID,
+				Filename:    message.Filename,
+				Bucket:      message.Bucket,
+				ObjectName:  message.ObjectName,
+				UserID:      userID,
+				JobType:     "transcode",
+				Renditions:  renditions,
+				Size:        message.Size,
+				Duration:    message.Duration,
+				ContentHash: message.ContentHash,
+			})
+			if err != nil {
+				log.Printf("Erro ao enviar job de transcodificação do vídeo %s: %v", message.VideoID, err)
+				http.Error(w, "Erro interno do servidor", http.StatusInternalServerError)
+				return
+			}
+		}
+	}
+
+	log.Printf("Lote %s enviado com %d vídeos para o usuário %s", batchID, len(messages), userID)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// Enviar o original para o MinIO calculando o SHA-256 no mesmo fluxo
+func (us *UploadService) storeOriginal(header *multipart.FileHeader, objectName string) (string, error) {
+	file, err := header.Open()
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	hasher := sha256.New()
+	_, err = us.MinioClient.PutObject(ctx, "video-uploads", objectName, io.TeeReader(file, hasher), header.Size, minio.PutObjectOptions{
+		ContentType: "video/*",
+	})
+	if err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(hasher.Sum(nil)), nil
+}
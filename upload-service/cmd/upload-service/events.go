@@ -0,0 +1,87 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/streadway/amqp"
+)
+
+// Exchange topic com os eventos de ciclo de vida dos jobs (video.<job_type>.<evento>)
+const eventsExchange = "video.events"
+
+const (
+	EventUploaded = "uploaded"
+	EventQueued   = "queued"
+)
+
+// Evento de ciclo de vida; os demais campos são preenchidos pelo processing-service
+type JobEvent struct {
+	Event       string    `json:"event"`
+	VideoID     string    `json:"video_id"`
+	JobType     string    `json:"job_type"`
+	UserID      string    `json:"user_id"`
+	Sequence    int64     `json:"sequence"`
+	Timestamp   time.Time `json:"timestamp"`
+	Filename    string    `json:"filename,omitempty"`
+	Object      string    `json:"object_name,omitempty"`  // original em video-uploads
+	ContentHash string    `json:"content_hash,omitempty"` // SHA-256 do original
+	Size        int64     `json:"size,omitempty"`         // bytes do original
+	Duration    float64   `json:"duration,omitempty"`     // segundos
+	BatchID     string    `json:"batch_id,omitempty"`
+	BatchSize   int       `json:"batch_size,omitempty"`
+}
+
+// Publicar evento do job usando a sequência atual da mensagem
+func (us *UploadService) publishEvent(message ProcessingMessage, event string) error {
+	jobType := message.JobType
+	if jobType == "" {
+		jobType = "frames"
+	}
+
+	now := time.Now()
+	body, err := json.Marshal(JobEvent{
+		Event:       event,
+		VideoID:     message.VideoID,
+		JobType:     jobType,
+		UserID:      message.UserID,
+		Sequence:    message.Sequence,
+		Timestamp:   now,
+		Filename:    message.Filename,
+		Object:      message.ObjectName,
+		ContentHash: message.ContentHash,
+		Size:        message.Size,
+		Duration:    message.Duration,
+		BatchID:     message.BatchID,
+		BatchSize:   message.BatchSize,
+	})
+	if err != nil {
+		return fmt.Errorf("erro ao serializar evento: %v", err)
+	}
+
+	return us.RabbitCh.Publish(
+		eventsExchange, // exchange
+		fmt.Sprintf("video.%s.%s", jobType, event), // routing key
+		false, // mandatory
+		false, // immediate
+		amqp.Publishing{
+			ContentType:  "application/json",
+			DeliveryMode: amqp.Persistent,
+			Timestamp:    now,
+			Body:         body,
+		})
+}
+
+// Enfileirar o job e publicar o evento queued com a próxima sequência
+func (us *UploadService) enqueueJob(message ProcessingMessage) error {
+	message.Sequence++
+	if err := us.publishProcessingMessage(message); err != nil {
+		return err
+	}
+	if err := us.publishEvent(message, EventQueued); err != nil {
+		log.Printf("Erro ao publicar evento queued do vídeo %s: %v", message.VideoID, err)
+	}
+	return nil
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/fiap/projeto-fiapx/shared/media"
+)
+
+// Prober usado na validação dos uploads (substituível em testes)
+var mediaProber media.Prober = media.FFprobe{}
+
+// Validar o arquivo enviado: extensão, assinatura do container e, via
+// mediaProber, streams, codec, duração e decodificação do primeiro frame.
+// Retorna a duração em segundos; o arquivo é rebobinado ao final para o upload
+func validateVideoFile(file io.ReadSeeker, filename string) (float64, error) {
+	if !isValidVideoFile(filename) {
+		return 0, &media.Rejection{Code: media.RejectUnsupportedExtension, Message: "Tipo de arquivo não suportado. Use: mp4, avi, mov, mkv, webm"}
+	}
+
+	header := make([]byte, 12)
+	n, err := io.ReadFull(file, header)
+	if err != nil && err != io.ErrUnexpectedEOF {
+		return 0, &media.Rejection{Code: media.RejectCorruptFile, Message: "Arquivo vazio ou ilegível"}
+	}
+	if media.DetectContainer(header[:n]) == "" {
+		return 0, &media.Rejection{Code: media.RejectUnrecognizedFormat, Message: "O conteúdo do arquivo não é um vídeo reconhecido"}
+	}
+
+	// ffprobe precisa de acesso aleatório (moov no fim do MP4), então o
+	// conteúdo vai para um arquivo temporário
+	tmp, err := os.CreateTemp("", "upload-probe-*")
+	if err != nil {
+		return 0, fmt.Errorf("erro ao criar arquivo temporário: %v", err)
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		return 0, err
+	}
+	if _, err := io.Copy(tmp, file); err != nil {
+		return 0, fmt.Errorf("erro ao copiar arquivo para validação: %v", err)
+	}
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		return 0, err
+	}
+
+	return probeVideoFile(tmp.Name())
+}
+
+// Sem ffprobe o erro sobe e o upload é recusado, em vez de aceito com
+// duração 0 (que zeraria também a estimativa de processamento das cotas)
+func probeVideoFile(path string) (float64, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	info, err := mediaProber.Probe(ctx, path)
+	if err != nil {
+		return 0, media.ProbeRejection(err)
+	}
+
+	if err := media.CheckInfo(info); err != nil {
+		return 0, err
+	}
+
+	// Decodificar o primeiro frame detecta arquivos truncados que o ffprobe aceita
+	if err := mediaProber.DecodeFirstFrame(ctx, path); err != nil {
+		return 0, media.ProbeRejection(err)
+	}
+
+	return info.Duration, nil
+}
+
+// Responder a falha de validação que não é rejeição do arquivo: sem ffprobe
+// o serviço não aceita uploads (503)
+func writeValidationError(w http.ResponseWriter, err error) {
+	if errors.Is(err, media.ErrProberUnavailable) {
+		http.Error(w, "Validação de vídeo indisponível no momento", http.StatusServiceUnavailable)
+		return
+	}
+	http.Error(w, "Erro interno do servidor", http.StatusInternalServerError)
+}
+
+// Responder a rejeição com o código estruturado
+func writeMediaRejection(w http.ResponseWriter, rejection *media.Rejection) {
+	status := http.StatusUnprocessableEntity
+	if rejection.Code == media.RejectUnsupportedExtension {
+		status = http.StatusBadRequest
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"error": rejection,
+	})
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/fiap/projeto-fiapx/shared/media"
+)
+
+// Prober em processo: devolve Info ou os erros configurados
+type fakeProber struct {
+	Info      media.Info
+	Err       error
+	DecodeErr error
+}
+
+func (f fakeProber) Probe(ctx context.Context, videoPath string) (*media.Info, error) {
+	if f.Err != nil {
+		return nil, f.Err
+	}
+	info := f.Info
+	return &info, nil
+}
+
+func (f fakeProber) DecodeFirstFrame(ctx context.Context, videoPath string) error {
+	return f.DecodeErr
+}
+
+func useProber(t *testing.T, prober media.Prober) {
+	t.Helper()
+	previous := mediaProber
+	mediaProber = prober
+	t.Cleanup(func() { mediaProber = previous })
+}
+
+var mp4Header = []byte("\x00\x00\x00\x20ftypisom\x00\x00\x02\x00")
+
+func TestValidateVideoFile(t *testing.T) {
+	h264 := fakeProber{Info: media.Info{VideoCodec: "h264", Duration: 12.5}}
+
+	tests := []struct {
+		name     string
+		filename string
+		content  []byte
+		prober   media.Prober
+		wantCode string
+	}{
+		{"extensão não suportada", "video.txt", mp4Header, h264, media.RejectUnsupportedExtension},
+		{"arquivo vazio", "video.mp4", nil, h264, media.RejectCorruptFile},
+		{"texto renomeado", "video.mp4", []byte("isto não é um vídeo, apenas texto"), h264, media.RejectUnrecognizedFormat},
+		{"container ilegível", "video.mp4", mp4Header, fakeProber{Err: &media.ProbeError{Message: "Não foi possível ler o container do vídeo"}}, media.RejectCorruptFile},
+		{"só áudio", "video.mp4", mp4Header, fakeProber{Info: media.Info{Duration: 180}}, media.RejectNoVideoStream},
+		{"codec não suportado", "video.mp4", mp4Header, fakeProber{Info: media.Info{VideoCodec: "cinepak", Duration: 10}}, media.RejectUnsupportedCodec},
+		{"duração zero", "video.mp4", mp4Header, fakeProber{Info: media.Info{VideoCodec: "h264"}}, media.RejectZeroDuration},
+		{"primeiro frame não decodifica", "video.mp4", mp4Header, fakeProber{Info: h264.Info, DecodeErr: &media.ProbeError{Message: "Não foi possível decodificar o vídeo"}}, media.RejectCorruptFile},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			useProber(t, tt.prober)
+			_, err := validateVideoFile(bytes.NewReader(tt.content), tt.filename)
+			var rejection *media.Rejection
+			require.ErrorAs(t, err, &rejection)
+			assert.Equal(t, tt.wantCode, rejection.Code)
+		})
+	}
+
+	t.Run("vídeo válido devolve a duração e rebobina o arquivo", func(t *testing.T) {
+		useProber(t, h264)
+		file := bytes.NewReader(mp4Header)
+		duration, err := validateVideoFile(file, "video.mp4")
+		require.NoError(t, err)
+		assert.Equal(t, 12.5, duration)
+		content, err := io.ReadAll(file)
+		require.NoError(t, err)
+		assert.Equal(t, mp4Header, content)
+	})
+
+	t.Run("AVI com codec legado é aceito", func(t *testing.T) {
+		useProber(t, fakeProber{Info: media.Info{VideoCodec: "msmpeg4v3", Duration: 30}})
+		duration, err := validateVideoFile(bytes.NewReader([]byte("RIFF\x00\x00\x00\x00AVI LIST")), "video.avi")
+		require.NoError(t, err)
+		assert.Equal(t, 30.0, duration)
+	})
+
+	t.Run("sem ffprobe o upload é recusado", func(t *testing.T) {
+		useProber(t, fakeProber{Err: media.ErrProberUnavailable})
+		_, err := validateVideoFile(bytes.NewReader(mp4Header), "video.mp4")
+		require.ErrorIs(t, err, media.ErrProberUnavailable)
+		var rejection *media.Rejection
+		assert.False(t, errors.As(err, &rejection), "indisponibilidade não é rejeição do arquivo")
+
+		rec := httptest.NewRecorder()
+		writeValidationError(rec, err)
+		assert.Equal(t, http.StatusServiceUnavailable, rec.Code)
+
+		rec = httptest.NewRecorder()
+		writeValidationError(rec, errors.New("disco cheio"))
+		assert.Equal(t, http.StatusInternalServerError, rec.Code)
+	})
+}
+
+func TestWriteMediaRejection(t *testing.T) {
+	tests := map[string]int{
+		media.RejectUnsupportedExtension: http.StatusBadRequest,
+		media.RejectCorruptFile:          http.StatusUnprocessableEntity,
+		media.RejectZeroDuration:         http.StatusUnprocessableEntity,
+	}
+	for code, wantStatus := range tests {
+		rec := httptest.NewRecorder()
+		writeMediaRejection(rec, &media.Rejection{Code: code, Message: "recusado", Detail: "detalhe"})
+		assert.Equal(t, wantStatus, rec.Code, code)
+
+		var body struct {
+			Error media.Rejection `json:"error"`
+		}
+		require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &body))
+		assert.Equal(t, code, body.Error.Code)
+		assert.Equal(t, "detalhe", body.Error.Detail)
+	}
+}
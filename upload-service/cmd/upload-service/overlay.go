@@ -0,0 +1,139 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/minio/minio-go/v7"
+)
+
+// Bucket com arquivos enviados pelo usuário (marcas d'água)
+const userAssetsBucket = "user-assets"
+
+// Tamanho máximo da imagem de marca d'água
+const maxWatermarkSize = 5 << 20
+
+// Opções de marca d'água/texto aplicadas sobre os frames de um job
+type OverlayOptions struct {
+	Type     string  `json:"type"`               // "image" ou "text"
+	Text     string  `json:"text,omitempty"`     // template com {video_id}, {timestamp} e {user}
+	Position string  `json:"position,omitempty"` // top-left, top-right, bottom-left, bottom-right, center
+	Opacity  float64 `json:"opacity,omitempty"`  // 0 a 1
+	Scale    float64 `json:"scale,omitempty"`    // fração da largura (imagem) ou altura (texto) do frame
+	Margin   int     `json:"margin,omitempty"`   // distância da borda em pixels
+}
+
+var validOverlayPositions = map[string]bool{
+	"":             true,
+	"top-left":     true,
+	"top-right":    true,
+	"bottom-left":  true,
+	"bottom-right": true,
+	"center":       true,
+}
+
+func watermarkObjectName(userID string) string {
+	return fmt.Sprintf("watermarks/%s.png", userID)
+}
+
+// Ler e validar o campo "overlay" (JSON) do formulário de upload
+func parseOverlayOptions(raw string) (*OverlayOptions, error) {
+	if strings.TrimSpace(raw) == "" {
+		return nil, nil
+	}
+
+	var options OverlayOptions
+	if err := json.Unmarshal([]byte(raw), &options); err != nil {
+		return nil, fmt.Errorf("overlay inválido: %v", err)
+	}
+
+	switch options.Type {
+	case "image":
+	case "text":
+		if strings.TrimSpace(options.Text) == "" {
+			return nil, fmt.Errorf("overlay de texto requer o campo text")
+		}
+	default:
+		return nil, fmt.Errorf("tipo de overlay inválido: %q (use image ou text)", options.Type)
+	}
+	if !validOverlayPositions[options.Position] {
+		return nil, fmt.Errorf("posição de overlay inválida: %q", options.Position)
+	}
+	if options.Opacity < 0 || options.Opacity > 1 {
+		return nil, fmt.Errorf("opacidade do overlay deve estar entre 0 e 1")
+	}
+	if options.Scale < 0 || options.Scale > 1 {
+		return nil, fmt.Errorf("escala do overlay deve estar entre 0 e 1")
+	}
+	if options.Margin < 0 {
+		return nil, fmt.Errorf("margem do overlay não pode ser negativa")
+	}
+
+	return &options, nil
+}
+
+// Verificar se o usuário já enviou a marca d'água
+func (us *UploadService) hasWatermark(userID string) bool {
+	_, err := us.MinioClient.StatObject(ctx, userAssetsBucket, watermarkObjectName(userID), minio.StatObjectOptions{})
+	return err == nil
+}
+
+// Handler para envio da marca d'água do usuário (PNG), reutilizada em todos os jobs
+func (us *UploadService) WatermarkHandler(w http.ResponseWriter, r *http.Request) {
+	userID, err := requestUserID(r)
+	if err != nil {
+		http.Error(w, "Token de autenticação inválido", http.StatusUnauthorized)
+		return
+	}
+
+	err = r.ParseMultipartForm(maxWatermarkSize)
+	if err != nil {
+		http.Error(w, "Erro ao processar formulário", http.StatusBadRequest)
+		return
+	}
+
+	file, header, err := r.FormFile("watermark")
+	if err != nil {
+		http.Error(w, "Arquivo não encontrado", http.StatusBadRequest)
+		return
+	}
+	defer file.Close()
+
+	if header.Size > maxWatermarkSize {
+		http.Error(w, "Marca d'água excede o tamanho máximo de 5 MB", http.StatusRequestEntityTooLarge)
+		return
+	}
+
+	data, err := io.ReadAll(file)
+	if err != nil {
+		http.Error(w, "Erro ao ler arquivo", http.StatusBadRequest)
+		return
+	}
+	if http.DetectContentType(data) != "image/png" {
+		http.Error(w, "A marca d'água deve ser uma imagem PNG", http.StatusBadRequest)
+		return
+	}
+
+	objectName := watermarkObjectName(userID)
+	_, err = us.MinioClient.PutObject(ctx, userAssetsBucket, objectName, bytes.NewReader(data), int64(len(data)), minio.PutObjectOptions{
+		ContentType: "image/png",
+	})
+	if err != nil {
+		log.Printf("Erro ao salvar marca d'água no MinIO: %v", err)
+		http.Error(w, "Erro interno do servidor", http.StatusInternalServerError)
+		return
+	}
+
+	log.Printf("Marca d'água salva para usuário %s (%d bytes)", userID, len(data))
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"object_name": objectName,
+		"size":        len(data),
+	})
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Pipeline declarativo do job (validado pelo registro de etapas do processing-service)
+type Pipeline struct {
+	Stages []PipelineStage `json:"stages"`
+}
+
+type PipelineStage struct {
+	Type   string                 `json:"type"`
+	Params map[string]interface{} `json:"params,omitempty"`
+}
+
+// Erro de validação do pipeline com o status HTTP a devolver ao cliente
+type pipelineError struct {
+	Status  int
+	Message string
+}
+
+func (e *pipelineError) Error() string {
+	return e.Message
+}
+
+var pipelineClient = &http.Client{Timeout: 5 * time.Second}
+
+// Ler o campo "pipeline" (JSON) do formulário e validá-lo no processing-service
+func parsePipeline(raw string) (*Pipeline, error) {
+	if strings.TrimSpace(raw) == "" {
+		return nil, nil
+	}
+
+	var pipeline Pipeline
+	if err := json.Unmarshal([]byte(raw), &pipeline); err != nil {
+		return nil, &pipelineError{Status: http.StatusBadRequest, Message: fmt.Sprintf("pipeline inválido: %v", err)}
+	}
+
+	body, err := json.Marshal(pipeline)
+	if err != nil {
+		return nil, &pipelineError{Status: http.StatusBadRequest, Message: fmt.Sprintf("pipeline inválido: %v", err)}
+	}
+
+	url := getEnv("PROCESSING_SERVICE_URL", "http://processing-service:8080") + "/pipelines/validate"
+	resp, err := pipelineClient.Post(url, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return nil, &pipelineError{Status: http.StatusServiceUnavailable, Message: "não foi possível validar o pipeline no momento"}
+	}
+	defer resp.Body.Close()
+
+	var validation struct {
+		Valid bool   `json:"valid"`
+		Error string `json:"error"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&validation); err != nil {
+		return nil, &pipelineError{Status: http.StatusServiceUnavailable, Message: "resposta inválida ao validar o pipeline"}
+	}
+	if !validation.Valid {
+		return nil, &pipelineError{Status: http.StatusBadRequest, Message: "pipeline inválido: " + validation.Error}
+	}
+
+	return &pipeline, nil
+}
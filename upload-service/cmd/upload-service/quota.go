@@ -0,0 +1,162 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// Códigos devolvidos quando o upload passaria de uma cota do usuário
+const (
+	QuotaStorageExceeded    = "STORAGE_QUOTA_EXCEEDED"
+	QuotaVideosExceeded     = "VIDEO_QUOTA_EXCEEDED"
+	QuotaProcessingExceeded = "PROCESSING_QUOTA_EXCEEDED"
+)
+
+// Vídeos do upload cuja cota o storage-service reserva se couberem; a reserva
+// é trocada pelo consumo real nos eventos de cada vídeo
+type QuotaRequest struct {
+	Reserve []ReservedVideo `json:"reserve"`
+}
+
+// Cota de um vídeo: bytes do original e segundos de cada job
+type ReservedVideo struct {
+	VideoID          string  `json:"video_id"`
+	Bytes            int64   `json:"bytes"`
+	FramesSeconds    float64 `json:"frames_seconds"`
+	TranscodeSeconds float64 `json:"transcode_seconds"`
+}
+
+// Cota ultrapassada, como devolvida pelo storage-service
+type QuotaViolation struct {
+	Code      string     `json:"code"`
+	Quota     string     `json:"quota"`
+	Message   string     `json:"message"`
+	Limit     float64    `json:"limit"`
+	Used      float64    `json:"used"`
+	Requested float64    `json:"requested"`
+	ResetsAt  *time.Time `json:"resets_at,omitempty"`
+}
+
+func (v *QuotaViolation) Error() string {
+	return fmt.Sprintf("%s: %s", v.Quota, v.Message)
+}
+
+// Erro ao consultar as cotas; o upload é recusado com 503
+type quotaUnavailableError struct {
+	Err error
+}
+
+func (e *quotaUnavailableError) Error() string {
+	return fmt.Sprintf("não foi possível verificar as cotas: %v", e.Err)
+}
+
+var quotaClient = &http.Client{Timeout: 5 * time.Second}
+
+// Cota a reservar para um vídeo: cada job (frames e, com rendições, a
+// transcodificação) processa o vídeo inteiro
+func reservedVideo(videoID string, size int64, duration float64, renditions []string) ReservedVideo {
+	video := ReservedVideo{VideoID: videoID, Bytes: size, FramesSeconds: duration}
+	if len(renditions) > 0 {
+		video.TranscodeSeconds = duration
+	}
+	return video
+}
+
+// Verificar no storage-service se o upload cabe nas cotas do usuário e
+// reservá-las; retorna *QuotaViolation se não couber
+func checkQuota(userID string, request QuotaRequest) error {
+	body, err := json.Marshal(request)
+	if err != nil {
+		return err
+	}
+
+	url := fmt.Sprintf("%s/internal/quotas/%s/check", getEnv("STORAGE_SERVICE_URL", "http://storage-service:8080"), userID)
+	req, err := http.NewRequest(http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return &quotaUnavailableError{Err: err}
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Service-Token", getEnv("INTERNAL_SERVICE_TOKEN", ""))
+
+	resp, err := quotaClient.Do(req)
+	if err != nil {
+		return &quotaUnavailableError{Err: err}
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return &quotaUnavailableError{Err: fmt.Errorf("storage-service respondeu %d", resp.StatusCode)}
+	}
+
+	var check struct {
+		Allowed  bool            `json:"allowed"`
+		Exceeded *QuotaViolation `json:"exceeded"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&check); err != nil {
+		return &quotaUnavailableError{Err: fmt.Errorf("resposta inválida: %v", err)}
+	}
+	if check.Allowed || check.Exceeded == nil {
+		return nil
+	}
+
+	violation := check.Exceeded
+	switch violation.Quota {
+	case "storage_bytes":
+		violation.Code = QuotaStorageExceeded
+	case "videos_per_month":
+		violation.Code = QuotaVideosExceeded
+	default:
+		violation.Code = QuotaProcessingExceeded
+	}
+	return violation
+}
+
+// Devolver a reserva de um vídeo cujo upload falhou depois da checagem. Erros
+// só são registrados: a reserva vence sozinha
+func releaseQuota(userID, videoID string) {
+	url := fmt.Sprintf("%s/internal/quotas/%s/reservations/%s", getEnv("STORAGE_SERVICE_URL", "http://storage-service:8080"), userID, videoID)
+	req, err := http.NewRequest(http.MethodDelete, url, nil)
+	if err != nil {
+		log.Printf("Erro ao liberar a cota do vídeo %s: %v", videoID, err)
+		return
+	}
+	req.Header.Set("X-Service-Token", getEnv("INTERNAL_SERVICE_TOKEN", ""))
+
+	resp, err := quotaClient.Do(req)
+	if err != nil {
+		log.Printf("Erro ao liberar a cota do vídeo %s: %v", videoID, err)
+		return
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNoContent {
+		log.Printf("Erro ao liberar a cota do vídeo %s: storage-service respondeu %d", videoID, resp.StatusCode)
+	}
+}
+
+// Responder a recusa por cota: 413 para armazenamento (só libera excluindo
+// vídeos) e 429 com Retry-After para as cotas mensais
+func writeQuotaError(w http.ResponseWriter, err error) {
+	violation, ok := err.(*QuotaViolation)
+	if !ok {
+		log.Printf("Erro ao verificar cotas: %v", err)
+		http.Error(w, "Não foi possível verificar as cotas no momento", http.StatusServiceUnavailable)
+		return
+	}
+
+	status := http.StatusRequestEntityTooLarge
+	if violation.ResetsAt != nil {
+		status = http.StatusTooManyRequests
+		retryAfter := math.Ceil(time.Until(*violation.ResetsAt).Seconds())
+		w.Header().Set("Retry-After", strconv.Itoa(int(max(retryAfter, 1))))
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"error": violation,
+	})
+}
@@ -0,0 +1,185 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReservedVideo(t *testing.T) {
+	assert.Equal(t, ReservedVideo{VideoID: "video_1", Bytes: 200, FramesSeconds: 90}, reservedVideo("video_1", 200, 90, nil))
+	assert.Equal(t, ReservedVideo{VideoID: "video_1", Bytes: 200, FramesSeconds: 90, TranscodeSeconds: 90}, reservedVideo("video_1", 200, 90, []string{"720p"}))
+}
+
+func TestCheckQuota(t *testing.T) {
+	resetsAt := time.Now().Add(90 * time.Minute).UTC().Truncate(time.Second)
+
+	tests := []struct {
+		name       string
+		status     int
+		response   string
+		wantErr    bool
+		wantCode   string
+		wantStatus int
+		retryAfter bool
+	}{
+		{
+			name:     "dentro das cotas",
+			status:   http.StatusOK,
+			response: `{"allowed": true}`,
+		},
+		{
+			name:       "armazenamento cheio",
+			status:     http.StatusOK,
+			response:   `{"allowed": false, "exceeded": {"quota": "storage_bytes", "message": "Cota de armazenamento excedida", "limit": 1000, "used": 900, "requested": 200}}`,
+			wantErr:    true,
+			wantCode:   QuotaStorageExceeded,
+			wantStatus: http.StatusRequestEntityTooLarge,
+		},
+		{
+			name:       "vídeos do mês",
+			status:     http.StatusOK,
+			response:   `{"allowed": false, "exceeded": {"quota": "videos_per_month", "message": "Cota mensal de vídeos excedida", "limit": 3, "used": 3, "requested": 1, "resets_at": "` + resetsAt.Format(time.RFC3339) + `"}}`,
+			wantErr:    true,
+			wantCode:   QuotaVideosExceeded,
+			wantStatus: http.StatusTooManyRequests,
+			retryAfter: true,
+		},
+		{
+			name:       "minutos de processamento do mês",
+			status:     http.StatusOK,
+			response:   `{"allowed": false, "exceeded": {"quota": "processing_minutes", "message": "Cota mensal de processamento excedida", "limit": 10, "used": 9, "requested": 2, "resets_at": "` + resetsAt.Format(time.RFC3339) + `"}}`,
+			wantErr:    true,
+			wantCode:   QuotaProcessingExceeded,
+			wantStatus: http.StatusTooManyRequests,
+			retryAfter: true,
+		},
+		{
+			name:       "storage-service com erro",
+			status:     http.StatusInternalServerError,
+			response:   `{"error": "falha"}`,
+			wantErr:    true,
+			wantStatus: http.StatusServiceUnavailable,
+		},
+		{
+			name:       "token recusado",
+			status:     http.StatusUnauthorized,
+			response:   `{"error": "token inválido"}`,
+			wantErr:    true,
+			wantStatus: http.StatusServiceUnavailable,
+		},
+		{
+			name:       "resposta inválida",
+			status:     http.StatusOK,
+			response:   `{`,
+			wantErr:    true,
+			wantStatus: http.StatusServiceUnavailable,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var received QuotaRequest
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				assert.Equal(t, http.MethodPost, r.Method)
+				assert.Equal(t, "/internal/quotas/7/check", r.URL.Path)
+				assert.Equal(t, "servico", r.Header.Get("X-Service-Token"))
+				body, err := io.ReadAll(r.Body)
+				require.NoError(t, err)
+				require.NoError(t, json.Unmarshal(body, &received))
+
+				w.Header().Set("Content-Type", "application/json")
+				w.WriteHeader(tt.status)
+				io.WriteString(w, tt.response)
+			}))
+			defer server.Close()
+			t.Setenv("STORAGE_SERVICE_URL", server.URL)
+			t.Setenv("INTERNAL_SERVICE_TOKEN", "servico")
+
+			request := QuotaRequest{Reserve: []ReservedVideo{{VideoID: "video_1", Bytes: 200, FramesSeconds: 60, TranscodeSeconds: 60}}}
+			err := checkQuota("7", request)
+			assert.Equal(t, request, received)
+			if !tt.wantErr {
+				assert.NoError(t, err)
+				return
+			}
+			require.Error(t, err)
+
+			if tt.wantCode != "" {
+				var violation *QuotaViolation
+				require.ErrorAs(t, err, &violation)
+				assert.Equal(t, tt.wantCode, violation.Code)
+			}
+
+			rec := httptest.NewRecorder()
+			writeQuotaError(rec, err)
+			assert.Equal(t, tt.wantStatus, rec.Code)
+
+			retryAfter := rec.Header().Get("Retry-After")
+			if !tt.retryAfter {
+				assert.Empty(t, retryAfter)
+			} else {
+				seconds, err := strconv.Atoi(retryAfter)
+				require.NoError(t, err)
+				assert.InDelta(t, 90*60, seconds, 5)
+			}
+
+			if tt.wantCode != "" {
+				var body struct {
+					Error QuotaViolation `json:"error"`
+				}
+				require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &body))
+				assert.Equal(t, tt.wantCode, body.Error.Code)
+			}
+		})
+	}
+
+	t.Run("storage-service fora do ar", func(t *testing.T) {
+		server := httptest.NewServer(http.NotFoundHandler())
+		server.Close()
+		t.Setenv("STORAGE_SERVICE_URL", server.URL)
+
+		err := checkQuota("7", QuotaRequest{Reserve: []ReservedVideo{{VideoID: "video_1"}}})
+		var unavailable *quotaUnavailableError
+		require.ErrorAs(t, err, &unavailable)
+
+		rec := httptest.NewRecorder()
+		writeQuotaError(rec, err)
+		assert.Equal(t, http.StatusServiceUnavailable, rec.Code)
+	})
+
+	t.Run("reset já passou ainda pede ao menos 1 segundo", func(t *testing.T) {
+		past := time.Now().Add(-time.Minute)
+		rec := httptest.NewRecorder()
+		writeQuotaError(rec, &QuotaViolation{Quota: "videos_per_month", ResetsAt: &past})
+		assert.Equal(t, http.StatusTooManyRequests, rec.Code)
+		assert.Equal(t, "1", rec.Header().Get("Retry-After"))
+	})
+}
+
+func TestReleaseQuota(t *testing.T) {
+	released := make(chan string, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, http.MethodDelete, r.Method)
+		assert.Equal(t, "servico", r.Header.Get("X-Service-Token"))
+		released <- r.URL.Path
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+	t.Setenv("STORAGE_SERVICE_URL", server.URL)
+	t.Setenv("INTERNAL_SERVICE_TOKEN", "servico")
+
+	releaseQuota("7", "video_1")
+	assert.Equal(t, "/internal/quotas/7/reservations/video_1", <-released)
+
+	// Storage-service fora do ar: só registra o erro
+	server.Close()
+	releaseQuota("7", "video_1")
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"context"
+	"io"
+	"os"
+	"time"
+
+	"github.com/fiap/projeto-fiapx/shared/media"
+)
+
+// Validar o vídeo salvo: assinatura do container e, via mediaProber, streams,
+// codec, duração e decodificação do primeiro frame
+func validateVideoFile(path string) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	header := make([]byte, 12)
+	n, err := io.ReadFull(file, header)
+	file.Close()
+	if err != nil && err != io.ErrUnexpectedEOF {
+		return &media.Rejection{Code: media.RejectCorruptFile, Message: "Arquivo vazio ou ilegível"}
+	}
+	if media.DetectContainer(header[:n]) == "" {
+		return &media.Rejection{Code: media.RejectUnrecognizedFormat, Message: "O conteúdo do arquivo não é um vídeo reconhecido"}
+	}
+
+	// Sem ffprobe o erro sobe e o upload é recusado, em vez de aceito às cegas
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	info, err := mediaProber.Probe(ctx, path)
+	if err != nil {
+		return media.ProbeRejection(err)
+	}
+	if err := media.CheckInfo(info); err != nil {
+		return err
+	}
+
+	// Decodificar o primeiro frame detecta arquivos truncados que o ffprobe aceita
+	if err := mediaProber.DecodeFirstFrame(ctx, path); err != nil {
+		return media.ProbeRejection(err)
+	}
+
+	return nil
+}